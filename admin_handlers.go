@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/frankielb/chirpy/internal/database"
+	"github.com/frankielb/chirpy/internal/service"
+	"github.com/google/uuid"
+)
+
+// user roles, each one can do everything the ones before it can
+const (
+	roleUser      = "user"
+	roleModerator = "moderator"
+	roleAdmin     = "admin"
+)
+
+var roleRank = map[string]int{
+	roleUser:      0,
+	roleModerator: 1,
+	roleAdmin:     2,
+}
+
+type contextKey string
+
+const userContextKey contextKey = "user"
+
+// userFromContext gets the user middlewareRequireRole loaded.
+func userFromContext(ctx context.Context) (database.User, bool) {
+	user, ok := ctx.Value(userContextKey).(database.User)
+	return user, ok
+}
+
+// middlewareRequireRole only lets through users with at least the given role.
+// The role is read from the database rather than the jwt so a demotion or
+// suspension takes effect straight away.
+func (cfg *apiConfig) middlewareRequireRole(role string, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := cfg.authUserID(w, r)
+		if !ok {
+			return
+		}
+		user, err := cfg.DB.GetUserByID(r.Context(), userID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				respondJSONError(w, r, http.StatusUnauthorized, "unauthorized: no user", err)
+				return
+			}
+			respondJSONError(w, r, http.StatusInternalServerError, "Couldn't get user", err)
+			return
+		}
+		if service.IsSuspended(user) {
+			respondJSONError(w, r, http.StatusForbidden, "account suspended", nil)
+			return
+		}
+		if roleRank[user.Role] < roleRank[role] {
+			respondJSONError(w, r, http.StatusForbidden, "Forbidden", nil)
+			return
+		}
+		ctx := context.WithValue(r.Context(), userContextKey, user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// checkNotSuspended writes a 403 if the user is suspended.
+func (cfg *apiConfig) checkNotSuspended(w http.ResponseWriter, r *http.Request, userID uuid.UUID) bool {
+	if err := cfg.Service.CheckNotSuspended(r.Context(), userID); err != nil {
+		respondServiceError(w, r, err)
+		return false
+	}
+	return true
+}
+
+// adminTargetUser parses {userID} and checks the user exists.
+func (cfg *apiConfig) adminTargetUser(w http.ResponseWriter, r *http.Request) (database.User, bool) {
+	targetID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondJSONError(w, r, http.StatusBadRequest, "Invalid user ID", err)
+		return database.User{}, false
+	}
+	target, err := cfg.DB.GetUserByID(r.Context(), targetID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondJSONError(w, r, http.StatusNotFound, "user not found", err)
+			return database.User{}, false
+		}
+		respondJSONError(w, r, http.StatusInternalServerError, "Couldn't get user", err)
+		return database.User{}, false
+	}
+	return target, true
+}
+
+func (cfg *apiConfig) setRoleHandler(w http.ResponseWriter, r *http.Request) {
+	admin, _ := userFromContext(r.Context())
+	target, ok := cfg.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+	type request struct {
+		Role string `json:"role"`
+	}
+	req := request{}
+	if !decodeJSON(w, r, &req, func(v *service.Validator) {
+		_, ok := roleRank[req.Role]
+		v.Check(ok, "role", "invalid", "unknown role")
+	}) {
+		return
+	}
+	if err := cfg.DB.SetUserRole(r.Context(), database.SetUserRoleParams{
+		ID:   target.ID,
+		Role: req.Role,
+	}); err != nil {
+		respondJSONError(w, r, http.StatusInternalServerError, "Couldn't set role", err)
+		return
+	}
+	if _, err := cfg.DB.CreateModerationAction(r.Context(), database.CreateModerationActionParams{
+		ModeratorID:  admin.ID,
+		Action:       actionSetRole,
+		TargetUserID: uuid.NullUUID{UUID: target.ID, Valid: true},
+		Note:         req.Role,
+	}); err != nil {
+		respondJSONError(w, r, http.StatusInternalServerError, "Couldn't record action", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) suspendUserHandler(w http.ResponseWriter, r *http.Request) {
+	mod, _ := userFromContext(r.Context())
+	target, ok := cfg.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+	type request struct {
+		// empty means until lifted
+		Until *time.Time `json:"until"`
+		Note  string     `json:"note"`
+	}
+	req := request{}
+	if !decodeJSON(w, r, &req, nil) {
+		return
+	}
+	if roleRank[target.Role] >= roleRank[mod.Role] {
+		respondJSONError(w, r, http.StatusForbidden, "can't suspend someone with your role or higher", nil)
+		return
+	}
+	until := sql.NullTime{}
+	if req.Until != nil {
+		until = sql.NullTime{Time: *req.Until, Valid: true}
+	}
+	if err := cfg.DB.SuspendUser(r.Context(), database.SuspendUserParams{
+		ID:             target.ID,
+		SuspendedUntil: until,
+	}); err != nil {
+		respondJSONError(w, r, http.StatusInternalServerError, "Couldn't suspend user", err)
+		return
+	}
+	if _, err := cfg.DB.CreateModerationAction(r.Context(), database.CreateModerationActionParams{
+		ModeratorID:  mod.ID,
+		Action:       actionSuspendUser,
+		TargetUserID: uuid.NullUUID{UUID: target.ID, Valid: true},
+		Note:         req.Note,
+	}); err != nil {
+		respondJSONError(w, r, http.StatusInternalServerError, "Couldn't record action", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) unsuspendUserHandler(w http.ResponseWriter, r *http.Request) {
+	mod, _ := userFromContext(r.Context())
+	target, ok := cfg.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+	if err := cfg.DB.UnsuspendUser(r.Context(), target.ID); err != nil {
+		respondJSONError(w, r, http.StatusInternalServerError, "Couldn't unsuspend user", err)
+		return
+	}
+	if _, err := cfg.DB.CreateModerationAction(r.Context(), database.CreateModerationActionParams{
+		ModeratorID:  mod.ID,
+		Action:       actionUnsuspendUser,
+		TargetUserID: uuid.NullUUID{UUID: target.ID, Valid: true},
+	}); err != nil {
+		respondJSONError(w, r, http.StatusInternalServerError, "Couldn't record action", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,9 @@
+// Package api embeds the OpenAPI document the server serves at
+// /api/openapi.json. It's written by hand, the contract test in the main
+// package keeps it honest.
+package api
+
+import _ "embed"
+
+//go:embed openapi.json
+var OpenAPI []byte
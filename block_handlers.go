@@ -0,0 +1,118 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/frankielb/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// targetUser gets the current user and the {userID} in the path, making sure
+// they are different and the target exists.
+func (cfg *apiConfig) targetUser(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, bool) {
+	userID, ok := cfg.authUserID(w, r)
+	if !ok {
+		return uuid.Nil, uuid.Nil, false
+	}
+	targetID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondJSONError(w, r, http.StatusBadRequest, "Invalid user ID", err)
+		return uuid.Nil, uuid.Nil, false
+	}
+	if targetID == userID {
+		respondJSONError(w, r, http.StatusBadRequest, "can't do that to yourself", nil)
+		return uuid.Nil, uuid.Nil, false
+	}
+	if _, err := cfg.DB.GetUserByID(r.Context(), targetID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondJSONError(w, r, http.StatusNotFound, "user not found", err)
+			return uuid.Nil, uuid.Nil, false
+		}
+		respondJSONError(w, r, http.StatusInternalServerError, "Couldn't get user", err)
+		return uuid.Nil, uuid.Nil, false
+	}
+	return userID, targetID, true
+}
+
+func (cfg *apiConfig) blockHandler(w http.ResponseWriter, r *http.Request) {
+	userID, targetID, ok := cfg.targetUser(w, r)
+	if !ok {
+		return
+	}
+	if err := cfg.DB.BlockUser(r.Context(), database.BlockUserParams{
+		BlockerID: userID,
+		BlockedID: targetID,
+	}); err != nil {
+		respondJSONError(w, r, http.StatusInternalServerError, "Couldn't block user", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) unblockHandler(w http.ResponseWriter, r *http.Request) {
+	userID, targetID, ok := cfg.targetUser(w, r)
+	if !ok {
+		return
+	}
+	if err := cfg.DB.UnblockUser(r.Context(), database.UnblockUserParams{
+		BlockerID: userID,
+		BlockedID: targetID,
+	}); err != nil {
+		respondJSONError(w, r, http.StatusInternalServerError, "Couldn't unblock user", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) muteHandler(w http.ResponseWriter, r *http.Request) {
+	userID, targetID, ok := cfg.targetUser(w, r)
+	if !ok {
+		return
+	}
+	if err := cfg.DB.MuteUser(r.Context(), database.MuteUserParams{
+		MuterID: userID,
+		MutedID: targetID,
+	}); err != nil {
+		respondJSONError(w, r, http.StatusInternalServerError, "Couldn't mute user", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) unmuteHandler(w http.ResponseWriter, r *http.Request) {
+	userID, targetID, ok := cfg.targetUser(w, r)
+	if !ok {
+		return
+	}
+	if err := cfg.DB.UnmuteUser(r.Context(), database.UnmuteUserParams{
+		MuterID: userID,
+		MutedID: targetID,
+	}); err != nil {
+		respondJSONError(w, r, http.StatusInternalServerError, "Couldn't unmute user", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// blockedWithAny reports if the user has blocked, or been blocked by, any of
+// the others.
+func (cfg *apiConfig) blockedWithAny(r *http.Request, userID uuid.UUID, others []uuid.UUID) (bool, error) {
+	for _, id := range others {
+		if id == userID {
+			continue
+		}
+		blocked, err := cfg.DB.IsBlockedEitherWay(r.Context(), database.IsBlockedEitherWayParams{
+			BlockerID: userID,
+			BlockedID: id,
+		})
+		if err != nil {
+			return false, err
+		}
+		if blocked {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -1,14 +1,11 @@
 package main
 
 import (
-	"database/sql"
-	"encoding/json"
 	"net/http"
-	"strings"
 	"time"
 
-	"github.com/frankielb/chirpy/internal/auth"
 	"github.com/frankielb/chirpy/internal/database"
+	"github.com/frankielb/chirpy/internal/service"
 	"github.com/google/uuid"
 )
 
@@ -20,16 +17,20 @@ type chirpJSON struct {
 	UserID    string    `json:"user_id"`
 }
 
+func toChirpJSON(chirp database.Chirp) chirpJSON {
+	return chirpJSON{
+		Id:        chirp.ID.String(),
+		CreatedAt: chirp.CreatedAt,
+		UpdatedAt: chirp.UpdatedAt,
+		Body:      chirp.Body,
+		UserID:    chirp.UserID.String(),
+	}
+}
+
 func (cfg *apiConfig) createChirpHandler(w http.ResponseWriter, r *http.Request) {
 	// auth
-	bearerToken, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondJSONError(w, http.StatusUnauthorized, "unauthorized: no token", err)
-		return
-	}
-	userID, err := auth.ValidateJWT(bearerToken, cfg.Secret)
-	if err != nil {
-		respondJSONError(w, http.StatusUnauthorized, "unauthorized: wrong user", err)
+	userID, ok := cfg.authUserID(w, r)
+	if !ok {
 		return
 	}
 
@@ -37,168 +38,104 @@ func (cfg *apiConfig) createChirpHandler(w http.ResponseWriter, r *http.Request)
 		Body string `json:"body"`
 		//UserID uuid.UUID `json:"user_id"`
 	}
-	// read it into struct
-	decoder := json.NewDecoder(r.Body)
+	// read it into struct, the service checks it
 	chirp := chirpIn{}
-	if err := decoder.Decode(&chirp); err != nil {
-		respondJSONError(w, http.StatusInternalServerError, "Couldn't decode chirp", err)
-		return
-	}
-
-	// too long
-	if len(chirp.Body) > 140 {
-		respondJSONError(w, http.StatusBadRequest, "Chirp is too long", nil)
+	if !decodeJSON(w, r, &chirp, nil) {
 		return
 	}
-
-	//check swearwords
-	profanes := map[string]bool{
-		"kerfuffle": true,
-		"sharbert":  true,
-		"fornax":    true,
-	}
-	words := strings.Split(chirp.Body, " ")
-	for i, word := range words {
-		lower := strings.ToLower(word)
-		if profanes[lower] {
-			words[i] = "****"
-		}
-	}
-	cleanText := strings.Join(words, " ")
-
-	// good
-	chirpOut, err := cfg.DB.CreateChirp(r.Context(), database.CreateChirpParams{
-		Body:   cleanText,
-		UserID: userID,
-	})
+	chirpOut, err := cfg.Service.CreateChirp(r.Context(), userID, chirp.Body)
 	if err != nil {
-		respondJSONError(w, http.StatusInternalServerError, "Couldn't create chirp", err)
+		respondServiceError(w, r, err)
 		return
 	}
-	response := chirpJSON{
-		Id:        chirpOut.ID.String(),
-		CreatedAt: chirpOut.CreatedAt,
-		UpdatedAt: chirpOut.UpdatedAt,
-		Body:      chirpOut.Body,
-		UserID:    chirpOut.UserID.String(),
-	}
-	respondJSON(w, http.StatusCreated, response)
+	respondJSON(w, r, http.StatusCreated, toChirpJSON(chirpOut))
 
 }
 
 func (cfg *apiConfig) getChirpsHandler(w http.ResponseWriter, r *http.Request) {
-	authorString := r.URL.Query().Get("author_id")
-	// uses different query if there was a author id
-	var chirps []database.Chirp
-	var err error
-	if authorString != "" {
-		authorID, errParse := uuid.Parse(authorString)
-		if errParse != nil {
-			respondJSONError(w, http.StatusInternalServerError, "dodgy id", err)
+	// logged in users dont see chirps from blocked or muted users
+	viewerID, ok := cfg.viewerID(w, r)
+	if !ok {
+		return
+	}
+	arg := service.ListChirpsParams{
+		ViewerID: viewerID,
+		// comes sorted by ASC default
+		Desc: r.URL.Query().Get("sort") == "desc",
+	}
+	// only one authors chirps if there was a author id
+	if authorString := r.URL.Query().Get("author_id"); authorString != "" {
+		authorID, err := uuid.Parse(authorString)
+		if err != nil {
+			respondJSONError(w, r, http.StatusBadRequest, "Invalid author ID", err)
 			return
 		}
-		chirps, err = cfg.DB.GetChirpsByUser(r.Context(), authorID)
-	} else {
-		chirps, err = cfg.DB.GetChirps(r.Context())
+		arg.AuthorID = authorID
 	}
 
+	// the etag has to go out before the body, so it comes from a cheap
+	// version of the listing rather than the chirps themselves. It's read
+	// first, a chirp landing in between only makes the etag older than the
+	// body and the next request gets a fresh one.
+	version, err := cfg.Service.ChirpsVersion(r.Context(), arg)
 	if err != nil {
-		respondJSONError(w, http.StatusInternalServerError, "Couldn't get chirps", err)
+		respondServiceError(w, r, err)
 		return
 	}
-	// comes sorted by ASC default
-	sortstring := r.URL.Query().Get("sort")
-	if sortstring == "desc" {
-		left := 0
-		right := len(chirps) - 1
-		for left < right {
-			chirps[left], chirps[right] = chirps[right], chirps[left]
-			left++
-			right--
-		}
+	// who's blocked changes the list, so caches have to key on the token
+	w.Header().Set("Vary", "Authorization")
+	if notModified(w, r, listETag(arg.Desc, version)) {
+		return
 	}
 
-	responses := []chirpJSON{}
-	for _, chirp := range chirps {
-		response := chirpJSON{
-			Id:        chirp.ID.String(),
-			CreatedAt: chirp.CreatedAt,
-			UpdatedAt: chirp.UpdatedAt,
-			Body:      chirp.Body,
-			UserID:    chirp.UserID.String(),
-		}
-		responses = append(responses, response)
-	}
-	respondJSON(w, http.StatusOK, responses)
+	respondJSONArray(w, r, http.StatusOK, "Couldn't get chirps", func(add func(any) error) error {
+		return cfg.Service.EachChirp(r.Context(), arg, func(chirp database.Chirp) error {
+			return add(toChirpJSON(chirp))
+		})
+	})
 }
 
 func (cfg *apiConfig) getChirpHandler(w http.ResponseWriter, r *http.Request) {
 	chirpIDString := r.PathValue("chirpID")
 	chirpID, err := uuid.Parse(chirpIDString)
 	if err != nil {
-		respondJSONError(w, http.StatusBadRequest, "Invalid chirp ID", err)
+		respondJSONError(w, r, http.StatusBadRequest, "Invalid chirp ID", err)
 		return
 	}
-	chirp, err := cfg.DB.GetChirp(r.Context(), chirpID)
+	chirp, err := cfg.Service.GetChirp(r.Context(), chirpID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			respondJSONError(w, http.StatusNotFound, "Chirp not found", err)
-			return
-		}
-		respondJSONError(w, http.StatusInternalServerError, "Internal server error", err)
+		respondServiceError(w, r, err)
 		return
 	}
-	response := chirpJSON{
-		Id:        chirp.ID.String(),
-		CreatedAt: chirp.CreatedAt,
-		UpdatedAt: chirp.UpdatedAt,
-		Body:      chirp.Body,
-		UserID:    chirp.UserID.String(),
+	if notModified(w, r, chirpETag(chirp.ID, chirp.UpdatedAt)) {
+		return
 	}
-	respondJSON(w, http.StatusOK, response)
+	respondJSON(w, r, http.StatusOK, toChirpJSON(chirp))
 
 }
 
 func (cfg *apiConfig) deleteChirpHandler(w http.ResponseWriter, r *http.Request) {
-	// get the chirp from DB via path
+	// get the chirp id via path
 	chirpIDString := r.PathValue("chirpID")
 	chirpID, err := uuid.Parse(chirpIDString)
 	if err != nil {
-		respondJSONError(w, http.StatusBadRequest, "Invalid chirp ID", err)
-		return
-	}
-
-	chirp, err := cfg.DB.GetChirp(r.Context(), chirpID)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			respondJSONError(w, http.StatusNotFound, "Chirp not found", err)
-			return
-		}
-		respondJSONError(w, http.StatusInternalServerError, "Internal server error", err)
+		respondJSONError(w, r, http.StatusBadRequest, "Invalid chirp ID", err)
 		return
 	}
-
 	// find user via jwt
-	refreshToken, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondJSONError(w, http.StatusUnauthorized, "couldn't find bearer token", err)
-		return
-	}
-	tokenID, err := auth.ValidateJWT(refreshToken, cfg.Secret)
-	if err != nil {
-		respondJSONError(w, http.StatusUnauthorized, "bad token", err)
-		return
-	}
-	if tokenID != chirp.UserID {
-		respondJSONError(w, http.StatusForbidden, "unauthorized", err)
+	userID, ok := cfg.authUserID(w, r)
+	if !ok {
 		return
 	}
 
-	// delete the chirp
-	if err := cfg.DB.DeleteChirpByID(r.Context(), chirpID); err != nil {
-		respondJSONError(w, http.StatusInternalServerError, "couldn't delete chirp", err)
+	// someone else may have changed it since this client last saw it
+	err = cfg.Service.DeleteChirp(r.Context(), userID, chirpID, func(chirp database.Chirp) bool {
+		return ifMatch(r, chirpETag(chirp.ID, chirp.UpdatedAt))
+	})
+	if err != nil {
+		respondServiceError(w, r, err)
 		return
 	}
-	respondJSON(w, http.StatusNoContent, nil)
+	w.WriteHeader(http.StatusNoContent)
 
 }
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/frankielb/chirpy/internal/auth"
+	"github.com/frankielb/chirpy/internal/database"
+	"github.com/frankielb/chirpy/internal/service"
+	"github.com/frankielb/chirpy/internal/store"
+	"github.com/google/uuid"
+)
+
+const adminUsage = `usage:
+  chirpy [serve]
+  chirpy migrate up|down|status
+  chirpy users list
+  chirpy users create [-role user|moderator|admin] <email> <password>
+  chirpy users promote [-role moderator|admin] <user>
+  chirpy users suspend [-for 24h] [-note text] <user>
+  chirpy chirps delete <chirpID>
+  chirpy tokens revoke-all -user <user>
+  chirpy red grant|revoke <user>
+
+<user> is an email or a user id.`
+
+var errUsage = errors.New(adminUsage)
+
+// runAdmin is the operator subcommands. They go through the same store as
+// the handlers so nobody has to write sql by hand to fix data.
+func runAdmin(ctx context.Context, db store.Store, args []string, out io.Writer) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+	cmd, sub, rest := args[0], args[1], args[2:]
+	switch cmd + " " + sub {
+	case "users list":
+		return listUsersCmd(ctx, db, out)
+	case "users create":
+		return createUserCmd(ctx, db, rest, out)
+	case "users promote":
+		return promoteUserCmd(ctx, db, rest, out)
+	case "users suspend":
+		return suspendUserCmd(ctx, db, rest, out)
+	case "chirps delete":
+		return deleteChirpCmd(ctx, db, rest, out)
+	case "tokens revoke-all":
+		return revokeAllTokensCmd(ctx, db, rest, out)
+	case "red grant", "red revoke":
+		return redCmd(ctx, db, sub == "grant", rest, out)
+	}
+	return errUsage
+}
+
+// lookupUser finds a user by id or email.
+func lookupUser(ctx context.Context, db store.Store, ref string) (database.User, error) {
+	var user database.User
+	var err error
+	if id, parseErr := uuid.Parse(ref); parseErr == nil {
+		user, err = db.GetUserByID(ctx, id)
+	} else {
+		user, err = db.GetUserByEmail(ctx, ref)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return user, fmt.Errorf("no user %q", ref)
+	}
+	return user, err
+}
+
+// parseArgs parses the flags then checks the right number of args are left.
+func parseArgs(fs *flag.FlagSet, args []string, n int) ([]string, error) {
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse(args); err != nil {
+		return nil, errUsage
+	}
+	if fs.NArg() != n {
+		return nil, errUsage
+	}
+	return fs.Args(), nil
+}
+
+func listUsersCmd(ctx context.Context, db store.Store, out io.Writer) error {
+	users, err := db.ListUsers(ctx)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tEMAIL\tROLE\tRED\tSUSPENDED\tCREATED")
+	for _, u := range users {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%t\t%t\t%s\n",
+			u.ID, u.Email, u.Role, u.IsChirpyRed, service.IsSuspended(u), u.CreatedAt.Format(time.DateTime))
+	}
+	return tw.Flush()
+}
+
+func createUserCmd(ctx context.Context, db store.Store, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("users create", flag.ContinueOnError)
+	role := fs.String("role", roleUser, "role for the new user")
+	args, err := parseArgs(fs, args, 2)
+	if err != nil {
+		return err
+	}
+	if _, ok := roleRank[*role]; !ok {
+		return fmt.Errorf("unknown role %q", *role)
+	}
+	hashed, err := auth.HashPassword(args[1])
+	if err != nil {
+		return err
+	}
+	user, err := db.CreateUser(ctx, database.CreateUserParams{
+		Email:          args[0],
+		HashedPassword: hashed,
+	})
+	if err != nil {
+		if store.IsUniqueViolation(err) {
+			return fmt.Errorf("email %q is taken", args[0])
+		}
+		return err
+	}
+	if *role != roleUser {
+		if err := db.SetUserRole(ctx, database.SetUserRoleParams{ID: user.ID, Role: *role}); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintln(out, user.ID)
+	return nil
+}
+
+func promoteUserCmd(ctx context.Context, db store.Store, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("users promote", flag.ContinueOnError)
+	role := fs.String("role", roleAdmin, "role to give the user")
+	args, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	if _, ok := roleRank[*role]; !ok {
+		return fmt.Errorf("unknown role %q", *role)
+	}
+	user, err := lookupUser(ctx, db, args[0])
+	if err != nil {
+		return err
+	}
+	if err := db.SetUserRole(ctx, database.SetUserRoleParams{ID: user.ID, Role: *role}); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%s is now %s\n", user.Email, *role)
+	return nil
+}
+
+func suspendUserCmd(ctx context.Context, db store.Store, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("users suspend", flag.ContinueOnError)
+	length := fs.Duration("for", 0, "how long for, 0 means until lifted")
+	note := fs.String("note", "", "note for the moderation log")
+	args, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	user, err := lookupUser(ctx, db, args[0])
+	if err != nil {
+		return err
+	}
+	until := sql.NullTime{}
+	if *length > 0 {
+		until = sql.NullTime{Time: time.Now().Add(*length), Valid: true}
+	}
+	if err := db.SuspendUser(ctx, database.SuspendUserParams{
+		ID:             user.ID,
+		SuspendedUntil: until,
+	}); err != nil {
+		return err
+	}
+	// no moderator behind a cli action, uuid.Nil marks it in the log
+	if _, err := db.CreateModerationAction(ctx, database.CreateModerationActionParams{
+		ModeratorID:  uuid.Nil,
+		Action:       actionSuspendUser,
+		TargetUserID: uuid.NullUUID{UUID: user.ID, Valid: true},
+		Note:         *note,
+	}); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "suspended %s\n", user.Email)
+	return nil
+}
+
+func deleteChirpCmd(ctx context.Context, db store.Store, args []string, out io.Writer) error {
+	args, err := parseArgs(flag.NewFlagSet("chirps delete", flag.ContinueOnError), args, 1)
+	if err != nil {
+		return err
+	}
+	chirpID, err := uuid.Parse(args[0])
+	if err != nil {
+		return fmt.Errorf("bad chirp id: %w", err)
+	}
+	if _, err := db.GetChirp(ctx, chirpID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("no chirp %s", chirpID)
+		}
+		return err
+	}
+	if err := db.DeleteChirpByID(ctx, chirpID); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "deleted chirp %s\n", chirpID)
+	return nil
+}
+
+func revokeAllTokensCmd(ctx context.Context, db store.Store, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("tokens revoke-all", flag.ContinueOnError)
+	ref := fs.String("user", "", "user to log out everywhere")
+	if _, err := parseArgs(fs, args, 0); err != nil || *ref == "" {
+		return errUsage
+	}
+	user, err := lookupUser(ctx, db, *ref)
+	if err != nil {
+		return err
+	}
+	if err := db.RevokeAllUserTokens(ctx, user.ID); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "revoked refresh tokens for %s\n", user.Email)
+	return nil
+}
+
+func redCmd(ctx context.Context, db store.Store, grant bool, args []string, out io.Writer) error {
+	args, err := parseArgs(flag.NewFlagSet("red", flag.ContinueOnError), args, 1)
+	if err != nil {
+		return err
+	}
+	user, err := lookupUser(ctx, db, args[0])
+	if err != nil {
+		return err
+	}
+	if grant {
+		err = db.UpgradeRedByID(ctx, user.ID)
+	} else {
+		err = db.DowngradeRedByID(ctx, user.ID)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%s chirpy red: %t\n", user.Email, grant)
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/frankielb/chirpy/internal/database"
+	"github.com/frankielb/chirpy/internal/service"
+	"github.com/frankielb/chirpy/internal/store"
+)
+
+func TestAdminCLI(t *testing.T) {
+	ctx := context.Background()
+	db := store.NewMemory()
+	run := func(args ...string) string {
+		t.Helper()
+		var out strings.Builder
+		if err := runAdmin(ctx, db, args, &out); err != nil {
+			t.Fatalf("%v: %v", args, err)
+		}
+		return out.String()
+	}
+
+	id := strings.TrimSpace(run("users", "create", "-role", "moderator", "mod@example.com", "pw"))
+	run("users", "promote", id)
+	run("users", "suspend", "-for", "1h", "mod@example.com")
+	run("red", "grant", "mod@example.com")
+
+	user, err := db.GetUserByEmail(ctx, "mod@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID.String() != id || user.Role != roleAdmin || !service.IsSuspended(user) || !user.IsChirpyRed {
+		t.Fatalf("user = %+v", user)
+	}
+	if list := run("users", "list"); !strings.Contains(list, "mod@example.com") {
+		t.Fatalf("users list = %q", list)
+	}
+
+	run("red", "revoke", id)
+	chirp, err := db.CreateChirp(ctx, database.CreateChirpParams{Body: "hello", UserID: user.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	run("chirps", "delete", chirp.ID.String())
+	if _, err := db.GetChirp(ctx, chirp.ID); err == nil {
+		t.Fatal("chirp not deleted")
+	}
+
+	if _, err := db.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{Token: "tok", UserID: user.ID}); err != nil {
+		t.Fatal(err)
+	}
+	run("tokens", "revoke-all", "-user", "mod@example.com")
+	if tok, _ := db.GetRefreshTokenFromToken(ctx, "tok"); !tok.RevokedAt.Valid {
+		t.Fatal("token not revoked")
+	}
+
+	var out strings.Builder
+	for _, args := range [][]string{
+		{"users"},
+		{"users", "promote"},
+		{"tokens", "revoke-all"},
+		{"users", "create", "-role", "king", "x@example.com", "pw"},
+		{"users", "promote", "nobody@example.com"},
+	} {
+		if err := runAdmin(ctx, db, args, &out); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+	if err := runAdmin(ctx, db, []string{"chirps"}, &out); !errors.Is(err, errUsage) {
+		t.Errorf("got %v, want usage", err)
+	}
+}
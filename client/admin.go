@@ -0,0 +1,176 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Reports is the moderation queue, oldest first. status is one of the
+// Report constants, empty means open. Moderators and admins only.
+func (c *Client) Reports(ctx context.Context, status string) ([]Report, error) {
+	q := url.Values{}
+	if status != "" {
+		q.Set("status", status)
+	}
+	var reports []Report
+	err := c.do(ctx, request{
+		method: http.MethodGet,
+		path:   "/admin/reports",
+		query:  q,
+		auth:   authAccess,
+		out:    &reports,
+	})
+	return reports, err
+}
+
+func (c *Client) ClaimReport(ctx context.Context, id uuid.UUID) (Report, error) {
+	var report Report
+	err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/admin/reports/" + id.String() + "/claim",
+		auth:   authAccess,
+		out:    &report,
+	})
+	return report, err
+}
+
+// ResolveReport takes any action but ActionDeleteChirp, which removes the
+// report along with the chirp; use DeleteReportedChirp for that.
+func (c *Client) ResolveReport(ctx context.Context, id uuid.UUID, res Resolution) (Report, error) {
+	var report Report
+	err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/admin/reports/" + id.String() + "/resolve",
+		auth:   authAccess,
+		body:   res,
+		out:    &report,
+	})
+	return report, err
+}
+
+// DeleteReportedChirp resolves a report by deleting its chirp. The report
+// goes with it, so what comes back is the audit log entry.
+func (c *Client) DeleteReportedChirp(ctx context.Context, id uuid.UUID, note string) (ModerationAction, error) {
+	var action ModerationAction
+	err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/admin/reports/" + id.String() + "/resolve",
+		auth:   authAccess,
+		body:   Resolution{Action: ActionDeleteChirp, Note: note},
+		out:    &action,
+	})
+	return action, err
+}
+
+// ModerationActions is the newest limit entries of the audit log, 0 for
+// the server's default.
+func (c *Client) ModerationActions(ctx context.Context, limit int) ([]ModerationAction, error) {
+	q := url.Values{}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	var actions []ModerationAction
+	err := c.do(ctx, request{
+		method: http.MethodGet,
+		path:   "/admin/moderation/actions",
+		query:  q,
+		auth:   authAccess,
+		out:    &actions,
+	})
+	return actions, err
+}
+
+// SetRole is admins only, role is one of the Role constants.
+func (c *Client) SetRole(ctx context.Context, userID uuid.UUID, role string) error {
+	return c.do(ctx, request{
+		method: http.MethodPut,
+		path:   "/admin/users/" + userID.String() + "/role",
+		auth:   authAccess,
+		body:   map[string]string{"role": role},
+	})
+}
+
+// SuspendUser suspends until the given time, or until lifted if it's zero.
+func (c *Client) SuspendUser(ctx context.Context, userID uuid.UUID, until time.Time, note string) error {
+	body := struct {
+		Until *time.Time `json:"until,omitempty"`
+		Note  string     `json:"note,omitempty"`
+	}{Note: note}
+	if !until.IsZero() {
+		body.Until = &until
+	}
+	return c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/admin/users/" + userID.String() + "/suspend",
+		auth:   authAccess,
+		body:   body,
+	})
+}
+
+func (c *Client) UnsuspendUser(ctx context.Context, userID uuid.UUID) error {
+	return c.do(ctx, request{
+		method: http.MethodDelete,
+		path:   "/admin/users/" + userID.String() + "/suspend",
+		auth:   authAccess,
+	})
+}
+
+// Hits is the admin fileserver hits page, as html.
+func (c *Client) Hits(ctx context.Context) (string, error) {
+	var page string
+	err := c.do(ctx, request{
+		method: http.MethodGet,
+		path:   "/admin/metrics",
+		auth:   authAccess,
+		text:   &page,
+	})
+	return page, err
+}
+
+// Reset deletes every user, only works against a dev server.
+func (c *Client) Reset(ctx context.Context) error {
+	return c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/admin/reset",
+		auth:   authAccess,
+		text:   new(string),
+	})
+}
+
+// Live is nil if the server is up.
+func (c *Client) Live(ctx context.Context) error {
+	return c.do(ctx, request{
+		method: http.MethodGet,
+		path:   "/api/livez",
+		text:   new(string),
+	})
+}
+
+// Ready runs the server's readiness checks. Failing checks aren't an
+// error, look at the report's Status.
+func (c *Client) Ready(ctx context.Context) (HealthReport, error) {
+	var report HealthReport
+	err := c.do(ctx, request{
+		method: http.MethodGet,
+		path:   "/api/readyz",
+		out:    &report,
+		accept: []int{http.StatusServiceUnavailable},
+	})
+	return report, err
+}
+
+// OpenAPI is the server's openapi document.
+func (c *Client) OpenAPI(ctx context.Context) ([]byte, error) {
+	var doc string
+	err := c.do(ctx, request{
+		method: http.MethodGet,
+		path:   "/api/openapi.json",
+		text:   &doc,
+	})
+	return []byte(doc), err
+}
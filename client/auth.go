@@ -0,0 +1,97 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+type credentials struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// CreateUser signs up, it doesn't log in.
+func (c *Client) CreateUser(ctx context.Context, email, password string) (User, error) {
+	var user User
+	err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/api/users",
+		body:   credentials{email, password},
+		out:    &user,
+	})
+	return user, err
+}
+
+// Login keeps the tokens for every call after it.
+func (c *Client) Login(ctx context.Context, email, password string) (User, error) {
+	var resp struct {
+		User
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/api/login",
+		body:   credentials{email, password},
+		out:    &resp,
+	}); err != nil {
+		return User{}, err
+	}
+	c.setTokens(resp.Token, resp.RefreshToken)
+	return resp.User, nil
+}
+
+// Refresh gets a new access token now. Calls do this themselves when the
+// access token runs out, so it's rarely needed.
+func (c *Client) Refresh(ctx context.Context) error {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+	return c.refreshLocked(ctx)
+}
+
+func (c *Client) refreshLocked(ctx context.Context) error {
+	if !c.hasRefresh() {
+		return ErrNotLoggedIn
+	}
+	var resp struct {
+		Token string `json:"token"`
+	}
+	if err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/api/refresh",
+		auth:   authRefresh,
+		out:    &resp,
+	}); err != nil {
+		return err
+	}
+	c.setTokens(resp.Token, "")
+	return nil
+}
+
+// Logout revokes the refresh token and forgets both tokens.
+func (c *Client) Logout(ctx context.Context) error {
+	if err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/api/revoke",
+		auth:   authRefresh,
+	}); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.access, c.refresh = "", ""
+	c.mu.Unlock()
+	return nil
+}
+
+// UpdateUser changes the logged in user's email and password.
+func (c *Client) UpdateUser(ctx context.Context, email, password string) (User, error) {
+	var user User
+	err := c.do(ctx, request{
+		method: http.MethodPut,
+		path:   "/api/users",
+		auth:   authAccess,
+		body:   credentials{email, password},
+		out:    &user,
+	})
+	return user, err
+}
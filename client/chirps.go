@@ -0,0 +1,128 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/google/uuid"
+)
+
+// ChirpsOptions filters and orders ListChirps, the zero value is everything
+// oldest first.
+type ChirpsOptions struct {
+	AuthorID uuid.UUID
+	// newest first
+	Desc bool
+}
+
+func (c *Client) CreateChirp(ctx context.Context, body string) (Chirp, error) {
+	var chirp Chirp
+	err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/api/chirps",
+		auth:   authAccess,
+		body:   map[string]string{"body": body},
+		out:    &chirp,
+	})
+	return chirp, err
+}
+
+// ListChirps works logged out too, logged in it hides blocked and muted
+// users.
+func (c *Client) ListChirps(ctx context.Context, opts ChirpsOptions) ([]Chirp, error) {
+	q := url.Values{}
+	if opts.AuthorID != uuid.Nil {
+		q.Set("author_id", opts.AuthorID.String())
+	}
+	if opts.Desc {
+		q.Set("sort", "desc")
+	}
+	var chirps []Chirp
+	err := c.do(ctx, request{
+		method: http.MethodGet,
+		path:   "/api/chirps",
+		query:  q,
+		auth:   c.optionalAuth(),
+		out:    &chirps,
+	})
+	return chirps, err
+}
+
+func (c *Client) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	var chirp Chirp
+	err := c.do(ctx, request{
+		method: http.MethodGet,
+		path:   "/api/chirps/" + id.String(),
+		out:    &chirp,
+	})
+	return chirp, err
+}
+
+func (c *Client) DeleteChirp(ctx context.Context, id uuid.UUID) error {
+	return c.do(ctx, request{
+		method: http.MethodDelete,
+		path:   "/api/chirps/" + id.String(),
+		auth:   authAccess,
+	})
+}
+
+// ReportChirp sends a chirp to the moderators, reason is one of the
+// Reason constants.
+func (c *Client) ReportChirp(ctx context.Context, id uuid.UUID, reason, details string) (Report, error) {
+	var report Report
+	err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/api/chirps/" + id.String() + "/reports",
+		auth:   authAccess,
+		body:   map[string]string{"reason": reason, "details": details},
+		out:    &report,
+	})
+	return report, err
+}
+
+func (c *Client) BlockUser(ctx context.Context, id uuid.UUID) error {
+	return c.userAction(ctx, http.MethodPost, id, "block")
+}
+
+func (c *Client) UnblockUser(ctx context.Context, id uuid.UUID) error {
+	return c.userAction(ctx, http.MethodDelete, id, "block")
+}
+
+func (c *Client) MuteUser(ctx context.Context, id uuid.UUID) error {
+	return c.userAction(ctx, http.MethodPost, id, "mute")
+}
+
+func (c *Client) UnmuteUser(ctx context.Context, id uuid.UUID) error {
+	return c.userAction(ctx, http.MethodDelete, id, "mute")
+}
+
+func (c *Client) userAction(ctx context.Context, method string, id uuid.UUID, action string) error {
+	return c.do(ctx, request{
+		method: method,
+		path:   "/api/users/" + id.String() + "/" + action,
+		auth:   authAccess,
+	})
+}
+
+// PolkaWebhook is what polka sends when someone pays, it needs
+// WithPolkaKey. It's here for testing against a local server.
+func (c *Client) PolkaWebhook(ctx context.Context, event string, userID uuid.UUID) error {
+	return c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/api/polka/webhooks",
+		auth:   authPolka,
+		body: map[string]any{
+			"event": event,
+			"data":  map[string]uuid.UUID{"user_id": userID},
+		},
+	})
+}
+
+// optionalAuth sends the access token if there is one.
+func (c *Client) optionalAuth() auth {
+	if access, refresh := c.Tokens(); access == "" && refresh == "" {
+		return authNone
+	}
+	return authAccess
+}
@@ -0,0 +1,262 @@
+// Package client is a Go client for the chirpy api. It keeps the tokens
+// from Login and swaps in a new access token through /api/refresh whenever
+// the old one expires, so callers only log in once.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// refresh this long before the access token actually runs out
+const expirySlack = 30 * time.Second
+
+type Client struct {
+	baseURL string
+	http    *http.Client
+	polka   string
+
+	mu      sync.Mutex
+	access  string
+	refresh string
+	// called with the new tokens after Login or a refresh
+	onTokens func(access, refresh string)
+	// one refresh at a time, the rest wait and use its token
+	refreshMu sync.Mutex
+}
+
+type Option func(*Client)
+
+// WithHTTPClient swaps out http.DefaultClient.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.http = hc }
+}
+
+// WithTokens starts with tokens from an earlier Login, eg saved to disk.
+func WithTokens(access, refresh string) Option {
+	return func(c *Client) { c.access, c.refresh = access, refresh }
+}
+
+// WithTokenHook is told about new tokens so they can be saved.
+func WithTokenHook(fn func(access, refresh string)) Option {
+	return func(c *Client) { c.onTokens = fn }
+}
+
+// WithPolkaKey sets the api key for PolkaWebhook, only polka needs it.
+func WithPolkaKey(key string) Option {
+	return func(c *Client) { c.polka = key }
+}
+
+// New makes a client for the server at baseURL, eg "http://localhost:8080".
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		http:    http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Tokens are the current access and refresh tokens.
+func (c *Client) Tokens() (access, refresh string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.access, c.refresh
+}
+
+func (c *Client) setTokens(access, refresh string) {
+	c.mu.Lock()
+	c.access = access
+	if refresh != "" {
+		c.refresh = refresh
+	}
+	access, refresh, hook := c.access, c.refresh, c.onTokens
+	c.mu.Unlock()
+	if hook != nil {
+		hook(access, refresh)
+	}
+}
+
+// auth says what goes in the Authorization header.
+type auth int
+
+const (
+	authNone auth = iota
+	authAccess
+	authRefresh
+	authPolka
+)
+
+// request is one call to the api.
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	auth   auth
+	body   any
+	// decoded from a json response if not nil
+	out any
+	// plain text responses go here instead
+	text *string
+	// error statuses that still have a normal body for out
+	accept []int
+	// sent as Idempotency-Key so a resend can't do it twice
+	idempotencyKey string
+}
+
+func (c *Client) do(ctx context.Context, req request) error {
+	if req.auth == authAccess {
+		if err := c.ensureFresh(ctx); err != nil {
+			return err
+		}
+	}
+	// the server replays the first response to a resend with the same key
+	if req.auth == authAccess && req.method != http.MethodGet {
+		req.idempotencyKey = uuid.NewString()
+	}
+	used, _ := c.Tokens()
+	status, err := c.send(ctx, req)
+	// the connection dropped, with a key it's safe to go again
+	var urlErr *url.Error
+	if req.idempotencyKey != "" && status == 0 && errors.As(err, &urlErr) && ctx.Err() == nil {
+		status, err = c.send(ctx, req)
+	}
+	// the clocks might disagree about expiry, one retry with a new token
+	if status == http.StatusUnauthorized && req.auth == authAccess && c.hasRefresh() {
+		if rErr := c.refreshIfStale(ctx, used); rErr != nil {
+			return err
+		}
+		_, err = c.send(ctx, req)
+	}
+	return err
+}
+
+func (c *Client) send(ctx context.Context, req request) (int, error) {
+	var body io.Reader
+	if req.body != nil {
+		b, err := json.Marshal(req.body)
+		if err != nil {
+			return 0, fmt.Errorf("chirpy: encoding request: %w", err)
+		}
+		body = bytes.NewReader(b)
+	}
+	u := c.baseURL + req.path
+	if len(req.query) > 0 {
+		u += "?" + req.query.Encode()
+	}
+	hreq, err := http.NewRequestWithContext(ctx, req.method, u, body)
+	if err != nil {
+		return 0, fmt.Errorf("chirpy: %w", err)
+	}
+	if req.body != nil {
+		hreq.Header.Set("Content-Type", "application/json")
+	}
+	hreq.Header.Set("Accept", "application/json")
+	if req.idempotencyKey != "" {
+		hreq.Header.Set("Idempotency-Key", req.idempotencyKey)
+	}
+	access, refresh := c.Tokens()
+	switch req.auth {
+	case authAccess:
+		hreq.Header.Set("Authorization", "Bearer "+access)
+	case authRefresh:
+		hreq.Header.Set("Authorization", "Bearer "+refresh)
+	case authPolka:
+		hreq.Header.Set("Authorization", "ApiKey "+c.polka)
+	}
+
+	resp, err := c.http.Do(hreq)
+	if err != nil {
+		return 0, fmt.Errorf("chirpy: %s %s: %w", req.method, req.path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 && !slices.Contains(req.accept, resp.StatusCode) {
+		return resp.StatusCode, decodeError(resp)
+	}
+	switch {
+	case req.out != nil:
+		if err := json.NewDecoder(resp.Body).Decode(req.out); err != nil {
+			return resp.StatusCode, fmt.Errorf("chirpy: decoding %s %s: %w", req.method, req.path, err)
+		}
+	case req.text != nil:
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return resp.StatusCode, fmt.Errorf("chirpy: %w", err)
+		}
+		*req.text = string(b)
+	}
+	return resp.StatusCode, nil
+}
+
+func (c *Client) hasRefresh() bool {
+	_, refresh := c.Tokens()
+	return refresh != ""
+}
+
+// ensureFresh refreshes the access token first if it's about to run out.
+func (c *Client) ensureFresh(ctx context.Context) error {
+	access, refresh := c.Tokens()
+	if access == "" && refresh == "" {
+		return ErrNotLoggedIn
+	}
+	if refresh == "" || !expiring(access) {
+		return nil
+	}
+	return c.refreshIfStale(ctx, access)
+}
+
+// refreshIfStale refreshes unless another call already replaced the stale
+// token while we waited for the lock.
+func (c *Client) refreshIfStale(ctx context.Context, stale string) error {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+	if access, _ := c.Tokens(); access != stale && !expiring(access) {
+		return nil
+	}
+	return c.refreshLocked(ctx)
+}
+
+// expiring is true when the token is missing or runs out within
+// expirySlack. Tokens without an exp are left for the server to judge.
+func expiring(access string) bool {
+	if access == "" {
+		return true
+	}
+	exp, ok := tokenExpiry(access)
+	return ok && time.Until(exp) < expirySlack
+}
+
+// tokenExpiry reads exp out of a jwt without checking the signature, the
+// server does that. ok is false if there's no exp to read.
+func tokenExpiry(token string) (time.Time, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}, false
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(claims.Exp, 0), true
+}
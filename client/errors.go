@@ -0,0 +1,93 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Match these with errors.Is, eg errors.Is(err, client.ErrNotFound).
+var (
+	ErrNotLoggedIn  = errors.New("chirpy: not logged in")
+	ErrBadRequest   = errors.New("chirpy: bad request")
+	ErrUnauthorized = errors.New("chirpy: unauthorized")
+	ErrForbidden    = errors.New("chirpy: forbidden")
+	ErrNotFound     = errors.New("chirpy: not found")
+	ErrConflict     = errors.New("chirpy: conflict")
+	ErrTooLarge     = errors.New("chirpy: request too large")
+	ErrValidation   = errors.New("chirpy: validation failed")
+	ErrRateLimited  = errors.New("chirpy: rate limited")
+	ErrServer       = errors.New("chirpy: server error")
+)
+
+var statusErrors = map[int]error{
+	http.StatusBadRequest:            ErrBadRequest,
+	http.StatusUnauthorized:          ErrUnauthorized,
+	http.StatusForbidden:             ErrForbidden,
+	http.StatusNotFound:              ErrNotFound,
+	http.StatusConflict:              ErrConflict,
+	http.StatusRequestEntityTooLarge: ErrTooLarge,
+	http.StatusUnprocessableEntity:   ErrValidation,
+	http.StatusTooManyRequests:       ErrRateLimited,
+}
+
+// FieldError is one bad field in a request the server rejected.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error is an error response from the server, from its problem+json body.
+type Error struct {
+	Status    int          `json:"status"`
+	Code      string       `json:"code"`
+	Title     string       `json:"title"`
+	Detail    string       `json:"detail"`
+	RequestID string       `json:"request_id"`
+	Fields    []FieldError `json:"errors"`
+	// from Retry-After on a 429 or 503, zero if it wasn't sent
+	RetryAfter time.Duration `json:"-"`
+}
+
+func (e *Error) Error() string {
+	msg := e.Detail
+	if msg == "" {
+		msg = e.Title
+	}
+	return fmt.Sprintf("chirpy: %d %s: %s", e.Status, e.Code, msg)
+}
+
+// Is matches the Err sentinels by status.
+func (e *Error) Is(target error) bool {
+	if target == ErrServer {
+		return e.Status >= 500
+	}
+	return statusErrors[e.Status] == target
+}
+
+func decodeError(resp *http.Response) error {
+	e := &Error{
+		Status: resp.StatusCode,
+		Title:  http.StatusText(resp.StatusCode),
+	}
+	if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+		e.RetryAfter = time.Duration(secs) * time.Second
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if strings.HasSuffix(mt, "json") && json.Unmarshal(body, e) == nil {
+		e.Status = resp.StatusCode
+		return e
+	}
+	// not one of ours, eg a proxy or the mux's own 404
+	e.Code = strings.ReplaceAll(strings.ToLower(e.Title), " ", "_")
+	e.Detail = strings.TrimSpace(string(body))
+	return e
+}
@@ -0,0 +1,107 @@
+package client
+
+import (
+	"context"
+	"iter"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CreateConversation starts a conversation with the given users, or gives
+// back the existing one for a one to one.
+func (c *Client) CreateConversation(ctx context.Context, memberIDs ...uuid.UUID) (Conversation, error) {
+	var convo Conversation
+	err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/api/conversations",
+		auth:   authAccess,
+		body:   map[string][]uuid.UUID{"member_ids": memberIDs},
+		out:    &convo,
+	})
+	return convo, err
+}
+
+func (c *Client) ListConversations(ctx context.Context) ([]Conversation, error) {
+	var convos []Conversation
+	err := c.do(ctx, request{
+		method: http.MethodGet,
+		path:   "/api/conversations",
+		auth:   authAccess,
+		out:    &convos,
+	})
+	return convos, err
+}
+
+func (c *Client) SendMessage(ctx context.Context, conversationID uuid.UUID, body string) (Message, error) {
+	var msg Message
+	err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/api/conversations/" + conversationID.String() + "/messages",
+		auth:   authAccess,
+		body:   map[string]string{"body": body},
+		out:    &msg,
+	})
+	return msg, err
+}
+
+// MessagesPage is one page of messages, newest first, from before the
+// message before, the last one of the previous page. A zero before is from
+// now, a zero limit is the server's default.
+func (c *Client) MessagesPage(ctx context.Context, conversationID uuid.UUID, before Message, limit int) ([]Message, error) {
+	q := url.Values{}
+	if !before.CreatedAt.IsZero() {
+		q.Set("before", before.CreatedAt.Format(time.RFC3339Nano))
+		q.Set("before_id", before.ID.String())
+	}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	var msgs []Message
+	err := c.do(ctx, request{
+		method: http.MethodGet,
+		path:   "/api/conversations/" + conversationID.String() + "/messages",
+		query:  q,
+		auth:   authAccess,
+		out:    &msgs,
+	})
+	return msgs, err
+}
+
+// Messages goes back through the whole conversation, newest first,
+// fetching pageSize at a time. It stops at the first error.
+//
+//	for msg, err := range c.Messages(ctx, id, 50) { ... }
+func (c *Client) Messages(ctx context.Context, conversationID uuid.UUID, pageSize int) iter.Seq2[Message, error] {
+	return func(yield func(Message, error) bool) {
+		var before Message
+		for {
+			page, err := c.MessagesPage(ctx, conversationID, before, pageSize)
+			if err != nil {
+				yield(Message{}, err)
+				return
+			}
+			for _, msg := range page {
+				if !yield(msg, nil) {
+					return
+				}
+			}
+			// a short page is the last one
+			if len(page) == 0 || (pageSize > 0 && len(page) < pageSize) {
+				return
+			}
+			before = page[len(page)-1]
+		}
+	}
+}
+
+func (c *Client) MarkRead(ctx context.Context, conversationID uuid.UUID) error {
+	return c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/api/conversations/" + conversationID.String() + "/read",
+		auth:   authAccess,
+	})
+}
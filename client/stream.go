@@ -0,0 +1,124 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// event types the server sends
+const (
+	EventChirpCreated      = "chirp.created"
+	EventChirpDeleted      = "chirp.deleted"
+	EventUserUpgraded      = "user.upgraded"
+	EventMessageCreated    = "message.created"
+	EventModerationWarning = "moderation.warning"
+	EventSubscribed        = "subscribed"
+	EventUnsubscribed      = "unsubscribed"
+	EventError             = "error"
+)
+
+// AuthorTopic gets every chirp from one user.
+func AuthorTopic(id uuid.UUID) string { return "author:" + id.String() }
+
+// HashtagTopic gets every chirp with #tag in it.
+func HashtagTopic(tag string) string {
+	return "hashtag:" + strings.ToLower(strings.TrimPrefix(tag, "#"))
+}
+
+// Event is one message off the realtime socket.
+type Event struct {
+	Type   string          `json:"type"`
+	Topic  string          `json:"topic,omitempty"`
+	Topics []string        `json:"topics,omitempty"`
+	Data   json.RawMessage `json:"data,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// Chirp decodes the data of a chirp.created or chirp.deleted event.
+func (e Event) Chirp() (Chirp, error) {
+	var chirp Chirp
+	err := json.Unmarshal(e.Data, &chirp)
+	return chirp, err
+}
+
+// Message decodes the data of a message.created event.
+func (e Event) Message() (Message, error) {
+	var msg Message
+	err := json.Unmarshal(e.Data, &msg)
+	return msg, err
+}
+
+// Stream is a realtime connection. Your own notifications come without
+// subscribing, Subscribe adds authors and hashtags.
+type Stream struct {
+	conn *websocket.Conn
+	// gorilla allows one writer at a time
+	writeMu sync.Mutex
+	stop    func() bool
+}
+
+// Stream connects to /api/ws. It closes when ctx is done.
+func (c *Client) Stream(ctx context.Context) (*Stream, error) {
+	if err := c.ensureFresh(ctx); err != nil {
+		return nil, err
+	}
+	access, _ := c.Tokens()
+	u := "ws" + strings.TrimPrefix(c.baseURL, "http") + "/api/ws"
+	header := http.Header{"Authorization": {"Bearer " + access}}
+	dialer := *websocket.DefaultDialer
+	if c.http.Jar != nil {
+		dialer.Jar = c.http.Jar
+	}
+	conn, resp, err := dialer.DialContext(ctx, u, header)
+	if err != nil {
+		if resp != nil && resp.StatusCode >= 400 {
+			defer resp.Body.Close()
+			return nil, decodeError(resp)
+		}
+		return nil, fmt.Errorf("chirpy: realtime: %w", err)
+	}
+	s := &Stream{conn: conn}
+	s.stop = context.AfterFunc(ctx, func() { conn.Close() })
+	return s, nil
+}
+
+func (s *Stream) send(msgType string, topics []string) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return s.conn.WriteJSON(Event{Type: msgType, Topics: topics})
+}
+
+// Subscribe asks for more topics, the server answers with a subscribed
+// event and an error event for each topic it turned down.
+func (s *Stream) Subscribe(topics ...string) error {
+	return s.send("subscribe", topics)
+}
+
+func (s *Stream) Unsubscribe(topics ...string) error {
+	return s.send("unsubscribe", topics)
+}
+
+// Next blocks for the next event. Pings are answered while it waits.
+func (s *Stream) Next() (Event, error) {
+	var ev Event
+	if err := s.conn.ReadJSON(&ev); err != nil {
+		return Event{}, fmt.Errorf("chirpy: realtime: %w", err)
+	}
+	return ev, nil
+}
+
+func (s *Stream) Close() error {
+	s.stop()
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.conn.WriteMessage(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	return s.conn.Close()
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/frankielb/chirpy/client"
+	"github.com/frankielb/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// the sdk lives in its own package but main can't be imported, so it's
+// tested from here against the real handlers
+func TestClient(t *testing.T) {
+	srv, cfg := newTestServer(t)
+	ctx := context.Background()
+
+	alice := client.New(srv.URL)
+	if _, err := alice.CreateUser(ctx, "alice@example.com", "hunter2"); err != nil {
+		t.Fatal(err)
+	}
+	aliceUser, err := alice.Login(ctx, "alice@example.com", "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob := client.New(srv.URL)
+	bob.CreateUser(ctx, "bob@example.com", "hunter2")
+	bobUser, err := bob.Login(ctx, "bob@example.com", "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Errors", func(t *testing.T) {
+		_, err := alice.CreateUser(ctx, "alice@example.com", "again")
+		if !errors.Is(err, client.ErrConflict) {
+			t.Errorf("expected ErrConflict, got %v", err)
+		}
+		_, err = alice.CreateChirp(ctx, "")
+		var apiErr *client.Error
+		if !errors.As(err, &apiErr) || !errors.Is(err, client.ErrValidation) {
+			t.Fatalf("expected a validation error, got %v", err)
+		}
+		if apiErr.Code != "validation_failed" || len(apiErr.Fields) != 1 || apiErr.Fields[0].Field != "body" || apiErr.RequestID == "" {
+			t.Errorf("error = %+v", apiErr)
+		}
+		if _, err := alice.GetChirp(ctx, uuid.New()); !errors.Is(err, client.ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+		if _, err := client.New(srv.URL).ListConversations(ctx); !errors.Is(err, client.ErrNotLoggedIn) {
+			t.Errorf("expected ErrNotLoggedIn, got %v", err)
+		}
+	})
+
+	t.Run("Chirps", func(t *testing.T) {
+		first, err := alice.CreateChirp(ctx, "first")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := alice.CreateChirp(ctx, "second"); err != nil {
+			t.Fatal(err)
+		}
+		chirps, err := client.New(srv.URL).ListChirps(ctx, client.ChirpsOptions{AuthorID: aliceUser.ID, Desc: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(chirps) != 2 || chirps[0].Body != "second" {
+			t.Errorf("chirps = %+v", chirps)
+		}
+		if err := bob.DeleteChirp(ctx, first.ID); !errors.Is(err, client.ErrForbidden) {
+			t.Errorf("expected ErrForbidden, got %v", err)
+		}
+		if err := alice.DeleteChirp(ctx, first.ID); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Refresh", func(t *testing.T) {
+		// inside the slack, so every call refreshes first
+		cfg.AccessTokenTTL = 10 * time.Second
+		defer func() { cfg.AccessTokenTTL = time.Hour }()
+		var saved string
+		c := client.New(srv.URL, client.WithTokenHook(func(access, refresh string) { saved = access }))
+		if _, err := c.Login(ctx, "alice@example.com", "hunter2"); err != nil {
+			t.Fatal(err)
+		}
+		before := saved
+		time.Sleep(1100 * time.Millisecond) // jwt times are in seconds
+		if _, err := c.ListConversations(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if saved == before {
+			t.Error("expected a refreshed token")
+		}
+
+		// a bad access token gets one retry with a fresh one
+		_, refresh := alice.Tokens()
+		c = client.New(srv.URL, client.WithTokens("not-a-jwt", refresh))
+		if _, err := c.ListConversations(ctx); err != nil {
+			t.Fatalf("expected a retry after refresh, got %v", err)
+		}
+		if access, _ := c.Tokens(); access == "not-a-jwt" {
+			t.Error("token wasn't replaced")
+		}
+	})
+
+	t.Run("Messages", func(t *testing.T) {
+		convo, err := alice.CreateConversation(ctx, bobUser.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, body := range []string{"1", "2", "3", "4", "5"} {
+			if _, err := bob.SendMessage(ctx, convo.ID, body); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var got string
+		for msg, err := range alice.Messages(ctx, convo.ID, 2) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			got += msg.Body
+		}
+		if got != "54321" {
+			t.Errorf("messages = %q, want all five newest first", got)
+		}
+		if err := alice.MarkRead(ctx, convo.ID); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Stream", func(t *testing.T) {
+		sctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		stream, err := bob.Stream(sctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer stream.Close()
+		if err := stream.Subscribe(client.AuthorTopic(aliceUser.ID)); err != nil {
+			t.Fatal(err)
+		}
+		if ev, err := stream.Next(); err != nil || ev.Type != client.EventSubscribed {
+			t.Fatalf("got %+v, %v", ev, err)
+		}
+		if _, err := alice.CreateChirp(ctx, "live"); err != nil {
+			t.Fatal(err)
+		}
+		ev, err := stream.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		chirp, err := ev.Chirp()
+		if ev.Type != client.EventChirpCreated || err != nil || chirp.Body != "live" {
+			t.Errorf("event = %+v", ev)
+		}
+	})
+
+	t.Run("Moderation", func(t *testing.T) {
+		chirp, _ := alice.CreateChirp(ctx, "report me")
+		report, err := bob.ReportChirp(ctx, chirp.ID, client.ReasonSpam, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := bob.Reports(ctx, ""); !errors.Is(err, client.ErrForbidden) {
+			t.Errorf("expected ErrForbidden, got %v", err)
+		}
+		cfg.DB.SetUserRole(ctx, database.SetUserRoleParams{ID: bobUser.ID, Role: roleAdmin})
+		if _, err := bob.ClaimReport(ctx, report.ID); err != nil {
+			t.Fatal(err)
+		}
+		resolved, err := bob.ResolveReport(ctx, report.ID, client.Resolution{Action: client.ActionHideChirp})
+		if err != nil || resolved.Status != client.ReportResolved {
+			t.Fatalf("resolve: %+v, %v", resolved, err)
+		}
+		if err := bob.SuspendUser(ctx, aliceUser.ID, time.Time{}, "spam"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := alice.CreateChirp(ctx, "let me out"); !errors.Is(err, client.ErrForbidden) {
+			t.Errorf("expected ErrForbidden while suspended, got %v", err)
+		}
+		if err := bob.UnsuspendUser(ctx, aliceUser.ID); err != nil {
+			t.Fatal(err)
+		}
+		spam, _ := alice.CreateChirp(ctx, "buy now")
+		report, err = bob.ReportChirp(ctx, spam.ID, client.ReasonSpam, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		deleted, err := bob.DeleteReportedChirp(ctx, report.ID, "spam")
+		if err != nil || deleted.Action != client.ActionDeleteChirp || deleted.ChirpID == nil || *deleted.ChirpID != spam.ID {
+			t.Fatalf("delete: %+v, %v", deleted, err)
+		}
+		if _, err := alice.GetChirp(ctx, spam.ID); !errors.Is(err, client.ErrNotFound) {
+			t.Errorf("expected ErrNotFound for the deleted chirp, got %v", err)
+		}
+		actions, err := bob.ModerationActions(ctx, 10)
+		if err != nil || len(actions) < 4 {
+			t.Errorf("actions = %d, %v", len(actions), err)
+		}
+		report2, err := bob.Ready(ctx)
+		if err != nil || report2.Status != "ok" {
+			t.Errorf("ready = %+v, %v", report2, err)
+		}
+	})
+
+	t.Run("Logout", func(t *testing.T) {
+		if err := alice.Logout(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if err := alice.Refresh(ctx); !errors.Is(err, client.ErrNotLoggedIn) {
+			t.Errorf("expected ErrNotLoggedIn, got %v", err)
+		}
+	})
+}
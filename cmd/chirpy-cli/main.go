@@ -0,0 +1,294 @@
+// Command chirpy-cli posts and reads chirps from the terminal. login keeps
+// the tokens in a config file so the other commands don't need a password.
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/frankielb/chirpy/client"
+	"github.com/google/uuid"
+)
+
+const usage = `usage: chirpy-cli [-server url] [-json] [-config path] <command>
+
+  login <email>                       password from CHIRPY_PASSWORD or stdin
+  logout
+  whoami
+  post <text>
+  timeline [-author id] [-n 20]
+  delete <chirpID>
+  tail [-author id] [-tag tag] [-poll 5s]
+
+-server defaults to CHIRPY_SERVER, then the server you logged in to, then
+http://localhost:8080. The session is kept in -config, CHIRPY_CLI_CONFIG or
+chirpy/cli.json in your config dir.`
+
+const defaultServer = "http://localhost:8080"
+
+var errUsage = errors.New(usage)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	err := run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr, os.Getenv)
+	if errors.Is(err, errUsage) {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "chirpy-cli:", err)
+		os.Exit(1)
+	}
+}
+
+type cli struct {
+	in      io.Reader
+	out     io.Writer
+	errOut  io.Writer
+	getenv  func(string) string
+	json    bool
+	path    string
+	sess    session
+	client  *client.Client
+	saveErr error
+}
+
+func run(ctx context.Context, args []string, in io.Reader, out, errOut io.Writer, getenv func(string) string) error {
+	fs := flag.NewFlagSet("chirpy-cli", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	server := fs.String("server", getenv("CHIRPY_SERVER"), "api url")
+	asJSON := fs.Bool("json", false, "print json instead of text")
+	cfgFlag := fs.String("config", "", "session file")
+	if err := fs.Parse(args); err != nil || fs.NArg() == 0 {
+		return errUsage
+	}
+	path, err := configPath(*cfgFlag, getenv)
+	if err != nil {
+		return err
+	}
+	sess, err := loadSession(path)
+	if err != nil {
+		return err
+	}
+	switch {
+	case *server != "" && *server != sess.Server:
+		// tokens from another server are no good here
+		sess = session{Server: *server}
+	case sess.Server == "":
+		sess.Server = defaultServer
+	}
+
+	c := &cli{in: in, out: out, errOut: errOut, getenv: getenv, json: *asJSON, path: path, sess: sess}
+	c.client = client.New(sess.Server,
+		client.WithTokens(sess.AccessToken, sess.RefreshToken),
+		client.WithTokenHook(c.saveTokens))
+
+	cmd, rest := fs.Arg(0), fs.Args()[1:]
+	switch cmd {
+	case "login":
+		err = c.login(ctx, rest)
+	case "logout":
+		err = c.logout(ctx)
+	case "whoami":
+		err = c.whoami(ctx)
+	case "post":
+		err = c.post(ctx, rest)
+	case "timeline":
+		err = c.timeline(ctx, rest)
+	case "delete":
+		err = c.delete(ctx, rest)
+	case "tail":
+		err = c.tail(ctx, rest)
+	default:
+		return errUsage
+	}
+	if err != nil {
+		return err
+	}
+	return c.saveErr
+}
+
+// saveTokens keeps refreshed tokens so the next run doesn't refresh again.
+func (c *cli) saveTokens(access, refresh string) {
+	c.sess.AccessToken, c.sess.RefreshToken = access, refresh
+	if err := c.sess.save(c.path); err != nil {
+		c.saveErr = fmt.Errorf("saving session: %w", err)
+	}
+}
+
+// print writes v as json with -json, otherwise calls text.
+func (c *cli) print(v any, text func(w io.Writer)) {
+	if c.json {
+		enc := json.NewEncoder(c.out)
+		enc.SetIndent("", "  ")
+		enc.Encode(v)
+		return
+	}
+	text(c.out)
+}
+
+func (c *cli) needLogin() error {
+	if c.sess.RefreshToken == "" {
+		return errors.New("not logged in, run chirpy-cli login <email>")
+	}
+	return nil
+}
+
+func (c *cli) login(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	password := c.getenv("CHIRPY_PASSWORD")
+	if password == "" {
+		fmt.Fprint(c.errOut, "password: ")
+		line, err := bufio.NewReader(c.in).ReadString('\n')
+		if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+			return fmt.Errorf("reading password: %w", err)
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+	user, err := c.client.Login(ctx, args[0], password)
+	if err != nil {
+		return err
+	}
+	// the token hook saved the tokens already, add who they're for
+	c.sess.UserID, c.sess.Email = user.ID, user.Email
+	if err := c.sess.save(c.path); err != nil {
+		return fmt.Errorf("saving session: %w", err)
+	}
+	c.print(user, func(w io.Writer) {
+		fmt.Fprintf(w, "logged in to %s as %s\n", c.sess.Server, user.Email)
+	})
+	return nil
+}
+
+func (c *cli) logout(ctx context.Context) error {
+	if err := c.needLogin(); err != nil {
+		return err
+	}
+	// forget the session even if the server has already
+	err := c.client.Logout(ctx)
+	if rmErr := os.Remove(c.path); rmErr != nil && !errors.Is(rmErr, os.ErrNotExist) {
+		return rmErr
+	}
+	if err != nil && !errors.Is(err, client.ErrUnauthorized) {
+		return err
+	}
+	c.print(map[string]bool{"logged_out": true}, func(w io.Writer) {
+		fmt.Fprintln(w, "logged out")
+	})
+	return nil
+}
+
+func (c *cli) whoami(ctx context.Context) error {
+	if err := c.needLogin(); err != nil {
+		return err
+	}
+	// any authenticated call does, this one has no side effects
+	if _, err := c.client.ListConversations(ctx); err != nil {
+		if errors.Is(err, client.ErrUnauthorized) {
+			return errors.New("session expired, log in again")
+		}
+		return err
+	}
+	info := struct {
+		Server string    `json:"server"`
+		ID     uuid.UUID `json:"id"`
+		Email  string    `json:"email"`
+	}{c.sess.Server, c.sess.UserID, c.sess.Email}
+	c.print(info, func(w io.Writer) {
+		fmt.Fprintf(w, "%s (%s) on %s\n", info.Email, info.ID, info.Server)
+	})
+	return nil
+}
+
+func (c *cli) post(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	if err := c.needLogin(); err != nil {
+		return err
+	}
+	chirp, err := c.client.CreateChirp(ctx, strings.Join(args, " "))
+	if err != nil {
+		return err
+	}
+	c.print(chirp, func(w io.Writer) {
+		fmt.Fprintf(w, "posted %s\n", chirp.ID)
+	})
+	return nil
+}
+
+func (c *cli) delete(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	id, err := uuid.Parse(args[0])
+	if err != nil {
+		return fmt.Errorf("bad chirp id: %w", err)
+	}
+	if err := c.needLogin(); err != nil {
+		return err
+	}
+	if err := c.client.DeleteChirp(ctx, id); err != nil {
+		return err
+	}
+	c.print(map[string]uuid.UUID{"deleted": id}, func(w io.Writer) {
+		fmt.Fprintf(w, "deleted %s\n", id)
+	})
+	return nil
+}
+
+func (c *cli) timeline(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("timeline", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	author := fs.String("author", "", "only this user id")
+	n := fs.Int("n", 20, "how many")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		return errUsage
+	}
+	opts := client.ChirpsOptions{Desc: true}
+	if *author != "" {
+		id, err := uuid.Parse(*author)
+		if err != nil {
+			return fmt.Errorf("bad author id: %w", err)
+		}
+		opts.AuthorID = id
+	}
+	chirps, err := c.client.ListChirps(ctx, opts)
+	if err != nil {
+		return err
+	}
+	if *n > 0 && len(chirps) > *n {
+		chirps = chirps[:*n]
+	}
+	c.print(chirps, func(w io.Writer) {
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		for _, chirp := range chirps {
+			c.writeChirp(tw, chirp)
+		}
+		tw.Flush()
+	})
+	return nil
+}
+
+// writeChirp is one line of human output, the id first so it can be
+// copied into delete.
+func (c *cli) writeChirp(w io.Writer, chirp client.Chirp) {
+	author := chirp.UserID.String()[:8]
+	if chirp.UserID == c.sess.UserID {
+		author = "you"
+	}
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", chirp.ID, chirp.CreatedAt.Local().Format(time.DateTime), author, chirp.Body)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestSessionFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chirpy", "cli.json")
+	sess, err := loadSession(path)
+	if err != nil || sess != (session{}) {
+		t.Fatalf("missing file: %+v, %v", sess, err)
+	}
+	want := session{Server: "http://x", UserID: uuid.New(), Email: "a@b.c", AccessToken: "a", RefreshToken: "r"}
+	if err := want.save(path); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("mode = %v, want 0600", info.Mode().Perm())
+	}
+	got, err := loadSession(path)
+	if err != nil || got != want {
+		t.Fatalf("got %+v, %v", got, err)
+	}
+
+	p, _ := configPath("", func(string) string { return "/from/env" })
+	if p != "/from/env" {
+		t.Errorf("configPath = %q", p)
+	}
+	p, _ = configPath("/from/flag", func(string) string { return "/from/env" })
+	if p != "/from/flag" {
+		t.Errorf("configPath = %q", p)
+	}
+}
+
+// fakeAPI is just enough of the api for the commands.
+type fakeAPI struct {
+	mu     sync.Mutex
+	userID uuid.UUID
+	chirps []map[string]any
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	writeJSON := func(code int, v any) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(v)
+	}
+	authed := r.Header.Get("Authorization") == "Bearer access"
+	switch r.Method + " " + r.URL.Path {
+	case "POST /api/login":
+		var creds struct{ Email, Password string }
+		json.NewDecoder(r.Body).Decode(&creds)
+		if creds.Password != "hunter2" {
+			writeJSON(401, map[string]any{"title": "Unauthorized", "status": 401})
+			return
+		}
+		writeJSON(200, map[string]any{"id": f.userID, "email": creds.Email, "token": "access", "refresh_token": "refresh"})
+	case "POST /api/chirps":
+		if !authed {
+			writeJSON(401, map[string]any{"title": "Unauthorized", "status": 401})
+			return
+		}
+		var body struct{ Body string }
+		json.NewDecoder(r.Body).Decode(&body)
+		chirp := map[string]any{"id": uuid.New(), "created_at": time.Now(), "body": body.Body, "user_id": f.userID}
+		f.chirps = append(f.chirps, chirp)
+		writeJSON(201, chirp)
+	case "GET /api/chirps":
+		writeJSON(200, f.chirps)
+	case "GET /api/conversations":
+		if !authed {
+			writeJSON(401, map[string]any{"title": "Unauthorized", "status": 401})
+			return
+		}
+		writeJSON(200, []any{})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestCommands(t *testing.T) {
+	api := &fakeAPI{userID: uuid.New()}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+	cfgPath := filepath.Join(t.TempDir(), "cli.json")
+	env := map[string]string{"CHIRPY_SERVER": srv.URL, "CHIRPY_CLI_CONFIG": cfgPath}
+	getenv := func(k string) string { return env[k] }
+
+	cli := func(stdin string, args ...string) (string, error) {
+		t.Helper()
+		var out, errOut bytes.Buffer
+		err := run(context.Background(), args, strings.NewReader(stdin), &out, &errOut, getenv)
+		return out.String(), err
+	}
+
+	if _, err := cli("", "post", "hello"); err == nil || !strings.Contains(err.Error(), "not logged in") {
+		t.Fatalf("post before login: %v", err)
+	}
+	if _, err := cli("wrong\n", "login", "a@b.c"); err == nil {
+		t.Fatal("login with a bad password worked")
+	}
+	out, err := cli("hunter2\n", "login", "a@b.c")
+	if err != nil || !strings.Contains(out, "logged in") {
+		t.Fatalf("login: %q, %v", out, err)
+	}
+
+	// the rest come from the saved session
+	delete(env, "CHIRPY_SERVER")
+	if out, err = cli("", "whoami"); err != nil || !strings.Contains(out, "a@b.c") {
+		t.Fatalf("whoami: %q, %v", out, err)
+	}
+	if out, err = cli("", "post", "hello", "world"); err != nil || !strings.HasPrefix(out, "posted ") {
+		t.Fatalf("post: %q, %v", out, err)
+	}
+	if out, err = cli("", "timeline"); err != nil || !strings.Contains(out, "you") || !strings.Contains(out, "hello world") {
+		t.Fatalf("timeline: %q, %v", out, err)
+	}
+	out, err = cli("", "-json", "timeline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var chirps []struct{ Body string }
+	if err := json.Unmarshal([]byte(out), &chirps); err != nil || len(chirps) != 1 || chirps[0].Body != "hello world" {
+		t.Fatalf("timeline -json: %q, %v", out, err)
+	}
+	if _, err := cli("", "frobnicate"); err != errUsage {
+		t.Fatalf("unknown command: %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/frankielb/chirpy/client"
+	"github.com/google/uuid"
+)
+
+// tailEvent is one line of tail -json output.
+type tailEvent struct {
+	Type  string       `json:"type"`
+	Chirp client.Chirp `json:"chirp"`
+}
+
+// tail follows new chirps. With an author or tag and a session it uses the
+// realtime stream, otherwise or if the stream can't connect it polls.
+func (c *cli) tail(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("tail", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	author := fs.String("author", "", "only this user id")
+	tag := fs.String("tag", "", "only chirps with this hashtag")
+	poll := fs.Duration("poll", 0, "poll this often instead of streaming")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 || *poll < 0 {
+		return errUsage
+	}
+	var authorID uuid.UUID
+	if *author != "" {
+		id, err := uuid.Parse(*author)
+		if err != nil {
+			return fmt.Errorf("bad author id: %w", err)
+		}
+		authorID = id
+	}
+	tagName := strings.ToLower(strings.TrimPrefix(*tag, "#"))
+
+	topics := []string{}
+	if authorID != uuid.Nil {
+		topics = append(topics, client.AuthorTopic(authorID))
+	}
+	if tagName != "" {
+		topics = append(topics, client.HashtagTopic(tagName))
+	}
+	// the stream ORs topics together, tail wants both to match
+	if *poll == 0 && len(topics) == 1 && c.sess.RefreshToken != "" {
+		err := c.stream(ctx, topics)
+		if err == nil || ctx.Err() != nil {
+			return nil
+		}
+		fmt.Fprintf(c.errOut, "stream failed, polling instead: %v\n", err)
+	}
+	if *poll == 0 {
+		*poll = 5 * time.Second
+	}
+	return c.poll(ctx, authorID, tagName, *poll)
+}
+
+func (c *cli) stream(ctx context.Context, topics []string) error {
+	s, err := c.client.Stream(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	if err := s.Subscribe(topics...); err != nil {
+		return err
+	}
+	for {
+		ev, err := s.Next()
+		if err != nil {
+			return err
+		}
+		switch ev.Type {
+		case client.EventChirpCreated, client.EventChirpDeleted:
+			chirp, err := ev.Chirp()
+			if err != nil {
+				return err
+			}
+			c.printEvent(ev.Type, chirp)
+		case client.EventError:
+			return errors.New(ev.Error)
+		}
+	}
+}
+
+// poll lists chirps every interval and prints the ones it hasn't seen. The
+// first list only primes seen, like tail -f with no backlog.
+func (c *cli) poll(ctx context.Context, authorID uuid.UUID, tag string, every time.Duration) error {
+	var tagRe *regexp.Regexp
+	if tag != "" {
+		tagRe = regexp.MustCompile(`(?i)(^|[^\w#])#` + regexp.QuoteMeta(tag) + `\b`)
+	}
+	seen := map[uuid.UUID]bool{}
+	first := true
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		chirps, err := c.client.ListChirps(ctx, client.ChirpsOptions{AuthorID: authorID})
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		// oldest first so the output reads top to bottom
+		for _, chirp := range chirps {
+			if seen[chirp.ID] {
+				continue
+			}
+			seen[chirp.ID] = true
+			if first || (tagRe != nil && !tagRe.MatchString(chirp.Body)) {
+				continue
+			}
+			c.printEvent(client.EventChirpCreated, chirp)
+		}
+		first = false
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// printEvent writes one line per event, ndjson with -json.
+func (c *cli) printEvent(typ string, chirp client.Chirp) {
+	if c.json {
+		json.NewEncoder(c.out).Encode(tailEvent{Type: typ, Chirp: chirp})
+		return
+	}
+	if typ == client.EventChirpDeleted {
+		fmt.Fprintf(c.out, "%s\tdeleted\n", chirp.ID)
+		return
+	}
+	c.writeChirp(c.out, chirp)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/frankielb/chirpy/internal/service"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// decodeJSON reads one json object from the body into dst, then runs
+// validate on it if given. Unknown fields, trailing junk and bodies over
+// MaxBodyBytes are all rejected. On any failure it has already written a
+// problem response and returns false.
+//
+// Msgpack bodies are read the same way, by the json field names. Protobuf
+// ones need a message in protoRequests, they're turned into json first so
+// they get the same checks.
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst any, validate func(v *service.Validator)) bool {
+	// no content type is fine, plenty of clients don't bother
+	f := formatJSON
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		mt, _, err := mime.ParseMediaType(ct)
+		var ok bool
+		if err == nil {
+			f, ok = formatOf(mt)
+		}
+		if !ok {
+			respondProblem(w, r, problem{
+				Status: http.StatusUnsupportedMediaType,
+				Code:   codeUnsupportedMedia,
+				Detail: "Body must be application/json, application/msgpack or application/x-protobuf",
+			}, err)
+			return false
+		}
+	}
+
+	var err error
+	switch f {
+	case formatMsgpack:
+		err = decodeMsgpack(r.Body, dst)
+	case formatProtobuf:
+		newMsg, ok := protoRequests[r.Pattern]
+		if !ok {
+			respondProblem(w, r, problem{
+				Status: http.StatusUnsupportedMediaType,
+				Code:   codeUnsupportedMedia,
+				Detail: "There's no protobuf message for this request, send json or msgpack",
+			}, nil)
+			return false
+		}
+		err = decodeProtobuf(r.Body, newMsg(), dst)
+	default:
+		err = decodeJSONBody(r.Body, dst)
+	}
+	if err != nil {
+		respondProblem(w, r, decodeProblem(err), err)
+		return false
+	}
+
+	if validate != nil {
+		var v service.Validator
+		validate(&v)
+		if err := v.Err(); err != nil {
+			respondServiceError(w, r, err)
+			return false
+		}
+	}
+	return true
+}
+
+func decodeJSONBody(body io.Reader, dst any) error {
+	dec := json.NewDecoder(body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(dst)
+	if err == nil && dec.More() {
+		err = errors.New("trailing data after the json object")
+	}
+	return err
+}
+
+// errMalformed wraps msgpack and protobuf errors, they don't have types to
+// tell what went wrong like json's.
+type errMalformed struct {
+	format string
+	err    error
+}
+
+func (e *errMalformed) Error() string { return e.format + ": " + e.err.Error() }
+func (e *errMalformed) Unwrap() error { return e.err }
+
+func decodeMsgpack(body io.Reader, dst any) error {
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	if len(b) == 0 {
+		return io.EOF
+	}
+	rd := bytes.NewReader(b)
+	dec := msgpack.NewDecoder(rd)
+	dec.SetCustomStructTag("json")
+	dec.DisallowUnknownFields(true)
+	if err := dec.Decode(dst); err != nil {
+		if strings.HasPrefix(err.Error(), "msgpack: unknown field ") {
+			return err
+		}
+		return &errMalformed{format: "msgpack", err: err}
+	}
+	if rd.Len() > 0 {
+		return &errMalformed{format: "msgpack", err: errors.New("trailing data after the object")}
+	}
+	return nil
+}
+
+// decodeProtobuf reads msg from body, then decodes it into dst as json.
+func decodeProtobuf(body io.Reader, msg proto.Message, dst any) error {
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	if err := proto.Unmarshal(b, msg); err != nil {
+		return &errMalformed{format: "protobuf", err: err}
+	}
+	j, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return decodeJSONBody(bytes.NewReader(j), dst)
+}
+
+// decodeProblem says what was wrong with a body that couldn't be decoded.
+func decodeProblem(err error) problem {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var maxErr *http.MaxBytesError
+	var malformed *errMalformed
+	switch {
+	case errors.As(err, &maxErr):
+		return problem{
+			Status: http.StatusRequestEntityTooLarge,
+			Code:   codeBodyTooLarge,
+			Detail: fmt.Sprintf("Body is over %d bytes", maxErr.Limit),
+		}
+	case errors.Is(err, io.EOF):
+		return problem{Status: http.StatusBadRequest, Code: codeEmptyBody, Detail: "Body is empty"}
+	case errors.As(err, &typeErr):
+		msg := fmt.Sprintf("should be %s, not %s", typeErr.Type, typeErr.Value)
+		return problem{
+			Status: http.StatusUnprocessableEntity,
+			Code:   codeValidation,
+			Detail: typeErr.Field + " " + msg,
+			Errors: []fieldError{{Field: typeErr.Field, Code: "wrong_type", Message: msg}},
+		}
+	case strings.HasPrefix(err.Error(), "json: unknown field "), strings.HasPrefix(err.Error(), "msgpack: unknown field "):
+		// neither encoding/json nor msgpack has a type for this one
+		_, field, _ := strings.Cut(err.Error(), ": unknown field ")
+		field = strings.Trim(field, `"`)
+		return problem{
+			Status: http.StatusBadRequest,
+			Code:   codeUnknownField,
+			Detail: fmt.Sprintf("Unknown field %q", field),
+			Errors: []fieldError{{Field: field, Code: codeUnknownField, Message: "not a field of this request"}},
+		}
+	case errors.As(err, &malformed):
+		return problem{Status: http.StatusBadRequest, Code: codeMalformedBody, Detail: "Body isn't valid " + malformed.format}
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return problem{Status: http.StatusBadRequest, Code: codeMalformedJSON, Detail: "Body isn't valid json"}
+	}
+	return problem{Status: http.StatusBadRequest, Code: codeMalformedJSON, Detail: err.Error()}
+}
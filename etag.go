@@ -0,0 +1,122 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"hash"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/frankielb/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// chirpETag is a strong etag for one chirp. Every change to a chirp bumps
+// updated_at, so the two of them are enough.
+func chirpETag(id uuid.UUID, updatedAt time.Time) string {
+	h := sha256.New()
+	writeVersion(h, id, updatedAt)
+	return etag(h)
+}
+
+// listETag is a weak etag for a listing of chirps from its version. It's
+// weak because it says the listing holds the same chirps at the same
+// versions, not that it's byte for byte the one the client has.
+func listETag(desc bool, v database.GetChirpsVersionRow) string {
+	h := sha256.New()
+	h.Write([]byte("list"))
+	// order only matters with two or more
+	if desc && v.Total > 1 {
+		h.Write([]byte("desc"))
+	}
+	h.Write(binary.BigEndian.AppendUint64(nil, uint64(v.Total)))
+	h.Write([]byte(v.Digest))
+	return "W/" + etag(h)
+}
+
+func writeVersion(h hash.Hash, id uuid.UUID, updatedAt time.Time) {
+	h.Write(id[:])
+	h.Write(binary.BigEndian.AppendUint64(nil, uint64(updatedAt.UnixNano())))
+}
+
+func etag(h hash.Hash) string {
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// etagList splits an If-Match or If-None-Match header into its etags,
+// keeping the quotes and any W/ prefix. The format suffix is taken off so
+// they compare with the handler's etags.
+func etagList(r *http.Request, header string) []string {
+	var tags []string
+	for _, v := range r.Header.Values(header) {
+		for v != "" {
+			v = strings.TrimLeft(v, " \t,")
+			if v == "" {
+				break
+			}
+			if v[0] == '*' {
+				tags = append(tags, "*")
+				v = v[1:]
+				continue
+			}
+			start := 0
+			if strings.HasPrefix(v, "W/") {
+				start = 2
+			}
+			if len(v) <= start || v[start] != '"' {
+				// not an etag, ignore the rest of the header
+				break
+			}
+			end := strings.IndexByte(v[start+1:], '"')
+			if end < 0 {
+				break
+			}
+			end += start + 2
+			tags = append(tags, trimFormat(v[:end]))
+			v = v[end:]
+		}
+	}
+	return tags
+}
+
+// trimFormat takes a format's etagSuffix back off tag.
+func trimFormat(tag string) string {
+	for _, f := range []format{formatMsgpack, formatProtobuf} {
+		if suffix := f.etagSuffix() + `"`; strings.HasSuffix(tag, suffix) {
+			return strings.TrimSuffix(tag, suffix) + `"`
+		}
+	}
+	return tag
+}
+
+// notModified writes a 304 when If-None-Match already has etag. GETs use
+// the weak comparison, so W/ on either side is ignored. Each format is its own
+// representation so the etag sent has the format on it, chirps all have
+// protobuf messages.
+func notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", strings.TrimSuffix(etag, `"`)+negotiateFormat(r, true).etagSuffix()+`"`)
+	varyAccept(w.Header())
+	for _, tag := range etagList(r, "If-None-Match") {
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatch is false if the request has an If-Match that etag isn't in.
+// Weak tags never match, the write needs the exact version.
+func ifMatch(r *http.Request, etag string) bool {
+	if len(r.Header.Values("If-Match")) == 0 {
+		return true
+	}
+	for _, tag := range etagList(r, "If-Match") {
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
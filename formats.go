@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/frankielb/chirpy/internal/chirpypb"
+	"github.com/google/uuid"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// format is a way of writing a body. JSON is the default, msgpack has the
+// same fields as the json, and protobuf uses the messages in
+// proto/chirpy/v1/chirpy.proto.
+type format int
+
+const (
+	formatJSON format = iota
+	formatMsgpack
+	formatProtobuf
+)
+
+const (
+	mediaJSON     = "application/json"
+	mediaMsgpack  = "application/msgpack"
+	mediaProtobuf = "application/x-protobuf"
+)
+
+// the names clients use for each, the first is what we send
+var formatMedia = map[format][]string{
+	formatJSON:     {mediaJSON},
+	formatMsgpack:  {mediaMsgpack, "application/x-msgpack", "application/vnd.msgpack"},
+	formatProtobuf: {mediaProtobuf, "application/protobuf", "application/vnd.google.protobuf"},
+}
+
+// formatOf is the format of a Content-Type, ok is false for ones we can't
+// read. json includes the +json types like problem+json.
+func formatOf(mediaType string) (format, bool) {
+	if strings.HasSuffix(mediaType, "+json") {
+		return formatJSON, true
+	}
+	for f, names := range formatMedia {
+		for _, name := range names {
+			if mediaType == name {
+				return f, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// etagSuffix keeps the formats' etags apart, json has the plain one.
+func (f format) etagSuffix() string {
+	switch f {
+	case formatMsgpack:
+		return "-msgpack"
+	case formatProtobuf:
+		return "-protobuf"
+	}
+	return ""
+}
+
+// negotiateFormat picks the format for a response from Accept. Protobuf is
+// only on offer when the body has a message. Anything Accept doesn't cover
+// gets json rather than a 406, it's what clients got before.
+func negotiateFormat(r *http.Request, hasProto bool) format {
+	accept := strings.Join(r.Header.Values("Accept"), ",")
+	if accept == "" {
+		return formatJSON
+	}
+	offered := []format{formatJSON, formatMsgpack}
+	if hasProto {
+		offered = append(offered, formatProtobuf)
+	}
+	best, bestQ := formatJSON, 0.0
+	for _, f := range offered {
+		// ties go to the earlier one, json beats */*
+		if q := acceptQ(accept, f); q > bestQ {
+			best, bestQ = f, q
+		}
+	}
+	return best
+}
+
+// acceptQ is the q Accept gives f, from the most specific range that
+// matches it.
+func acceptQ(accept string, f format) float64 {
+	q, specificity := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		s := -1
+		switch {
+		case mt == "*/*":
+			s = 0
+		case mt == "application/*":
+			s = 1
+		default:
+			if got, ok := formatOf(mt); ok && got == f {
+				s = 2
+			}
+		}
+		if s <= specificity {
+			continue
+		}
+		w := 1.0
+		if v, ok := params["q"]; ok {
+			if w, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		q, specificity = w, s
+	}
+	return q
+}
+
+// varyAccept says the body depended on Accept, once.
+func varyAccept(h http.Header) {
+	for _, v := range h.Values("Vary") {
+		for _, field := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), "Accept") {
+				return
+			}
+		}
+	}
+	h.Add("Vary", "Accept")
+}
+
+// marshalBody encodes v as f. Protobuf needs v to have a message, check
+// with protoMessage before offering it.
+func marshalBody(f format, v any) ([]byte, error) {
+	switch f {
+	case formatMsgpack:
+		var buf bytes.Buffer
+		err := newMsgpackEncoder(&buf).Encode(v)
+		return buf.Bytes(), err
+	case formatProtobuf:
+		m := protoMessage(v)
+		if m == nil {
+			return nil, fmt.Errorf("no protobuf message for %T", v)
+		}
+		return proto.Marshal(m)
+	}
+	return json.Marshal(v)
+}
+
+// msgpack goes by the json tags so the two have the same field names.
+func newMsgpackEncoder(buf *bytes.Buffer) *msgpack.Encoder {
+	enc := msgpack.NewEncoder(buf)
+	enc.SetCustomStructTag("json")
+	return enc
+}
+
+func init() {
+	// ids are strings like in the json, not 16 bytes of binary
+	msgpack.Register(uuid.UUID{},
+		func(e *msgpack.Encoder, v reflect.Value) error {
+			return e.EncodeString(v.Interface().(uuid.UUID).String())
+		},
+		func(d *msgpack.Decoder, v reflect.Value) error {
+			s, err := d.DecodeString()
+			if err != nil {
+				return err
+			}
+			id, err := uuid.Parse(s)
+			if err != nil {
+				return err
+			}
+			v.Set(reflect.ValueOf(id))
+			return nil
+		})
+}
+
+// protoMessage is v as its message in chirpy.proto, or nil if it hasn't
+// got one. It goes by the exact type, a struct that embeds User is more
+// than a User.
+func protoMessage(v any) proto.Message {
+	switch v := v.(type) {
+	case chirpJSON:
+		return &chirpypb.Chirp{
+			Id:        v.Id,
+			CreatedAt: timestamppb.New(v.CreatedAt),
+			UpdatedAt: timestamppb.New(v.UpdatedAt),
+			Body:      v.Body,
+			UserId:    v.UserID,
+		}
+	case User:
+		return &chirpypb.User{
+			Id:          v.ID.String(),
+			CreatedAt:   timestamppb.New(v.CreatedAt),
+			UpdatedAt:   timestamppb.New(v.UpdatedAt),
+			Email:       v.Email,
+			IsChirpyRed: v.IsChirpyRed,
+		}
+	case problem:
+		m := &chirpypb.Problem{
+			Type:      v.Type,
+			Title:     v.Title,
+			Status:    int32(v.Status),
+			Detail:    v.Detail,
+			Instance:  v.Instance,
+			Code:      v.Code,
+			RequestId: v.RequestID,
+		}
+		for _, e := range v.Errors {
+			m.Errors = append(m.Errors, &chirpypb.FieldError{Field: e.Field, Code: e.Code, Message: e.Message})
+		}
+		return m
+	}
+	return nil
+}
+
+// protoRequests are the routes that take a protobuf body, and the message
+// it is. decodeJSON turns it into json and carries on as normal.
+var protoRequests = map[string]func() proto.Message{
+	"POST /api/chirps": func() proto.Message { return &chirpypb.ChirpRequest{} },
+	"POST /api/users":  func() proto.Message { return &chirpypb.UserRequest{} },
+	"PUT /api/users":   func() proto.Message { return &chirpypb.UserRequest{} },
+	"POST /api/login":  func() proto.Message { return &chirpypb.UserRequest{} },
+}
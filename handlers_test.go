@@ -0,0 +1,910 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frankielb/chirpy/internal/chirpypb"
+	"github.com/frankielb/chirpy/internal/config"
+	"github.com/frankielb/chirpy/internal/database"
+	"github.com/frankielb/chirpy/internal/health"
+	"github.com/frankielb/chirpy/internal/metrics"
+	"github.com/frankielb/chirpy/internal/ratelimit"
+	"github.com/frankielb/chirpy/internal/realtime"
+	"github.com/frankielb/chirpy/internal/store"
+	"github.com/google/uuid"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+// newTestServer runs the whole api on the in-memory store.
+func newTestServer(t *testing.T) (*httptest.Server, *apiConfig) {
+	t.Helper()
+	conf := config.Default()
+	conf.Platform = "dev"
+	conf.Secret = "test-secret"
+	conf.PolkaKey = "test-polka"
+	cfg := &apiConfig{
+		Config:  conf,
+		DB:      store.NewMemory(),
+		Hub:     realtime.NewHub(5),
+		Health:  health.NewRegistry(conf.HealthTimeout),
+		Metrics: metrics.New(),
+	}
+	cfg.Service = cfg.newService()
+	cfg.registerChecks(nil, "")
+	srv := httptest.NewServer(cfg.handler())
+	t.Cleanup(srv.Close)
+	return srv, cfg
+}
+
+// doJSON sends body as json and decodes the response into out if given.
+func doJSON(t *testing.T, method, url, token string, body, out any) int {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatalf("failed to encode body: %v", err)
+		}
+	}
+	req, err := http.NewRequest(method, url, &buf)
+	if err != nil {
+		t.Fatalf("failed to make request: %v", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+	}
+	return resp.StatusCode
+}
+
+type loginResult struct {
+	User
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+func signUp(t *testing.T, srv *httptest.Server, email string) loginResult {
+	t.Helper()
+	creds := userIn{Email: email, Password: "hunter2"}
+	if code := doJSON(t, "POST", srv.URL+"/api/users", "", creds, nil); code != http.StatusCreated {
+		t.Fatalf("create user: got %d", code)
+	}
+	var login loginResult
+	if code := doJSON(t, "POST", srv.URL+"/api/login", "", creds, &login); code != http.StatusOK {
+		t.Fatalf("login: got %d", code)
+	}
+	return login
+}
+
+func TestChirpsAPI(t *testing.T) {
+	srv, _ := newTestServer(t)
+	alice := signUp(t, srv, "alice@example.com")
+	bob := signUp(t, srv, "bob@example.com")
+
+	t.Run("Wrong Password", func(t *testing.T) {
+		code := doJSON(t, "POST", srv.URL+"/api/login", "", userIn{Email: "alice@example.com", Password: "nope"}, nil)
+		if code != http.StatusUnauthorized {
+			t.Errorf("expected 401, got: %d", code)
+		}
+	})
+
+	var chirp chirpJSON
+	t.Run("Create Chirp", func(t *testing.T) {
+		code := doJSON(t, "POST", srv.URL+"/api/chirps", alice.Token, map[string]string{"body": "what a kerfuffle"}, &chirp)
+		if code != http.StatusCreated {
+			t.Fatalf("expected 201, got: %d", code)
+		}
+		if chirp.Body != "what a ****" {
+			t.Errorf("profanity not cleaned: %q", chirp.Body)
+		}
+		if code := doJSON(t, "POST", srv.URL+"/api/chirps", "", map[string]string{"body": "hi"}, nil); code != http.StatusUnauthorized {
+			t.Errorf("expected 401 without token, got: %d", code)
+		}
+	})
+
+	t.Run("Get Chirps", func(t *testing.T) {
+		var got chirpJSON
+		if code := doJSON(t, "GET", srv.URL+"/api/chirps/"+chirp.Id, "", nil, &got); code != http.StatusOK {
+			t.Fatalf("expected 200, got: %d", code)
+		}
+		if got.Id != chirp.Id {
+			t.Errorf("id mismatch, got: %v, not: %v", got.Id, chirp.Id)
+		}
+		var list []chirpJSON
+		doJSON(t, "GET", srv.URL+"/api/chirps?author_id="+alice.ID.String(), "", nil, &list)
+		if len(list) != 1 {
+			t.Errorf("expected 1 chirp, got: %d", len(list))
+		}
+	})
+
+	t.Run("Block Hides Chirps", func(t *testing.T) {
+		if code := doJSON(t, "POST", srv.URL+"/api/users/"+alice.ID.String()+"/block", bob.Token, nil, nil); code != http.StatusNoContent {
+			t.Fatalf("expected 204, got: %d", code)
+		}
+		var list []chirpJSON
+		doJSON(t, "GET", srv.URL+"/api/chirps", bob.Token, nil, &list)
+		if len(list) != 0 {
+			t.Errorf("expected blocked chirps hidden, got: %d", len(list))
+		}
+		doJSON(t, "GET", srv.URL+"/api/chirps", "", nil, &list)
+		if len(list) != 1 {
+			t.Errorf("expected 1 chirp logged out, got: %d", len(list))
+		}
+	})
+
+	t.Run("Delete Chirp", func(t *testing.T) {
+		if code := doJSON(t, "DELETE", srv.URL+"/api/chirps/"+chirp.Id, bob.Token, nil, nil); code != http.StatusForbidden {
+			t.Errorf("expected 403 for someone else's chirp, got: %d", code)
+		}
+		if code := doJSON(t, "DELETE", srv.URL+"/api/chirps/"+chirp.Id, alice.Token, nil, nil); code != http.StatusNoContent {
+			t.Errorf("expected 204, got: %d", code)
+		}
+		if code := doJSON(t, "GET", srv.URL+"/api/chirps/"+chirp.Id, "", nil, nil); code != http.StatusNotFound {
+			t.Errorf("expected 404 after delete, got: %d", code)
+		}
+	})
+
+	t.Run("Refresh And Revoke", func(t *testing.T) {
+		var refreshed struct {
+			Token string `json:"token"`
+		}
+		if code := doJSON(t, "POST", srv.URL+"/api/refresh", alice.RefreshToken, nil, &refreshed); code != http.StatusOK {
+			t.Fatalf("expected 200, got: %d", code)
+		}
+		if refreshed.Token == "" {
+			t.Error("expected a new access token")
+		}
+		if code := doJSON(t, "POST", srv.URL+"/api/revoke", alice.RefreshToken, nil, nil); code != http.StatusNoContent {
+			t.Fatalf("expected 204, got: %d", code)
+		}
+		if code := doJSON(t, "POST", srv.URL+"/api/refresh", alice.RefreshToken, nil, nil); code != http.StatusUnauthorized {
+			t.Errorf("expected 401 after revoke, got: %d", code)
+		}
+	})
+}
+
+func TestAdminRoles(t *testing.T) {
+	srv, cfg := newTestServer(t)
+	admin := signUp(t, srv, "admin@example.com")
+	user := signUp(t, srv, "user@example.com")
+	if err := cfg.DB.SetUserRole(context.Background(), database.SetUserRoleParams{ID: admin.ID, Role: roleAdmin}); err != nil {
+		t.Fatalf("failed to promote: %v", err)
+	}
+
+	if code := doJSON(t, "GET", srv.URL+"/admin/reports", user.Token, nil, nil); code != http.StatusForbidden {
+		t.Errorf("expected 403 for a normal user, got: %d", code)
+	}
+	if code := doJSON(t, "GET", srv.URL+"/admin/reports", admin.Token, nil, nil); code != http.StatusOK {
+		t.Errorf("expected 200 for an admin, got: %d", code)
+	}
+
+	// suspended users cant post or log in
+	if code := doJSON(t, "POST", srv.URL+"/admin/users/"+user.ID.String()+"/suspend", admin.Token, map[string]any{}, nil); code != http.StatusNoContent {
+		t.Fatalf("expected 204, got: %d", code)
+	}
+	if code := doJSON(t, "POST", srv.URL+"/api/chirps", user.Token, map[string]string{"body": "let me out"}, nil); code != http.StatusForbidden {
+		t.Errorf("expected 403 posting while suspended, got: %d", code)
+	}
+	if code := doJSON(t, "POST", srv.URL+"/api/login", "", userIn{Email: "user@example.com", Password: "hunter2"}, nil); code != http.StatusForbidden {
+		t.Errorf("expected 403 logging in while suspended, got: %d", code)
+	}
+}
+
+func TestHealthAndBodyLimit(t *testing.T) {
+	srv, cfg := newTestServer(t)
+	if code := doJSON(t, "GET", srv.URL+"/api/readyz", "", nil, nil); code != http.StatusOK {
+		t.Fatalf("readyz: got %d", code)
+	}
+	cfg.Health.Register("cache", func(ctx context.Context) error { return errors.New("cache down") })
+	var report health.Report
+	if code := doJSON(t, "GET", srv.URL+"/api/readyz", "", nil, &report); code != http.StatusServiceUnavailable {
+		t.Fatalf("readyz with a failing check: got %d", code)
+	}
+	if report.Checks["cache"].Status != health.StatusFail || report.Checks["shutdown"].Status != health.StatusOK {
+		t.Fatalf("report = %+v", report)
+	}
+	// why it failed is for the logs, not anyone who asks
+	resp, err := http.Get(srv.URL + "/api/readyz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if strings.Contains(string(body), "cache down") {
+		t.Fatalf("readyz leaked the error: %s", body)
+	}
+
+	cfg.Health.Register("cache", func(ctx context.Context) error { return nil })
+	cfg.draining.Store(true)
+	report = health.Report{}
+	if code := doJSON(t, "GET", srv.URL+"/api/readyz", "", nil, &report); code != http.StatusServiceUnavailable {
+		t.Fatalf("readyz while draining: got %d", code)
+	}
+	if report.Checks["shutdown"].Status != health.StatusFail {
+		t.Fatalf("report = %+v", report)
+	}
+	// liveness doesn't care
+	for _, path := range []string{"/api/healthz", "/api/livez"} {
+		if code := doJSON(t, "GET", srv.URL+path, "", nil, nil); code != http.StatusOK {
+			t.Fatalf("%s: got %d", path, code)
+		}
+	}
+
+	cfg.MaxBodyBytes = 64
+	creds := userIn{Email: strings.Repeat("a", 100) + "@example.com", Password: "hunter2"}
+	if code := doJSON(t, "POST", srv.URL+"/api/users", "", creds, nil); code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("body over the limit: got %d, want 413", code)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	srv, cfg := newTestServer(t)
+	alice := signUp(t, srv, "alice@example.com")
+	doJSON(t, "POST", srv.URL+"/api/login", "", userIn{Email: "alice@example.com", Password: "nope"}, nil)
+	doJSON(t, "POST", srv.URL+"/api/chirps", alice.Token, map[string]string{"body": "hello"}, nil)
+	doJSON(t, "GET", srv.URL+"/api/chirps/"+alice.ID.String(), "", nil, nil)
+	resp, err := http.Get(srv.URL + "/app/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	resp, err = http.Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var body strings.Builder
+	if _, err := io.Copy(&body, resp.Body); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"chirpy_logins_total 1",
+		"chirpy_failed_logins_total 1",
+		"chirpy_chirps_created_total 1",
+		"chirpy_fileserver_hits_total 1",
+		// by pattern, not by the id in the path
+		`chirpy_http_requests_total{code="404",method="GET",route="GET /api/chirps/{chirpID}"} 1`,
+		`chirpy_http_request_duration_seconds_count{code="201",method="POST",route="POST /api/chirps"} 1`,
+	} {
+		if !strings.Contains(body.String(), want) {
+			t.Errorf("metrics missing %q", want)
+		}
+	}
+
+	if got := cfg.Metrics.Hits(); got != 1 {
+		t.Errorf("hits = %d, want 1", got)
+	}
+	cfg.Metrics.ResetHits()
+	if got := cfg.Metrics.Hits(); got != 0 {
+		t.Errorf("hits after reset = %d, want 0", got)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	srv, _ := newTestServer(t)
+	req, err := http.NewRequest("GET", srv.URL+"/api/healthz", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Request-ID", "trace-me")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get("X-Request-ID"); got != "trace-me" {
+		t.Errorf("X-Request-ID = %q, want it echoed", got)
+	}
+	// one gets made up when the client doesn't send it
+	resp, err = http.Get(srv.URL + "/api/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get("X-Request-ID") == "" {
+		t.Error("expected a generated X-Request-ID")
+	}
+}
+
+func TestProblemErrors(t *testing.T) {
+	srv, _ := newTestServer(t)
+	alice := signUp(t, srv, "alice@example.com")
+
+	// raw sends body as is, doJSON would encode it
+	raw := func(method, path, contentType, body string) (int, string, problem) {
+		t.Helper()
+		req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+alice.Token)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var p problem
+		if err := json.NewDecoder(resp.Body).Decode(&p); err != nil {
+			t.Fatalf("decoding problem: %v", err)
+		}
+		return resp.StatusCode, resp.Header.Get("Content-Type"), p
+	}
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		status      int
+		code        string
+		field       string
+	}{
+		{"Malformed", "POST", "/api/chirps", "", `{"body": `, http.StatusBadRequest, codeMalformedJSON, ""},
+		{"Empty", "POST", "/api/login", "", ``, http.StatusBadRequest, codeEmptyBody, ""},
+		{"Unknown Field", "POST", "/api/chirps", "", `{"body": "hi", "user_id": "x"}`, http.StatusBadRequest, codeUnknownField, "user_id"},
+		{"Wrong Type", "POST", "/api/chirps", "", `{"body": 5}`, http.StatusUnprocessableEntity, codeValidation, "body"},
+		{"Too Long", "POST", "/api/chirps", "", `{"body": "` + strings.Repeat("a", 141) + `"}`, http.StatusUnprocessableEntity, codeValidation, "body"},
+		{"Trailing", "POST", "/api/chirps", "", `{"body": "hi"} {}`, http.StatusBadRequest, codeMalformedJSON, ""},
+		{"Not JSON", "POST", "/api/chirps", "text/plain", `hi`, http.StatusUnsupportedMediaType, codeUnsupportedMedia, ""},
+		{"Bad Author", "GET", "/api/chirps?author_id=nope", "", ``, http.StatusBadRequest, "bad_request", ""},
+		{"Taken Email", "POST", "/api/users", "application/json", `{"email": "alice@example.com", "password": "x"}`, http.StatusConflict, "conflict", ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			status, ct, p := raw(tc.method, tc.path, tc.contentType, tc.body)
+			if status != tc.status || p.Status != tc.status {
+				t.Errorf("status = %d (body %d), want %d", status, p.Status, tc.status)
+			}
+			if ct != "application/problem+json" {
+				t.Errorf("content type = %q", ct)
+			}
+			if p.Code != tc.code {
+				t.Errorf("code = %q, want %q", p.Code, tc.code)
+			}
+			if p.Instance != strings.Split(tc.path, "?")[0] || p.RequestID == "" || p.Title == "" {
+				t.Errorf("problem missing request details: %+v", p)
+			}
+			if tc.field != "" && (len(p.Errors) == 0 || p.Errors[0].Field != tc.field) {
+				t.Errorf("errors = %+v, want one for %q", p.Errors, tc.field)
+			}
+		})
+	}
+
+	// every bad field at once
+	_, _, p := raw("POST", "/api/users", "", `{"email": "nope", "password": ""}`)
+	if len(p.Errors) != 2 {
+		t.Errorf("expected both fields reported, got %+v", p.Errors)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	_, cfg := newTestServer(t)
+	cfg.RateLimitRedFactor = 3
+	cfg.Limiter = ratelimit.New(ratelimit.NewMemory(), map[string]ratelimit.Policy{
+		"POST /api/users":  {Limit: 2, Period: time.Hour, Burst: 2},
+		"POST /api/chirps": {Limit: 1, Period: time.Hour, Burst: 1},
+	})
+	srv := httptest.NewServer(cfg.handler())
+	defer srv.Close()
+
+	// sign ups count against the ip
+	alice := signUp(t, srv, "alice@example.com")
+	bob := signUp(t, srv, "bob@example.com")
+	req, err := http.NewRequest("POST", srv.URL+"/api/users", strings.NewReader(`{"email":"eve@example.com","password":"x"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var prob problem
+	json.NewDecoder(resp.Body).Decode(&prob)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests || prob.Code != "too_many_requests" {
+		t.Fatalf("third sign up: got %d %+v", resp.StatusCode, prob)
+	}
+	if resp.Header.Get("Retry-After") == "" || resp.Header.Get("RateLimit-Remaining") != "0" || resp.Header.Get("RateLimit-Limit") != "2" {
+		t.Errorf("headers = %v", resp.Header)
+	}
+
+	// chirps count against the user, so bob isn't held up by alice, and
+	// red users get RateLimitRedFactor times the bucket
+	if err := cfg.DB.UpgradeRedByID(context.Background(), bob.ID); err != nil {
+		t.Fatal(err)
+	}
+	post := func(token, body string) int {
+		t.Helper()
+		return doJSON(t, "POST", srv.URL+"/api/chirps", token, map[string]string{"body": body}, nil)
+	}
+	if code := post(alice.Token, "alice 1"); code != http.StatusCreated {
+		t.Fatalf("first chirp: got %d", code)
+	}
+	if code := post(alice.Token, "alice 2"); code != http.StatusTooManyRequests {
+		t.Fatalf("second chirp: got %d, want 429", code)
+	}
+	for i := range 3 {
+		if code := post(bob.Token, fmt.Sprint("bob ", i)); code != http.StatusCreated {
+			t.Fatalf("red chirp %d: got %d", i, code)
+		}
+	}
+	if code := post(bob.Token, "bob 3"); code != http.StatusTooManyRequests {
+		t.Fatalf("fourth red chirp: got %d, want 429", code)
+	}
+	// looked up once, then cached until the webhook changes it
+	if red, ok := cfg.redUsers.get(bob.ID); !ok || !red {
+		t.Errorf("red cache for bob = %v, %v", red, ok)
+	}
+	req, err = http.NewRequest("POST", srv.URL+"/api/polka/webhooks", strings.NewReader(`{"event":"user.upgraded","data":{"user_id":"`+bob.ID.String()+`"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "ApiKey "+cfg.PolkaKey)
+	if resp, err = http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("webhook: %v, %v", resp, err)
+	}
+	resp.Body.Close()
+	if _, ok := cfg.redUsers.get(bob.ID); ok {
+		t.Error("upgrading didn't clear the red cache")
+	}
+	// routes with no policy aren't limited
+	for range 5 {
+		if code := doJSON(t, "GET", srv.URL+"/api/chirps", "", nil, nil); code != http.StatusOK {
+			t.Fatalf("get chirps: got %d", code)
+		}
+	}
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	srv, cfg := newTestServer(t)
+	alice := signUp(t, srv, "alice@example.com")
+	bob := signUp(t, srv, "bob@example.com")
+
+	post := func(token, key, body string) (*http.Response, string) {
+		t.Helper()
+		req, err := http.NewRequest("POST", srv.URL+"/api/chirps", strings.NewReader(`{"body":"`+body+`"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp, string(b)
+	}
+
+	first, firstBody := post(alice.Token, "k1", "retried")
+	if first.StatusCode != http.StatusCreated || first.Header.Get("Idempotent-Replayed") != "" {
+		t.Fatalf("first: got %d %v", first.StatusCode, first.Header)
+	}
+	// the retry gets the same chirp back rather than a conflict
+	again, againBody := post(alice.Token, "k1", "retried")
+	if again.StatusCode != http.StatusCreated || againBody != firstBody || again.Header.Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("retry: got %d %q, want a replay of %q", again.StatusCode, againBody, firstBody)
+	}
+	if got := again.Header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("replayed Content-Type = %q", got)
+	}
+	chirps, err := cfg.DB.GetChirps(context.Background(), alice.ID)
+	if err != nil || len(chirps) != 1 {
+		t.Fatalf("chirps = %v, %v, want one", chirps, err)
+	}
+
+	// same key, different request
+	resp, body := post(alice.Token, "k1", "something else")
+	if resp.StatusCode != http.StatusUnprocessableEntity || !strings.Contains(body, "idempotency_key_reused") {
+		t.Fatalf("reused key: got %d %s", resp.StatusCode, body)
+	}
+	// keys are per user
+	if resp, _ := post(bob.Token, "k1", "bob's"); resp.StatusCode != http.StatusCreated || resp.Header.Get("Idempotent-Replayed") != "" {
+		t.Fatalf("bob's key: got %d", resp.StatusCode)
+	}
+	// without a key a repeat is a conflict, not a 500
+	if resp, _ := post(alice.Token, "", "retried"); resp.StatusCode != http.StatusConflict {
+		t.Fatalf("duplicate without a key: got %d, want 409", resp.StatusCode)
+	}
+}
+
+// a replay gets the first response's own headers back, but not the ones
+// about its request or set again on the way out
+func TestIdempotencyReplaysHeaders(t *testing.T) {
+	srv, cfg := newTestServer(t)
+	alice := signUp(t, srv, "alice@example.com")
+	calls := 0
+	h := cfg.middlewareIdempotency("POST /things", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Location", "/things/1")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{}`))
+	}))
+	send := func(remaining string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/things", strings.NewReader(`{}`))
+		req.Header.Set("Authorization", "Bearer "+alice.Token)
+		req.Header.Set("Idempotency-Key", "k1")
+		rec := httptest.NewRecorder()
+		rec.Header().Set("RateLimit-Remaining", remaining)
+		rec.Header().Set("X-Request-ID", "req-"+remaining)
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	send("9")
+	again := send("8")
+	if calls != 1 || again.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("handler ran %d times, replayed %q", calls, again.Header().Get("Idempotent-Replayed"))
+	}
+	for name, want := range map[string]string{
+		"Content-Type":        "application/json",
+		"ETag":                `"v1"`,
+		"Location":            "/things/1",
+		"RateLimit-Remaining": "8",
+		"X-Request-ID":        "req-8",
+	} {
+		if got := again.Header().Values(name); len(got) != 1 || got[0] != want {
+			t.Errorf("replayed %s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+// keyTimes notes the expiry idempotency keys are created with.
+type keyTimes struct {
+	store.Store
+	expiresAt time.Time
+}
+
+func (s *keyTimes) CreateIdempotencyKey(ctx context.Context, arg database.CreateIdempotencyKeyParams) (database.IdempotencyKey, error) {
+	s.expiresAt = arg.ExpiresAt
+	return s.Store.CreateIdempotencyKey(ctx, arg)
+}
+
+// timestamp columns have no zone, so a server away from utc must still
+// hand the store utc times and read its utc ones back right
+func TestIdempotencyKeyTimesUTC(t *testing.T) {
+	local := time.Local
+	time.Local = time.FixedZone("UTC+10", 10*60*60)
+	t.Cleanup(func() { time.Local = local })
+
+	srv, cfg := newTestServer(t)
+	db := &keyTimes{Store: cfg.DB}
+	cfg.DB = db
+	alice := signUp(t, srv, "alice@example.com")
+
+	req, err := http.NewRequest("POST", srv.URL+"/api/chirps", strings.NewReader(`{"body":"hi"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+alice.Token)
+	req.Header.Set("Idempotency-Key", "k1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if db.expiresAt.Location() != time.UTC {
+		t.Errorf("key expires at %v, want utc", db.expiresAt)
+	}
+
+	// what a zoneless column gives back, utc wall clock
+	now := time.Now().UTC()
+	running := database.IdempotencyKey{CreatedAt: now, ExpiresAt: now.Add(idempotencyTTL)}
+	if cfg.staleIdempotencyKey(running) {
+		t.Error("a key made just now is stale")
+	}
+	expired := database.IdempotencyKey{CreatedAt: now.Add(-2 * idempotencyTTL), ExpiresAt: now.Add(-time.Minute)}
+	if !cfg.staleIdempotencyKey(expired) {
+		t.Error("an expired key isn't stale")
+	}
+}
+
+// failTouch can't touch conversations, in or out of a transaction.
+type failTouch struct {
+	store.Store
+}
+
+func (s failTouch) TouchConversation(ctx context.Context, id uuid.UUID) error {
+	return errors.New("touch failed")
+}
+
+func (s failTouch) InTx(ctx context.Context, opts *sql.TxOptions, fn func(store.Store) error) error {
+	return s.Store.InTx(ctx, opts, func(tx store.Store) error { return fn(failTouch{tx}) })
+}
+
+// a message is only kept if its conversation moved up for it too
+func TestCreateMessageAtomic(t *testing.T) {
+	srv, cfg := newTestServer(t)
+	alice := signUp(t, srv, "alice@example.com")
+	bob := signUp(t, srv, "bob@example.com")
+	var convo conversationJSON
+	if code := doJSON(t, "POST", srv.URL+"/api/conversations", alice.Token, map[string]any{"member_ids": []uuid.UUID{bob.ID}}, &convo); code != http.StatusCreated {
+		t.Fatalf("create conversation: got %d", code)
+	}
+	path := srv.URL + "/api/conversations/" + convo.ID.String() + "/messages"
+
+	db := cfg.DB
+	cfg.DB = failTouch{db}
+	if code := doJSON(t, "POST", path, alice.Token, map[string]string{"body": "hi"}, nil); code != http.StatusInternalServerError {
+		t.Fatalf("post with a failing touch: got %d, want 500", code)
+	}
+	cfg.DB = db
+	var msgs []messageJSON
+	if code := doJSON(t, "GET", path, alice.Token, nil, &msgs); code != http.StatusOK || len(msgs) != 0 {
+		t.Fatalf("messages = %d %v, want none", code, msgs)
+	}
+}
+
+func TestETags(t *testing.T) {
+	srv, _ := newTestServer(t)
+	alice := signUp(t, srv, "alice@example.com")
+	var chirp chirpJSON
+	if code := doJSON(t, "POST", srv.URL+"/api/chirps", alice.Token, map[string]string{"body": "first"}, &chirp); code != http.StatusCreated {
+		t.Fatalf("post: got %d", code)
+	}
+
+	send := func(method, path string, headers ...string) (*http.Response, string) {
+		t.Helper()
+		req, err := http.NewRequest(method, srv.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+alice.Token)
+		for i := 0; i < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp, string(b)
+	}
+
+	path := "/api/chirps/" + chirp.Id
+	resp, _ := send("GET", path)
+	tag := resp.Header.Get("ETag")
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(tag, `"`) {
+		t.Fatalf("get: got %d, etag %q", resp.StatusCode, tag)
+	}
+	for _, inm := range []string{tag, "W/" + tag, `"nope", ` + tag, "*"} {
+		resp, body := send("GET", path, "If-None-Match", inm)
+		if resp.StatusCode != http.StatusNotModified || body != "" || resp.Header.Get("ETag") != tag {
+			t.Errorf("If-None-Match %s: got %d %q", inm, resp.StatusCode, body)
+		}
+	}
+	if resp, _ := send("GET", path, "If-None-Match", `"nope"`); resp.StatusCode != http.StatusOK {
+		t.Errorf("stale If-None-Match: got %d", resp.StatusCode)
+	}
+
+	// the list has its own version, which moves when a chirp is added
+	resp, _ = send("GET", "/api/chirps")
+	listTag := resp.Header.Get("ETag")
+	if resp, _ := send("GET", "/api/chirps", "If-None-Match", listTag); resp.StatusCode != http.StatusNotModified {
+		t.Fatalf("list If-None-Match: got %d", resp.StatusCode)
+	}
+	if resp, _ := send("GET", "/api/chirps?sort=desc", "If-None-Match", listTag); resp.StatusCode != http.StatusNotModified {
+		t.Fatalf("one chirp is the same either way round: got %d", resp.StatusCode)
+	}
+	doJSON(t, "POST", srv.URL+"/api/chirps", alice.Token, map[string]string{"body": "second"}, nil)
+	if resp, _ := send("GET", "/api/chirps", "If-None-Match", listTag); resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") == listTag {
+		t.Fatalf("list after a new chirp: got %d, etag %q", resp.StatusCode, resp.Header.Get("ETag"))
+	}
+
+	// deletes only go ahead on the version the client saw
+	if resp, body := send("DELETE", path, "If-Match", `"old"`); resp.StatusCode != http.StatusPreconditionFailed {
+		t.Fatalf("If-Match old: got %d %s", resp.StatusCode, body)
+	}
+	if resp, _ := send("DELETE", path, "If-Match", "W/"+tag); resp.StatusCode != http.StatusPreconditionFailed {
+		t.Fatalf("weak If-Match: got %d", resp.StatusCode)
+	}
+	if resp, _ := send("DELETE", path, "If-Match", tag); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("If-Match current: got %d", resp.StatusCode)
+	}
+}
+
+func TestCompressedListing(t *testing.T) {
+	srv, cfg := newTestServer(t)
+	alice := signUp(t, srv, "alice@example.com")
+	for i := range 50 {
+		if _, err := cfg.DB.CreateChirp(context.Background(), database.CreateChirpParams{
+			Body:   fmt.Sprintf("chirp number %d", i),
+			UserID: alice.ID,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the transport only decodes gzip it asked for itself, so this comes
+	// back as it was sent
+	req, _ := http.NewRequest("GET", srv.URL+"/api/chirps?sort=desc", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	// the list's etag is weak, which already covers every encoding
+	if resp.Header.Get("Content-Encoding") != "gzip" || !strings.HasPrefix(resp.Header.Get("ETag"), `W/"`) || strings.Contains(resp.Header.Get("ETag"), "gzip") {
+		t.Fatalf("got encoding %q, etag %s", resp.Header.Get("Content-Encoding"), resp.Header.Get("ETag"))
+	}
+	zr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var chirps []chirpJSON
+	if err := json.NewDecoder(zr).Decode(&chirps); err != nil {
+		t.Fatal(err)
+	}
+	if len(chirps) != 50 || chirps[0].Body != "chirp number 49" || chirps[49].Body != "chirp number 0" {
+		t.Fatalf("got %d chirps, first %+v", len(chirps), chirps[0])
+	}
+
+	// nothing to list is still an array
+	var none []chirpJSON
+	if code := doJSON(t, "GET", srv.URL+"/api/chirps?author_id="+uuid.NewString(), "", nil, &none); code != http.StatusOK || none == nil {
+		t.Fatalf("empty listing: got %d, %v", code, none)
+	}
+}
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		accept   string
+		hasProto bool
+		want     format
+	}{
+		{"", true, formatJSON},
+		{"*/*", true, formatJSON},
+		{"application/msgpack", true, formatMsgpack},
+		{"application/x-protobuf", true, formatProtobuf},
+		{"application/x-protobuf", false, formatJSON},
+		{"application/x-protobuf, application/msgpack;q=0.5", false, formatMsgpack},
+		{"application/json;q=0.1, application/vnd.msgpack", true, formatMsgpack},
+		{"application/*;q=0.2, application/protobuf", true, formatProtobuf},
+		{"text/html", true, formatJSON},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", tt.accept)
+		if got := negotiateFormat(r, tt.hasProto); got != tt.want {
+			t.Errorf("negotiateFormat(%q, %v) = %d, want %d", tt.accept, tt.hasProto, got, tt.want)
+		}
+	}
+}
+
+func TestFormats(t *testing.T) {
+	srv, _ := newTestServer(t)
+	send := func(method, path, token, contentType, accept string, body []byte) (*http.Response, []byte) {
+		t.Helper()
+		req, err := http.NewRequest(method, srv.URL+path, bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		req.Header.Set("Accept", accept)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp, b
+	}
+
+	// msgpack both ways, with the json field names
+	var buf bytes.Buffer
+	if err := newMsgpackEncoder(&buf).Encode(map[string]string{"email": "alice@example.com", "password": "pw"}); err != nil {
+		t.Fatal(err)
+	}
+	resp, body := send("POST", "/api/users", "", mediaMsgpack, mediaMsgpack, buf.Bytes())
+	var user User
+	dec := msgpack.NewDecoder(bytes.NewReader(body))
+	dec.SetCustomStructTag("json")
+	if resp.StatusCode != http.StatusCreated || resp.Header.Get("Content-Type") != mediaMsgpack {
+		t.Fatalf("msgpack signup: got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	if err := dec.Decode(&user); err != nil || user.Email != "alice@example.com" || user.ID == uuid.Nil {
+		t.Fatalf("msgpack user = %+v, %v", user, err)
+	}
+
+	// login has no protobuf message, so it falls back to json
+	login, _ := proto.Marshal(&chirpypb.UserRequest{Email: "alice@example.com", Password: "pw"})
+	resp, body = send("POST", "/api/login", "", mediaProtobuf, mediaProtobuf, login)
+	var session loginResult
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != mediaJSON {
+		t.Fatalf("protobuf login: got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	if err := json.Unmarshal(body, &session); err != nil || session.Token == "" {
+		t.Fatalf("login = %s, %v", body, err)
+	}
+
+	post, _ := proto.Marshal(&chirpypb.ChirpRequest{Body: "hello in protobuf"})
+	resp, body = send("POST", "/api/chirps", session.Token, mediaProtobuf, mediaProtobuf, post)
+	var chirp chirpypb.Chirp
+	if resp.StatusCode != http.StatusCreated || resp.Header.Get("Content-Type") != mediaProtobuf {
+		t.Fatalf("protobuf chirp: got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	if err := proto.Unmarshal(body, &chirp); err != nil || chirp.Body != "hello in protobuf" || chirp.UserId != user.ID.String() {
+		t.Fatalf("protobuf chirp = %v, %v", &chirp, err)
+	}
+
+	resp, body = send("GET", "/api/chirps", "", "", mediaProtobuf, nil)
+	var list chirpypb.ChirpList
+	if err := proto.Unmarshal(body, &list); err != nil || len(list.Chirps) != 1 || list.Chirps[0].Id != chirp.Id {
+		t.Fatalf("protobuf list = %v, %v", &list, err)
+	}
+	tag := resp.Header.Get("ETag")
+	if !strings.Contains(tag, "-protobuf") || !slices.Contains(resp.Header.Values("Vary"), "Accept") {
+		t.Errorf("protobuf list: etag %s, vary %q", tag, resp.Header.Values("Vary"))
+	}
+	// it's the same version of the list, so json isn't modified either
+	req, _ := http.NewRequest("GET", srv.URL+"/api/chirps", nil)
+	req.Header.Set("If-None-Match", tag)
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusNotModified {
+		t.Fatalf("json with the protobuf etag: got %v %v", resp.StatusCode, err)
+	}
+
+	resp, body = send("GET", "/api/chirps", "", "", mediaMsgpack, nil)
+	var chirps []chirpJSON
+	dec = msgpack.NewDecoder(bytes.NewReader(body))
+	dec.SetCustomStructTag("json")
+	if err := dec.Decode(&chirps); err != nil || len(chirps) != 1 || chirps[0].Id != chirp.Id {
+		t.Fatalf("msgpack list = %+v, %v", chirps, err)
+	}
+
+	// errors come in the asked for format too
+	resp, body = send("POST", "/api/chirps", session.Token, mediaProtobuf, mediaProtobuf, []byte{0xff})
+	var p chirpypb.Problem
+	if err := proto.Unmarshal(body, &p); err != nil || p.Status != http.StatusBadRequest || p.Code != codeMalformedBody {
+		t.Fatalf("bad protobuf: got %v, %v", &p, err)
+	}
+	buf.Reset()
+	newMsgpackEncoder(&buf).Encode(map[string]string{"body": "hi", "nope": "x"})
+	resp, body = send("POST", "/api/chirps", session.Token, mediaMsgpack, "", buf.Bytes())
+	if resp.StatusCode != http.StatusBadRequest || !strings.Contains(string(body), codeUnknownField) {
+		t.Fatalf("unknown msgpack field: got %d %s", resp.StatusCode, body)
+	}
+	resp, _ = send("POST", "/api/conversations", session.Token, mediaProtobuf, "", nil)
+	if resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Fatalf("protobuf without a message: got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/frankielb/chirpy/internal/health"
+	"github.com/frankielb/chirpy/internal/logging"
+	"github.com/frankielb/chirpy/internal/migrate"
+	"github.com/frankielb/chirpy/internal/store"
+)
+
+var errDraining = errors.New("shutting down")
+
+// registerChecks adds the readiness checks for what we depend on. Anything
+// new, like a mailer or cache, registers its own check on cfg.Health.
+func (cfg *apiConfig) registerChecks(conn *sql.DB, dbURL string) {
+	cfg.Health.Register("shutdown", func(ctx context.Context) error {
+		if cfg.draining.Load() {
+			return errDraining
+		}
+		return nil
+	})
+	// the memory store has nothing to check
+	if conn == nil {
+		return
+	}
+	driver, _ := store.Driver(dbURL)
+	cfg.Health.Register("database", conn.PingContext)
+	cfg.Health.Register("migrations", func(ctx context.Context) error {
+		return migrate.Check(ctx, conn, driver)
+	})
+}
+
+// livenessHandler only says the process is up, it doesn't look at anything
+// else so a database outage doesn't get us restarted.
+func livenessHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK"))
+}
+
+// readyHandler runs every check and reports each one, 503 if any fail.
+// It's unauthenticated so why a check failed only goes to the log.
+func (cfg *apiConfig) readyHandler(w http.ResponseWriter, r *http.Request) {
+	report := cfg.Health.Run(r.Context())
+	code := http.StatusOK
+	if !report.OK() {
+		code = http.StatusServiceUnavailable
+		for name, result := range report.Checks {
+			if result.Status != health.StatusOK {
+				logging.FromContext(r.Context()).Warn("readiness check failed", "check", name, "err", result.Error)
+			}
+		}
+	}
+	respondJSON(w, r, code, report)
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/frankielb/chirpy/internal/database"
+	"github.com/frankielb/chirpy/internal/httpx"
+	"github.com/frankielb/chirpy/internal/logging"
+	"github.com/frankielb/chirpy/internal/store"
+)
+
+const (
+	headerIdempotencyKey = "Idempotency-Key"
+	headerReplayed       = "Idempotent-Replayed"
+	// how long a key's response is kept for replays
+	idempotencyTTL       = 24 * time.Hour
+	maxIdempotencyKeyLen = 255
+)
+
+// middlewareIdempotency replays the first response to a POST, PUT or DELETE
+// sent with an Idempotency-Key, so a client can safely retry. Keys belong to
+// the logged in user, requests without a good jwt are served as normal.
+func (cfg *apiConfig) middlewareIdempotency(pattern string, next http.Handler) http.Handler {
+	method, _, _ := strings.Cut(pattern, " ")
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodDelete:
+	default:
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(headerIdempotencyKey)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		userID, ok := cfg.tokenUserID(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLen {
+			respondJSONError(w, r, http.StatusBadRequest, "Idempotency-Key is too long", nil)
+			return
+		}
+
+		// the body is part of what makes it the same request, read it
+		// once here and hand the handler a copy
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			respondProblem(w, r, decodeProblem(err), err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256([]byte(r.Method + " " + r.URL.RequestURI() + "\n" + string(body)))
+		hash := hex.EncodeToString(sum[:])
+
+		ids := database.GetIdempotencyKeyParams{UserID: userID, Key: key}
+		prev, err := cfg.DB.GetIdempotencyKey(r.Context(), ids)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+		case err != nil:
+			respondJSONError(w, r, http.StatusInternalServerError, "Couldn't get idempotency key", err)
+			return
+		case cfg.staleIdempotencyKey(prev):
+			if err := cfg.DB.DeleteIdempotencyKey(r.Context(), database.DeleteIdempotencyKeyParams(ids)); err != nil {
+				respondJSONError(w, r, http.StatusInternalServerError, "Couldn't delete idempotency key", err)
+				return
+			}
+		default:
+			replayIdempotent(w, r, prev, hash)
+			return
+		}
+
+		// timestamp columns have no zone, keep everything in utc
+		_, err = cfg.DB.CreateIdempotencyKey(r.Context(), database.CreateIdempotencyKeyParams{
+			UserID:      userID,
+			Key:         key,
+			RequestHash: hash,
+			ExpiresAt:   time.Now().UTC().Add(idempotencyTTL),
+		})
+		if store.IsUniqueViolation(err) {
+			// a retry raced the first request and lost
+			respondIdempotencyInProgress(w, r)
+			return
+		}
+		if err != nil {
+			respondJSONError(w, r, http.StatusInternalServerError, "Couldn't save idempotency key", err)
+			return
+		}
+
+		rec := &responseCapture{StatusRecorder: httpx.NewStatusRecorder(w)}
+		next.ServeHTTP(rec, r)
+		rec.snapshot()
+
+		// the client has its answer, don't let it hanging up lose the save
+		ctx := context.WithoutCancel(r.Context())
+		if rec.Status >= 500 {
+			// nothing happened that a retry would repeat, let it try again
+			err = cfg.DB.DeleteIdempotencyKey(ctx, database.DeleteIdempotencyKeyParams(ids))
+		} else {
+			// a header map always marshals
+			headers, _ := json.Marshal(replayHeaders(rec.header))
+			err = cfg.DB.SaveIdempotencyResponse(ctx, database.SaveIdempotencyResponseParams{
+				UserID:      userID,
+				Key:         key,
+				Status:      sql.NullInt32{Int32: int32(rec.Status), Valid: true},
+				ContentType: rec.header.Get("Content-Type"),
+				Body:        rec.body.Bytes(),
+				Headers:     string(headers),
+			})
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "saving idempotent response", "err", err)
+		}
+	})
+}
+
+// staleIdempotencyKey is true once a key has expired, or its request has run
+// for longer than the server would let it and must have died with us.
+func (cfg *apiConfig) staleIdempotencyKey(k database.IdempotencyKey) bool {
+	now := time.Now().UTC()
+	if now.After(k.ExpiresAt) {
+		return true
+	}
+	return !k.Status.Valid && now.Sub(k.CreatedAt) > cfg.WriteTimeout
+}
+
+// replayIdempotent sends the saved response, if the request matches the one
+// that saved it.
+func replayIdempotent(w http.ResponseWriter, r *http.Request, k database.IdempotencyKey, hash string) {
+	if k.RequestHash != hash {
+		respondProblem(w, r, problem{
+			Status: http.StatusUnprocessableEntity,
+			Code:   "idempotency_key_reused",
+			Detail: "Idempotency-Key was already used for a different request",
+		}, nil)
+		return
+	}
+	if !k.Status.Valid {
+		respondIdempotencyInProgress(w, r)
+		return
+	}
+	// keys saved before headers were kept have none
+	if k.Headers != "" {
+		var saved http.Header
+		if err := json.Unmarshal([]byte(k.Headers), &saved); err != nil {
+			slog.ErrorContext(r.Context(), "reading idempotent response headers", "err", err)
+		}
+		for name, values := range saved {
+			w.Header()[name] = values
+		}
+	}
+	if k.ContentType != "" {
+		w.Header().Set("Content-Type", k.ContentType)
+	}
+	w.Header().Set(headerReplayed, "true")
+	w.WriteHeader(int(k.Status.Int32))
+	w.Write(k.Body)
+}
+
+func respondIdempotencyInProgress(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Retry-After", "1")
+	respondProblem(w, r, problem{
+		Status: http.StatusConflict,
+		Code:   "idempotency_key_in_progress",
+		Detail: "a request with this Idempotency-Key is still running",
+	}, nil)
+}
+
+// notReplayed are the headers a replay doesn't get from the first response.
+// They're about that connection or that request, have their own column, or
+// the middleware the replay goes back through sets them again.
+var notReplayed = map[string]bool{
+	"Connection":          true,
+	"Keep-Alive":          true,
+	"Proxy-Authenticate":  true,
+	"Proxy-Authorization": true,
+	"Proxy-Connection":    true,
+	"Te":                  true,
+	"Trailer":             true,
+	"Transfer-Encoding":   true,
+	"Upgrade":             true,
+	"Content-Length":      true,
+	"Content-Type":        true,
+	"Date":                true,
+	"Retry-After":         true,
+	http.CanonicalHeaderKey(logging.HeaderRequestID): true,
+}
+
+// replayHeaders is the part of h a replay should send again.
+func replayHeaders(h http.Header) http.Header {
+	out := http.Header{}
+	for name, values := range h {
+		if notReplayed[name] || strings.HasPrefix(name, "Ratelimit-") {
+			continue
+		}
+		out[name] = values
+	}
+	// and anything Connection names as hop-by-hop
+	for _, v := range h.Values("Connection") {
+		for _, name := range strings.Split(v, ",") {
+			out.Del(strings.TrimSpace(name))
+		}
+	}
+	return out
+}
+
+// responseCapture keeps a copy of the headers as they're sent and of the
+// body as it's written.
+type responseCapture struct {
+	*httpx.StatusRecorder
+	header http.Header
+	body   bytes.Buffer
+}
+
+// snapshot copies the headers the first time the response starts, before
+// middleware further out, like compression, changes them for this client.
+func (c *responseCapture) snapshot() {
+	if c.header == nil {
+		c.header = c.Header().Clone()
+	}
+}
+
+func (c *responseCapture) WriteHeader(code int) {
+	c.snapshot()
+	c.StatusRecorder.WriteHeader(code)
+}
+
+func (c *responseCapture) Write(b []byte) (int, error) {
+	c.snapshot()
+	n, err := c.StatusRecorder.Write(b)
+	c.body.Write(b[:n])
+	return n, err
+}
+
+// sweepIdempotencyKeys deletes expired keys every so often until ctx is done.
+func sweepIdempotencyKeys(ctx context.Context, db store.Store) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := db.DeleteExpiredIdempotencyKeys(ctx); err != nil {
+				slog.Error("sweeping idempotency keys", "err", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,305 @@
+// Package compress gzips or brotlis responses for clients that take it, and
+// serves static files that were compressed ahead of time.
+package compress
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+// MinSize is the smallest body worth compressing, below it the headers and
+// framing eat most of the saving.
+const MinSize = 1024
+
+// the encodings we can make, best first
+var encodings = []string{"br", "gzip"}
+
+// brotli's default level is too slow to run on every response, 4 is about
+// gzip's speed and still smaller
+const brotliLevel = 4
+
+var pools = map[string]*sync.Pool{
+	"br":   {New: func() any { return brotli.NewWriterLevel(nil, brotliLevel) }},
+	"gzip": {New: func() any { return gzip.NewWriter(nil) }},
+}
+
+// encoder is what gzip.Writer and brotli.Writer have in common.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+// Negotiate picks the one of offered the Accept-Encoding header likes best,
+// offered is in order of our preference for ties. It's "" if none of them
+// are acceptable, which means send it as it is.
+func Negotiate(acceptEncoding string, offered []string) string {
+	q := map[string]float64{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		weight := 1.0
+		if k, v, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(k) == "q" {
+			f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil {
+				continue
+			}
+			weight = f
+		}
+		q[name] = weight
+	}
+	best, bestQ := "", 0.0
+	for _, enc := range offered {
+		w, ok := q[enc]
+		if !ok {
+			w = q["*"]
+		}
+		if w > bestQ {
+			best, bestQ = enc, w
+		}
+	}
+	return best
+}
+
+// Middleware compresses the responses that are worth it. Bodies under
+// MinSize, types that are already compressed like images, and responses
+// the handler encoded itself go out as they are.
+//
+// A compressed response is a different representation, so strong etags get
+// the encoding added, "abc" becomes "abc-gzip". It's taken off again on
+// the way in so handlers only ever see their own etags.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// websockets take over the connection, there's no body to compress
+		if r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		enc := Negotiate(r.Header.Get("Accept-Encoding"), encodings)
+		r = trimETags(r)
+		cw := &writer{ResponseWriter: w, encoding: enc, head: r.Method == http.MethodHead}
+		next.ServeHTTP(cw, r)
+		// not deferred, a handler that panics to cut the connection
+		// mustn't get a tidy end put on its body
+		cw.close()
+	})
+}
+
+// trimETags takes the encoding back off the etags in the conditional
+// headers, whichever encoding they were sent with.
+func trimETags(r *http.Request) *http.Request {
+	var cloned bool
+	for _, name := range []string{"If-None-Match", "If-Match"} {
+		values := r.Header.Values(name)
+		if len(values) == 0 {
+			continue
+		}
+		if !cloned {
+			r = r.Clone(r.Context())
+			cloned = true
+		}
+		trimmed := make([]string, len(values))
+		for i, v := range values {
+			for _, enc := range encodings {
+				v = strings.ReplaceAll(v, `-`+enc+`"`, `"`)
+			}
+			trimmed[i] = v
+		}
+		r.Header[name] = trimmed
+	}
+	return r
+}
+
+// AddVary adds Accept-Encoding to Vary unless it's already there.
+func AddVary(h http.Header) {
+	for _, v := range h.Values("Vary") {
+		for _, f := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(f), "Accept-Encoding") {
+				return
+			}
+		}
+	}
+	h.Add("Vary", "Accept-Encoding")
+}
+
+// compressible is for text-ish types. Anything else, or no type at all, is
+// probably compressed already or not worth the guess.
+func compressible(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	if strings.HasPrefix(mt, "text/") {
+		return true
+	}
+	switch mt {
+	case "application/json", "application/javascript", "application/xml", "image/svg+xml",
+		"application/msgpack", "application/x-protobuf":
+		return true
+	}
+	return strings.HasSuffix(mt, "+json") || strings.HasSuffix(mt, "+xml")
+}
+
+// writer holds the start of the body until there's MinSize of it, then
+// decides whether to compress.
+type writer struct {
+	http.ResponseWriter
+	encoding string
+	head     bool
+
+	status      int
+	wroteHeader bool
+	// the headers have gone out, enc is set if compressing
+	decided bool
+	enc     encoder
+	buf     []byte
+}
+
+func (cw *writer) WriteHeader(code int) {
+	if cw.wroteHeader || cw.decided {
+		return
+	}
+	// 1xx like 103 Early Hints go straight out and the real one follows
+	if code >= 100 && code < 200 {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	cw.status = code
+	cw.wroteHeader = true
+	// there won't be a body to wait for
+	if cw.head || code == http.StatusNoContent || code == http.StatusNotModified {
+		cw.decide(false)
+	}
+}
+
+func (cw *writer) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.decided {
+		if cw.enc != nil {
+			return cw.enc.Write(b)
+		}
+		return cw.ResponseWriter.Write(b)
+	}
+	cw.buf = append(cw.buf, b...)
+	if len(cw.buf) >= MinSize {
+		if err := cw.flushBuf(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// flushBuf decides, then writes out whatever was held back.
+func (cw *writer) flushBuf(compress bool) error {
+	cw.decide(compress)
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if cw.enc != nil {
+		_, err = cw.enc.Write(buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// decide sends the headers, compressing if compress is true and the
+// response is one worth compressing.
+func (cw *writer) decide(compress bool) {
+	if cw.decided {
+		return
+	}
+	cw.decided = true
+	if !cw.wroteHeader {
+		cw.status = http.StatusOK
+	}
+	h := cw.Header()
+	// the handler encoded it itself, eg a precompressed file
+	if h.Get("Content-Encoding") != "" {
+		cw.ResponseWriter.WriteHeader(cw.status)
+		return
+	}
+	AddVary(h)
+	if cw.encoding != "" {
+		tagETag(h, cw.encoding)
+	}
+	compress = compress && cw.encoding != "" &&
+		cw.status >= 200 && cw.status != http.StatusPartialContent &&
+		compressible(h.Get("Content-Type"))
+	if compress {
+		h.Set("Content-Encoding", cw.encoding)
+		h.Del("Content-Length")
+		// ranges are of the uncompressed body
+		h.Del("Accept-Ranges")
+		cw.enc = pools[cw.encoding].Get().(encoder)
+		cw.enc.Reset(cw.ResponseWriter)
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+}
+
+// tagETag adds the encoding to a strong etag. Every response a client
+// that accepts encoding gets has it, compressed or not, so the etag it
+// sends back doesn't depend on how big the body was.
+func tagETag(h http.Header, encoding string) {
+	tag := h.Get("ETag")
+	if len(tag) < 2 || strings.HasPrefix(tag, "W/") || !strings.HasSuffix(tag, `"`) {
+		return
+	}
+	h.Set("ETag", tag[:len(tag)-1]+"-"+encoding+`"`)
+}
+
+func (cw *writer) close() {
+	if !cw.decided {
+		// never reached MinSize
+		cw.flushBuf(false)
+	}
+	if cw.enc != nil {
+		cw.enc.Close()
+		cw.enc.Reset(nil)
+		pools[cw.encoding].Put(cw.enc)
+		cw.enc = nil
+	}
+}
+
+// Flush sends what's been written so far. A handler that flushes is
+// streaming, so it gets compressed even if it's small so far.
+func (cw *writer) Flush() {
+	if !cw.decided {
+		cw.flushBuf(true)
+	}
+	if cw.enc != nil {
+		cw.enc.Flush()
+	}
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController get at the real writer.
+func (cw *writer) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// Hijack hands over the connection, nothing is compressed after that.
+func (cw *writer) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(cw.ResponseWriter).Hijack()
+	if err == nil {
+		cw.decided = true
+	}
+	return conn, rw, err
+}
@@ -0,0 +1,173 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"gzip, deflate, br", "br"},
+		{"br;q=0.5, gzip", "gzip"},
+		{"br;q=0, gzip;q=0", ""},
+		{"*", "br"},
+		{"*;q=0.1, br;q=0", "gzip"},
+		{"identity", ""},
+		{"GZIP;q=0.8", "gzip"},
+		{"gzip;q=nope, br", "br"},
+	}
+	for _, tt := range tests {
+		if got := Negotiate(tt.accept, encodings); got != tt.want {
+			t.Errorf("Negotiate(%q) = %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func decode(t *testing.T, enc string, body []byte) string {
+	t.Helper()
+	var r io.Reader = bytes.NewReader(body)
+	switch enc {
+	case "gzip":
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = zr
+	case "br":
+		r = brotli.NewReader(r)
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestMiddleware(t *testing.T) {
+	big := `[` + strings.Repeat(`{"body":"hello"},`, 200) + `{}]`
+	h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/big":
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("ETag", `"v1"`)
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			// in bits, like a stream
+			for i := 0; i < len(big); i += 100 {
+				w.Write([]byte(big[i:min(i+100, len(big))]))
+			}
+		case "/small":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"ok":true}`))
+		case "/png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte(big))
+		case "/flush":
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("tick"))
+			http.NewResponseController(w).Flush()
+		}
+	}))
+	get := func(path string, headers ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		for i := 0; i < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, enc := range encodings {
+		rec := get("/big", "Accept-Encoding", enc)
+		if got := rec.Header().Get("Content-Encoding"); got != enc {
+			t.Fatalf("%s: Content-Encoding = %q", enc, got)
+		}
+		if rec.Body.Len() >= len(big) {
+			t.Errorf("%s: %d bytes isn't smaller than %d", enc, rec.Body.Len(), len(big))
+		}
+		if got := decode(t, enc, rec.Body.Bytes()); got != big {
+			t.Errorf("%s: body didn't round trip", enc)
+		}
+		if got := rec.Header().Get("Vary"); got != "Accept-Encoding" {
+			t.Errorf("%s: Vary = %q", enc, got)
+		}
+		tag := rec.Header().Get("ETag")
+		if tag != `"v1-`+enc+`"` {
+			t.Errorf("%s: ETag = %s", enc, tag)
+		}
+		// the tag comes back with the encoding on and the handler still matches it
+		rec = get("/big", "Accept-Encoding", enc, "If-None-Match", tag)
+		if rec.Code != http.StatusNotModified || rec.Header().Get("ETag") != tag || rec.Body.Len() != 0 {
+			t.Errorf("%s: If-None-Match got %d, etag %s", enc, rec.Code, rec.Header().Get("ETag"))
+		}
+	}
+
+	rec := get("/big")
+	if rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != big || rec.Header().Get("ETag") != `"v1"` {
+		t.Errorf("no Accept-Encoding: got %q encoded, etag %s", rec.Header().Get("Content-Encoding"), rec.Header().Get("ETag"))
+	}
+	for _, path := range []string{"/small", "/png"} {
+		rec := get(path, "Accept-Encoding", "gzip")
+		if rec.Header().Get("Content-Encoding") != "" {
+			t.Errorf("%s was compressed", path)
+		}
+	}
+	rec = get("/flush", "Accept-Encoding", "gzip")
+	if rec.Header().Get("Content-Encoding") != "gzip" || !rec.Flushed || decode(t, "gzip", rec.Body.Bytes()) != "tick" {
+		t.Errorf("flush: got %q, flushed %v", rec.Header().Get("Content-Encoding"), rec.Flushed)
+	}
+}
+
+func TestFileServer(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, body string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("index.html", "<html>plain</html>")
+	write("index.html.br", "brotli bytes")
+	write("index.html.gz", "gzip bytes")
+	write("app.js", "plain js")
+	h := FileServer(http.Dir(dir))
+
+	tests := []struct {
+		path, accept string
+		encoding     string
+		body         string
+	}{
+		{"/", "gzip, br", "br", "brotli bytes"},
+		{"/", "gzip", "gzip", "gzip bytes"},
+		{"/", "", "", "<html>plain</html>"},
+		{"/app.js", "br", "", "plain js"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		req.Header.Set("Accept-Encoding", tt.accept)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Encoding") != tt.encoding || rec.Body.String() != tt.body {
+			t.Errorf("%s with %q: got %d %q %q", tt.path, tt.accept, rec.Code, rec.Header().Get("Content-Encoding"), rec.Body.String())
+		}
+		if ct := rec.Header().Get("Content-Type"); tt.path == "/" && !strings.HasPrefix(ct, "text/html") {
+			t.Errorf("%s with %q: Content-Type = %q", tt.path, tt.accept, ct)
+		}
+	}
+}
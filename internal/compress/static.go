@@ -0,0 +1,91 @@
+package compress
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// the precompressed siblings FileServer looks for, in the order of encodings
+var extensions = map[string]string{
+	"br":   ".br",
+	"gzip": ".gz",
+}
+
+// FileServer is http.FileServer, except a file with a .br or .gz made next
+// to it ahead of time is sent instead when the client takes that encoding.
+// They can be squeezed at the best level once rather than per request.
+func FileServer(root http.FileSystem) http.Handler {
+	files := http.FileServer(root)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := path.Clean("/" + r.URL.Path)
+		// the file server redirects these, let it
+		if (r.Method != http.MethodGet && r.Method != http.MethodHead) || strings.HasSuffix(r.URL.Path, "/index.html") {
+			files.ServeHTTP(w, r)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/") {
+			name = path.Join(name, "index.html")
+		}
+
+		var offered []string
+		for _, enc := range encodings {
+			if isFile(root, name+extensions[enc]) {
+				offered = append(offered, enc)
+			}
+		}
+		if len(offered) == 0 {
+			files.ServeHTTP(w, r)
+			return
+		}
+		AddVary(w.Header())
+		enc := Negotiate(r.Header.Get("Accept-Encoding"), offered)
+		if enc == "" {
+			files.ServeHTTP(w, r)
+			return
+		}
+
+		f, err := root.Open(name + extensions[enc])
+		if err != nil {
+			files.ServeHTTP(w, r)
+			return
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			files.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", contentType(root, name))
+		w.Header().Set("Content-Encoding", enc)
+		http.ServeContent(w, r, name, info.ModTime(), f)
+	})
+}
+
+func isFile(root http.FileSystem, name string) bool {
+	f, err := root.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	return err == nil && !info.IsDir()
+}
+
+// contentType is the type of the uncompressed file, ServeContent would
+// only sniff the compressed bytes.
+func contentType(root http.FileSystem, name string) string {
+	if ct := mime.TypeByExtension(path.Ext(name)); ct != "" {
+		return ct
+	}
+	f, err := root.Open(name)
+	if err != nil {
+		return "application/octet-stream"
+	}
+	defer f.Close()
+	buf := make([]byte, 512)
+	n, _ := io.ReadFull(f, buf)
+	return http.DetectContentType(buf[:n])
+}
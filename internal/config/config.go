@@ -0,0 +1,415 @@
+// Package config loads the server settings. Each layer overrides the one
+// before it: defaults, a yaml or toml file, environment variables, then
+// flags.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/frankielb/chirpy/internal/logging"
+	"github.com/frankielb/chirpy/internal/ratelimit"
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	// where to listen, eg ":8080"
+	Addr string `yaml:"addr" toml:"addr"`
+	// where the grpc api listens, eg ":9090". Empty, the default, doesn't
+	// serve it, it's for internal services and shouldn't be open by accident
+	GRPCAddr string `yaml:"grpc_addr" toml:"grpc_addr"`
+	// serve grpc reflection so grpcurl and friends can list the methods,
+	// it shows anyone who can connect the whole api
+	GRPCReflection bool `yaml:"grpc_reflection" toml:"grpc_reflection"`
+	// postgres://, sqlite:path, or empty for the in-memory store
+	DBURL string `yaml:"db_url" toml:"db_url"`
+	// apply pending migrations before serving
+	AutoMigrate bool `yaml:"auto_migrate" toml:"auto_migrate"`
+	// "dev" turns on the reset endpoint
+	Platform string `yaml:"platform" toml:"platform"`
+	// signs the jwts, required
+	Secret string `yaml:"secret" toml:"secret"`
+	// api key polka sends with its webhooks
+	PolkaKey string `yaml:"polka_key" toml:"polka_key"`
+	// who can start dms, "everyone" or "red"
+	DMPolicy string `yaml:"dm_policy" toml:"dm_policy"`
+
+	AccessTokenTTL  time.Duration `yaml:"access_token_ttl" toml:"access_token_ttl"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl" toml:"refresh_token_ttl"`
+	MaxChirpLength  int           `yaml:"max_chirp_length" toml:"max_chirp_length"`
+
+	// http server limits, slow clients get cut off by these
+	ReadTimeout       time.Duration `yaml:"read_timeout" toml:"read_timeout"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" toml:"read_header_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" toml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" toml:"idle_timeout"`
+	MaxHeaderBytes    int           `yaml:"max_header_bytes" toml:"max_header_bytes"`
+	MaxBodyBytes      int           `yaml:"max_body_bytes" toml:"max_body_bytes"`
+	// on SIGTERM readiness fails for DrainDelay so load balancers stop
+	// sending traffic, then in flight requests get ShutdownTimeout to finish
+	DrainDelay      time.Duration `yaml:"drain_delay" toml:"drain_delay"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+	// how long each readiness check gets
+	HealthTimeout time.Duration `yaml:"health_timeout" toml:"health_timeout"`
+
+	// debug, info, warn or error
+	LogLevel string `yaml:"log_level" toml:"log_level"`
+	// json or text
+	LogFormat string `yaml:"log_format" toml:"log_format"`
+	// none, stdout or otlp, otlp is set up with the usual OTEL_ env vars
+	TraceExporter string `yaml:"trace_exporter" toml:"trace_exporter"`
+	// where the stdout exporter writes instead, if set
+	TraceFile string `yaml:"trace_file" toml:"trace_file"`
+
+	// memory, postgres to share limits between instances, or off
+	RateLimitBackend string `yaml:"rate_limit_backend" toml:"rate_limit_backend"`
+	// policies by route pattern, eg "POST /api/chirps": "30/1m burst 10",
+	// or grpc method, eg "/chirpy.v1.ChirpService/CreateChirp". "*" is
+	// every other route and method. Set ones are merged over the defaults.
+	RateLimits map[string]string `yaml:"rate_limits" toml:"rate_limits"`
+	// chirpy red users get their limits multiplied by this
+	RateLimitRedFactor float64 `yaml:"rate_limit_red_factor" toml:"rate_limit_red_factor"`
+	// take the client ip from X-Forwarded-For, only turn on behind a proxy
+	// that sets it or clients can pick their own ip
+	TrustProxy bool `yaml:"trust_proxy" toml:"trust_proxy"`
+	// gzip or brotli responses for clients that take it, turn off if a
+	// proxy in front already does
+	Compression bool `yaml:"compression" toml:"compression"`
+}
+
+// defaultRateLimits cover the endpoints worth flooding, and leave health
+// checks and scrapes alone.
+func defaultRateLimits() map[string]string {
+	return map[string]string{
+		ratelimit.DefaultRoute:                              "300/1m",
+		"POST /api/users":                                   "5/1h",
+		"POST /api/login":                                   "10/1m",
+		"POST /api/chirps":                                  "30/1m burst 10",
+		"POST /api/chirps/{chirpID}/reports":                "20/1h",
+		"POST /api/conversations/{conversationID}/messages": "60/1m",
+		"GET /api/healthz":                                  "off",
+		"GET /api/livez":                                    "off",
+		"GET /api/readyz":                                   "off",
+		"GET /metrics":                                      "off",
+		// the same again for the grpc api
+		"/chirpy.v1.UserService/CreateUser":   "5/1h",
+		"/chirpy.v1.UserService/Login":        "10/1m",
+		"/chirpy.v1.ChirpService/CreateChirp": "30/1m burst 10",
+		"/grpc.health.v1.Health/Check":        "off",
+		"/grpc.health.v1.Health/Watch":        "off",
+	}
+}
+
+// Default is what you get with no file, env or flags.
+func Default() Config {
+	return Config{
+		Addr:            ":8080",
+		DMPolicy:        "everyone",
+		AccessTokenTTL:  time.Hour,
+		RefreshTokenTTL: 60 * 24 * time.Hour,
+		MaxChirpLength:  140,
+
+		ReadTimeout:       15 * time.Second,
+		ReadHeaderTimeout: 5 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+		MaxHeaderBytes:    64 << 10,
+		MaxBodyBytes:      1 << 20,
+		ShutdownTimeout:   30 * time.Second,
+		HealthTimeout:     2 * time.Second,
+		LogLevel:          "info",
+		LogFormat:         "json",
+		TraceExporter:     "none",
+
+		RateLimitBackend:   "memory",
+		RateLimits:         defaultRateLimits(),
+		RateLimitRedFactor: 2,
+		Compression:        true,
+	}
+}
+
+// Load builds the config from the file named by -config or CHIRPY_CONFIG,
+// then getenv, then the flags in args. It returns the args left after the
+// flags, which is the subcommand. It doesn't call Validate.
+func Load(args []string, getenv func(string) string) (Config, []string, error) {
+	// first pass is only to find the config file
+	cfg := Default()
+	path := getenv("CHIRPY_CONFIG")
+	fs := flagSet(&cfg, &path, io.Discard)
+	if err := fs.Parse(args); err != nil {
+		return cfg, nil, err
+	}
+
+	cfg = Default()
+	if path != "" {
+		if err := loadFile(&cfg, path); err != nil {
+			return cfg, nil, err
+		}
+	}
+	if err := loadEnv(&cfg, getenv); err != nil {
+		return cfg, nil, err
+	}
+
+	// flags again on top of the file and env, so they win
+	fs = flagSet(&cfg, &path, io.Discard)
+	if err := fs.Parse(args); err != nil {
+		return cfg, nil, err
+	}
+	return cfg, fs.Args(), nil
+}
+
+// Usage prints the flags and their env vars.
+func Usage(w io.Writer) {
+	cfg := Default()
+	var path string
+	fs := flagSet(&cfg, &path, w)
+	fs.PrintDefaults()
+}
+
+func flagSet(cfg *Config, path *string, out io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet("chirpy", flag.ContinueOnError)
+	fs.SetOutput(out)
+	fs.StringVar(path, "config", *path, "yaml or toml config file (CHIRPY_CONFIG)")
+	fs.StringVar(&cfg.Addr, "addr", cfg.Addr, "address to listen on (ADDR)")
+	fs.StringVar(&cfg.GRPCAddr, "grpc-addr", cfg.GRPCAddr, "address for the grpc api, eg :9090, off when empty (GRPC_ADDR)")
+	fs.BoolVar(&cfg.GRPCReflection, "grpc-reflection", cfg.GRPCReflection, "serve grpc reflection (GRPC_REFLECTION)")
+	fs.StringVar(&cfg.DBURL, "db-url", cfg.DBURL, "postgres://, sqlite:path or empty for memory (DB_URL)")
+	fs.BoolVar(&cfg.AutoMigrate, "auto-migrate", cfg.AutoMigrate, "apply pending database migrations before serving (AUTO_MIGRATE)")
+	fs.StringVar(&cfg.Platform, "platform", cfg.Platform, "dev enables /admin/reset (PLATFORM)")
+	fs.StringVar(&cfg.Secret, "secret", cfg.Secret, "jwt signing secret (SECRET)")
+	fs.StringVar(&cfg.PolkaKey, "polka-key", cfg.PolkaKey, "polka webhook api key (POLKA_KEY)")
+	fs.StringVar(&cfg.DMPolicy, "dm-policy", cfg.DMPolicy, "who can send dms, everyone or red (DM_POLICY)")
+	fs.DurationVar(&cfg.AccessTokenTTL, "access-token-ttl", cfg.AccessTokenTTL, "jwt lifetime (ACCESS_TOKEN_TTL)")
+	fs.DurationVar(&cfg.RefreshTokenTTL, "refresh-token-ttl", cfg.RefreshTokenTTL, "refresh token lifetime (REFRESH_TOKEN_TTL)")
+	fs.IntVar(&cfg.MaxChirpLength, "max-chirp-length", cfg.MaxChirpLength, "longest chirp body allowed (MAX_CHIRP_LENGTH)")
+	fs.DurationVar(&cfg.ReadTimeout, "read-timeout", cfg.ReadTimeout, "max time to read a whole request (READ_TIMEOUT)")
+	fs.DurationVar(&cfg.ReadHeaderTimeout, "read-header-timeout", cfg.ReadHeaderTimeout, "max time to read request headers (READ_HEADER_TIMEOUT)")
+	fs.DurationVar(&cfg.WriteTimeout, "write-timeout", cfg.WriteTimeout, "max time to write a response (WRITE_TIMEOUT)")
+	fs.DurationVar(&cfg.IdleTimeout, "idle-timeout", cfg.IdleTimeout, "how long keep-alive connections stay open (IDLE_TIMEOUT)")
+	fs.IntVar(&cfg.MaxHeaderBytes, "max-header-bytes", cfg.MaxHeaderBytes, "largest request headers allowed (MAX_HEADER_BYTES)")
+	fs.IntVar(&cfg.MaxBodyBytes, "max-body-bytes", cfg.MaxBodyBytes, "largest request body allowed (MAX_BODY_BYTES)")
+	fs.DurationVar(&cfg.DrainDelay, "drain-delay", cfg.DrainDelay, "how long to report not ready before shutting down (DRAIN_DELAY)")
+	fs.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", cfg.ShutdownTimeout, "how long in flight requests get on shutdown (SHUTDOWN_TIMEOUT)")
+	fs.DurationVar(&cfg.HealthTimeout, "health-timeout", cfg.HealthTimeout, "how long each readiness check gets (HEALTH_TIMEOUT)")
+	fs.StringVar(&cfg.LogLevel, "log-level", cfg.LogLevel, "debug, info, warn or error (LOG_LEVEL)")
+	fs.StringVar(&cfg.LogFormat, "log-format", cfg.LogFormat, "json or text (LOG_FORMAT)")
+	fs.StringVar(&cfg.TraceExporter, "trace-exporter", cfg.TraceExporter, "none, stdout or otlp (TRACE_EXPORTER)")
+	fs.StringVar(&cfg.TraceFile, "trace-file", cfg.TraceFile, "file for the stdout trace exporter (TRACE_FILE)")
+	fs.StringVar(&cfg.RateLimitBackend, "rate-limit-backend", cfg.RateLimitBackend, "memory, postgres or off (RATE_LIMIT_BACKEND)")
+	fs.Func("rate-limits", `policies as "route=policy;...", eg "POST /api/chirps=30/1m burst 10" (RATE_LIMITS)`, func(s string) error {
+		return parseRateLimits(cfg.RateLimits, s)
+	})
+	fs.Float64Var(&cfg.RateLimitRedFactor, "rate-limit-red-factor", cfg.RateLimitRedFactor, "multiplier on chirpy red users' limits (RATE_LIMIT_RED_FACTOR)")
+	fs.BoolVar(&cfg.TrustProxy, "trust-proxy", cfg.TrustProxy, "use X-Forwarded-For for the client ip (TRUST_PROXY)")
+	fs.BoolVar(&cfg.Compression, "compression", cfg.Compression, "gzip or brotli responses when the client accepts it (COMPRESSION)")
+	return fs
+}
+
+// parseRateLimits merges "route=policy;route=policy" into limits. The
+// policies are checked by Validate.
+func parseRateLimits(limits map[string]string, s string) error {
+	for _, entry := range strings.Split(s, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		route, policy, ok := strings.Cut(entry, "=")
+		if !ok {
+			return fmt.Errorf("rate limit %q should be route=policy", entry)
+		}
+		limits[strings.TrimSpace(route)] = strings.TrimSpace(policy)
+	}
+	return nil
+}
+
+// loadFile reads toml for a .toml file and yaml for anything else.
+func loadFile(cfg *Config, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	defer f.Close()
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		md, err := toml.NewDecoder(f).Decode(cfg)
+		if err != nil {
+			return fmt.Errorf("config: %s: %w", path, err)
+		}
+		// catch typos in key names, like the yaml decoder does
+		if keys := md.Undecoded(); len(keys) > 0 {
+			return fmt.Errorf("config: %s: unknown field %q", path, keys[0].String())
+		}
+		return nil
+	}
+	dec := yaml.NewDecoder(f)
+	// catch typos in key names
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config: %s: %w", path, err)
+	}
+	return nil
+}
+
+func loadEnv(cfg *Config, getenv func(string) string) error {
+	strs := map[string]*string{
+		"ADDR":               &cfg.Addr,
+		"GRPC_ADDR":          &cfg.GRPCAddr,
+		"DB_URL":             &cfg.DBURL,
+		"PLATFORM":           &cfg.Platform,
+		"SECRET":             &cfg.Secret,
+		"POLKA_KEY":          &cfg.PolkaKey,
+		"DM_POLICY":          &cfg.DMPolicy,
+		"LOG_LEVEL":          &cfg.LogLevel,
+		"LOG_FORMAT":         &cfg.LogFormat,
+		"TRACE_EXPORTER":     &cfg.TraceExporter,
+		"TRACE_FILE":         &cfg.TraceFile,
+		"RATE_LIMIT_BACKEND": &cfg.RateLimitBackend,
+	}
+	for key, p := range strs {
+		if v := getenv(key); v != "" {
+			*p = v
+		}
+	}
+	durations := map[string]*time.Duration{
+		"ACCESS_TOKEN_TTL":    &cfg.AccessTokenTTL,
+		"REFRESH_TOKEN_TTL":   &cfg.RefreshTokenTTL,
+		"READ_TIMEOUT":        &cfg.ReadTimeout,
+		"READ_HEADER_TIMEOUT": &cfg.ReadHeaderTimeout,
+		"WRITE_TIMEOUT":       &cfg.WriteTimeout,
+		"IDLE_TIMEOUT":        &cfg.IdleTimeout,
+		"DRAIN_DELAY":         &cfg.DrainDelay,
+		"SHUTDOWN_TIMEOUT":    &cfg.ShutdownTimeout,
+		"HEALTH_TIMEOUT":      &cfg.HealthTimeout,
+	}
+	for key, p := range durations {
+		if v := getenv(key); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return fmt.Errorf("config: %s: %w", key, err)
+			}
+			*p = d
+		}
+	}
+	ints := map[string]*int{
+		"MAX_CHIRP_LENGTH": &cfg.MaxChirpLength,
+		"MAX_HEADER_BYTES": &cfg.MaxHeaderBytes,
+		"MAX_BODY_BYTES":   &cfg.MaxBodyBytes,
+	}
+	for key, p := range ints {
+		if v := getenv(key); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("config: %s: %w", key, err)
+			}
+			*p = n
+		}
+	}
+	bools := map[string]*bool{
+		"AUTO_MIGRATE":    &cfg.AutoMigrate,
+		"GRPC_REFLECTION": &cfg.GRPCReflection,
+		"TRUST_PROXY":     &cfg.TrustProxy,
+		"COMPRESSION":     &cfg.Compression,
+	}
+	for key, p := range bools {
+		if v := getenv(key); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("config: %s: %w", key, err)
+			}
+			*p = b
+		}
+	}
+	if v := getenv("RATE_LIMIT_RED_FACTOR"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("config: RATE_LIMIT_RED_FACTOR: %w", err)
+		}
+		cfg.RateLimitRedFactor = f
+	}
+	if v := getenv("RATE_LIMITS"); v != "" {
+		if err := parseRateLimits(cfg.RateLimits, v); err != nil {
+			return fmt.Errorf("config: RATE_LIMITS: %w", err)
+		}
+	}
+	return nil
+}
+
+// Validate checks the config is good enough to serve with.
+func (c Config) Validate() error {
+	var errs []error
+	if c.Addr == "" {
+		errs = append(errs, errors.New("addr is empty"))
+	}
+	if c.Secret == "" {
+		errs = append(errs, errors.New("secret is empty, set SECRET so tokens aren't signed with an empty key"))
+	}
+	if c.DMPolicy != "everyone" && c.DMPolicy != "red" {
+		errs = append(errs, fmt.Errorf("dm_policy %q should be everyone or red", c.DMPolicy))
+	}
+	if c.AccessTokenTTL <= 0 {
+		errs = append(errs, errors.New("access_token_ttl must be positive"))
+	}
+	if c.RefreshTokenTTL <= 0 {
+		errs = append(errs, errors.New("refresh_token_ttl must be positive"))
+	}
+	if c.MaxChirpLength <= 0 {
+		errs = append(errs, errors.New("max_chirp_length must be positive"))
+	}
+	if c.MaxHeaderBytes <= 0 || c.MaxBodyBytes <= 0 {
+		errs = append(errs, errors.New("max_header_bytes and max_body_bytes must be positive"))
+	}
+	// zero timeouts mean none at all, which is what we're trying to avoid
+	if c.ReadHeaderTimeout <= 0 || c.ReadTimeout <= 0 || c.WriteTimeout <= 0 || c.IdleTimeout <= 0 {
+		errs = append(errs, errors.New("read, read header, write and idle timeouts must be positive"))
+	}
+	if c.HealthTimeout <= 0 {
+		errs = append(errs, errors.New("health_timeout must be positive"))
+	}
+	if c.DrainDelay < 0 || c.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("drain_delay can't be negative and shutdown_timeout must be positive"))
+	}
+	if _, err := logging.New(io.Discard, c.LogLevel, c.LogFormat); err != nil {
+		errs = append(errs, err)
+	}
+	switch c.TraceExporter {
+	case "none", "stdout", "otlp":
+	default:
+		errs = append(errs, fmt.Errorf("trace_exporter %q should be none, stdout or otlp", c.TraceExporter))
+	}
+	switch c.RateLimitBackend {
+	case "memory", "postgres", "off":
+	default:
+		errs = append(errs, fmt.Errorf("rate_limit_backend %q should be memory, postgres or off", c.RateLimitBackend))
+	}
+	if _, err := c.RateLimitPolicies(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.RateLimitRedFactor <= 0 {
+		errs = append(errs, errors.New("rate_limit_red_factor must be positive"))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	return nil
+}
+
+// RateLimitPolicies parses RateLimits.
+func (c Config) RateLimitPolicies() (map[string]ratelimit.Policy, error) {
+	policies := map[string]ratelimit.Policy{}
+	var errs []error
+	for route, s := range c.RateLimits {
+		p, err := ratelimit.ParsePolicy(s)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("rate_limits %q: %w", route, err))
+			continue
+		}
+		policies[route] = p
+	}
+	return policies, errors.Join(errs...)
+}
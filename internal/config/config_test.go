@@ -0,0 +1,138 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func env(vars map[string]string) func(string) string {
+	return func(key string) string { return vars[key] }
+}
+
+func TestLoadLayers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chirpy.yaml")
+	file := "addr: :9000\nsecret: from-file\nplatform: dev\naccess_token_ttl: 30m\n"
+	if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, args, err := Load(
+		[]string{"-config", path, "-addr", ":7000", "migrate", "up"},
+		env(map[string]string{"SECRET": "from-env", "MAX_CHIRP_LENGTH": "280"}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// flag beats file, env beats file, file beats default
+	if cfg.Addr != ":7000" || cfg.Secret != "from-env" || cfg.Platform != "dev" {
+		t.Fatalf("cfg = %+v", cfg)
+	}
+	if cfg.AccessTokenTTL != 30*time.Minute || cfg.MaxChirpLength != 280 || cfg.RefreshTokenTTL != Default().RefreshTokenTTL {
+		t.Fatalf("cfg = %+v", cfg)
+	}
+	if strings.Join(args, " ") != "migrate up" {
+		t.Fatalf("args = %v", args)
+	}
+}
+
+func TestLoadTOML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chirpy.toml")
+	file := "addr = \":9000\"\naccess_token_ttl = \"30m\"\ntrust_proxy = true\n\n[rate_limits]\n\"POST /api/chirps\" = \"100/1m\"\n"
+	if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, _, err := Load(nil, env(map[string]string{"CHIRPY_CONFIG": path}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Addr != ":9000" || cfg.AccessTokenTTL != 30*time.Minute || !cfg.TrustProxy {
+		t.Fatalf("cfg = %+v", cfg)
+	}
+	// merged over the defaults, like yaml
+	if cfg.RateLimits["POST /api/chirps"] != "100/1m" || cfg.RateLimits["*"] != Default().RateLimits["*"] {
+		t.Fatalf("rate_limits = %v", cfg.RateLimits)
+	}
+
+	if err := os.WriteFile(path, []byte("secrett = \"typo\"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Load(nil, env(map[string]string{"CHIRPY_CONFIG": path})); err == nil {
+		t.Error("expected an error for an unknown key")
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chirpy.yaml")
+	if err := os.WriteFile(path, []byte("secrett: typo\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Load(nil, env(map[string]string{"CHIRPY_CONFIG": path})); err == nil {
+		t.Error("expected an error for an unknown key")
+	}
+	if _, _, err := Load(nil, env(map[string]string{"ACCESS_TOKEN_TTL": "soon"})); err == nil {
+		t.Error("expected an error for a bad duration")
+	}
+	if _, _, err := Load([]string{"-nope"}, env(nil)); err == nil {
+		t.Error("expected an error for an unknown flag")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg := Default()
+	err := cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "secret is empty") {
+		t.Fatalf("empty secret: got %v", err)
+	}
+	cfg.Secret = "s"
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	cfg.LogLevel = "loud"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "bad level") {
+		t.Fatalf("bad log level: got %v", err)
+	}
+	cfg.DMPolicy = "friends"
+	cfg.MaxChirpLength = 0
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("expected errors")
+	}
+}
+
+func TestRateLimits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chirpy.yaml")
+	file := "rate_limits:\n  \"POST /api/chirps\": \"100/1m\"\n"
+	if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, _, err := Load(
+		[]string{"-config", path, "-rate-limits", "GET /api/chirps=off"},
+		env(map[string]string{"RATE_LIMITS": "POST /api/login=3/1m; POST /api/users = 1/1h"}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// each layer adds to the defaults rather than replacing them
+	want := map[string]string{
+		"*":                "300/1m",
+		"POST /api/chirps": "100/1m",
+		"POST /api/login":  "3/1m",
+		"POST /api/users":  "1/1h",
+		"GET /api/chirps":  "off",
+	}
+	for route, policy := range want {
+		if cfg.RateLimits[route] != policy {
+			t.Errorf("rate_limits[%q] = %q, want %q", route, cfg.RateLimits[route], policy)
+		}
+	}
+	cfg.Secret = "s"
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	cfg.RateLimits["POST /api/chirps"] = "lots"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "POST /api/chirps") {
+		t.Fatalf("bad policy: got %v", err)
+	}
+}
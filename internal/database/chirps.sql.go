@@ -7,6 +7,7 @@ package database
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -20,7 +21,7 @@ VALUES (
     $1,
     $2
 )
-RETURNING id, created_at, updated_at, body, user_id
+RETURNING id, created_at, updated_at, body, user_id, hidden_at
 `
 
 type CreateChirpParams struct {
@@ -37,6 +38,7 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.HiddenAt,
 	)
 	return i, err
 }
@@ -51,8 +53,29 @@ func (q *Queries) DeleteChirpByID(ctx context.Context, id uuid.UUID) error {
 	return err
 }
 
+const deleteChirpIfUnchanged = `-- name: DeleteChirpIfUnchanged :execrows
+DELETE FROM chirps
+WHERE id = $1 AND user_id = $2 AND updated_at = $3
+`
+
+type DeleteChirpIfUnchangedParams struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	UpdatedAt time.Time
+}
+
+// only while the user's chirp is still the version they saw, no rows
+// means it's changed or gone
+func (q *Queries) DeleteChirpIfUnchanged(ctx context.Context, arg DeleteChirpIfUnchangedParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteChirpIfUnchanged, arg.ID, arg.UserID, arg.UpdatedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const getChirp = `-- name: GetChirp :one
-SELECT id, created_at, updated_at, body, user_id FROM chirps
+SELECT id, created_at, updated_at, body, user_id, hidden_at FROM chirps
 WHERE id = $1
 `
 
@@ -65,17 +88,30 @@ func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.HiddenAt,
 	)
 	return i, err
 }
 
 const getChirps = `-- name: GetChirps :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
+SELECT id, created_at, updated_at, body, user_id, hidden_at FROM chirps
+WHERE hidden_at IS NULL
+AND NOT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (user_blocks.blocker_id = $1 AND user_blocks.blocked_id = chirps.user_id)
+    OR (user_blocks.blocker_id = chirps.user_id AND user_blocks.blocked_id = $1)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM user_mutes
+    WHERE user_mutes.muter_id = $1 AND user_mutes.muted_id = chirps.user_id
+)
 ORDER BY created_at ASC
 `
 
-func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirps)
+// viewer_id hides chirps from users blocked either way or muted by the
+// viewer, pass uuid.Nil for anonymous requests
+func (q *Queries) GetChirps(ctx context.Context, viewerID uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirps, viewerID)
 	if err != nil {
 		return nil, err
 	}
@@ -89,6 +125,7 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.HiddenAt,
 		); err != nil {
 			return nil, err
 		}
@@ -104,13 +141,312 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 }
 
 const getChirpsByUser = `-- name: GetChirpsByUser :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
+SELECT id, created_at, updated_at, body, user_id, hidden_at FROM chirps
 WHERE user_id = $1
+AND hidden_at IS NULL
+AND NOT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (user_blocks.blocker_id = $2 AND user_blocks.blocked_id = chirps.user_id)
+    OR (user_blocks.blocker_id = chirps.user_id AND user_blocks.blocked_id = $2)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM user_mutes
+    WHERE user_mutes.muter_id = $2 AND user_mutes.muted_id = chirps.user_id
+)
 ORDER BY created_at ASC
 `
 
-func (q *Queries) GetChirpsByUser(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirpsByUser, userID)
+type GetChirpsByUserParams struct {
+	UserID   uuid.UUID
+	ViewerID uuid.UUID
+}
+
+func (q *Queries) GetChirpsByUser(ctx context.Context, arg GetChirpsByUserParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByUser, arg.UserID, arg.ViewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.HiddenAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpsByUserPage = `-- name: GetChirpsByUserPage :many
+SELECT id, created_at, updated_at, body, user_id, hidden_at FROM chirps
+WHERE user_id = $1
+AND hidden_at IS NULL
+AND (created_at > $2 OR (created_at = $2 AND id > $3))
+AND NOT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (user_blocks.blocker_id = $4 AND user_blocks.blocked_id = chirps.user_id)
+    OR (user_blocks.blocker_id = chirps.user_id AND user_blocks.blocked_id = $4)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM user_mutes
+    WHERE user_mutes.muter_id = $4 AND user_mutes.muted_id = chirps.user_id
+)
+ORDER BY created_at ASC, id ASC
+LIMIT $5
+`
+
+type GetChirpsByUserPageParams struct {
+	UserID    uuid.UUID
+	CreatedAt time.Time
+	ID        uuid.UUID
+	ViewerID  uuid.UUID
+	Limit     int32
+}
+
+// the page of GetChirpsByUser after the chirp at created_at and id,
+// so a listing can be read a bit at a time
+func (q *Queries) GetChirpsByUserPage(ctx context.Context, arg GetChirpsByUserPageParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByUserPage,
+		arg.UserID,
+		arg.CreatedAt,
+		arg.ID,
+		arg.ViewerID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.HiddenAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpsByUserPageDesc = `-- name: GetChirpsByUserPageDesc :many
+SELECT id, created_at, updated_at, body, user_id, hidden_at FROM chirps
+WHERE user_id = $1
+AND hidden_at IS NULL
+AND (created_at < $2 OR (created_at = $2 AND id < $3))
+AND NOT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (user_blocks.blocker_id = $4 AND user_blocks.blocked_id = chirps.user_id)
+    OR (user_blocks.blocker_id = chirps.user_id AND user_blocks.blocked_id = $4)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM user_mutes
+    WHERE user_mutes.muter_id = $4 AND user_mutes.muted_id = chirps.user_id
+)
+ORDER BY created_at DESC, id DESC
+LIMIT $5
+`
+
+type GetChirpsByUserPageDescParams struct {
+	UserID    uuid.UUID
+	CreatedAt time.Time
+	ID        uuid.UUID
+	ViewerID  uuid.UUID
+	Limit     int32
+}
+
+// newest first, otherwise GetChirpsByUserPage
+func (q *Queries) GetChirpsByUserPageDesc(ctx context.Context, arg GetChirpsByUserPageDescParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByUserPageDesc,
+		arg.UserID,
+		arg.CreatedAt,
+		arg.ID,
+		arg.ViewerID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.HiddenAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpsByUserVersion = `-- name: GetChirpsByUserVersion :one
+SELECT COUNT(*) AS total,
+    md5(COALESCE(string_agg(id::text || ' ' || updated_at::text, ',' ORDER BY id), '')) AS digest
+FROM chirps
+WHERE user_id = $1
+AND hidden_at IS NULL
+AND NOT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (user_blocks.blocker_id = $2 AND user_blocks.blocked_id = chirps.user_id)
+    OR (user_blocks.blocker_id = chirps.user_id AND user_blocks.blocked_id = $2)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM user_mutes
+    WHERE user_mutes.muter_id = $2 AND user_mutes.muted_id = chirps.user_id
+)
+`
+
+type GetChirpsByUserVersionParams struct {
+	UserID   uuid.UUID
+	ViewerID uuid.UUID
+}
+
+type GetChirpsByUserVersionRow struct {
+	Total  int64
+	Digest string
+}
+
+// how many chirps GetChirpsByUser has and a digest of which ones at which
+// version, enough to version the listing without reading it
+func (q *Queries) GetChirpsByUserVersion(ctx context.Context, arg GetChirpsByUserVersionParams) (GetChirpsByUserVersionRow, error) {
+	row := q.db.QueryRowContext(ctx, getChirpsByUserVersion, arg.UserID, arg.ViewerID)
+	var i GetChirpsByUserVersionRow
+	err := row.Scan(&i.Total, &i.Digest)
+	return i, err
+}
+
+const getChirpsPage = `-- name: GetChirpsPage :many
+SELECT id, created_at, updated_at, body, user_id, hidden_at FROM chirps
+WHERE hidden_at IS NULL
+AND (created_at > $1 OR (created_at = $1 AND id > $2))
+AND NOT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (user_blocks.blocker_id = $3 AND user_blocks.blocked_id = chirps.user_id)
+    OR (user_blocks.blocker_id = chirps.user_id AND user_blocks.blocked_id = $3)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM user_mutes
+    WHERE user_mutes.muter_id = $3 AND user_mutes.muted_id = chirps.user_id
+)
+ORDER BY created_at ASC, id ASC
+LIMIT $4
+`
+
+type GetChirpsPageParams struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+	ViewerID  uuid.UUID
+	Limit     int32
+}
+
+// the page of GetChirps after the chirp at created_at and id,
+// so a listing can be read a bit at a time
+func (q *Queries) GetChirpsPage(ctx context.Context, arg GetChirpsPageParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsPage,
+		arg.CreatedAt,
+		arg.ID,
+		arg.ViewerID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.HiddenAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpsPageDesc = `-- name: GetChirpsPageDesc :many
+SELECT id, created_at, updated_at, body, user_id, hidden_at FROM chirps
+WHERE hidden_at IS NULL
+AND (created_at < $1 OR (created_at = $1 AND id < $2))
+AND NOT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (user_blocks.blocker_id = $3 AND user_blocks.blocked_id = chirps.user_id)
+    OR (user_blocks.blocker_id = chirps.user_id AND user_blocks.blocked_id = $3)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM user_mutes
+    WHERE user_mutes.muter_id = $3 AND user_mutes.muted_id = chirps.user_id
+)
+ORDER BY created_at DESC, id DESC
+LIMIT $4
+`
+
+type GetChirpsPageDescParams struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+	ViewerID  uuid.UUID
+	Limit     int32
+}
+
+// newest first, otherwise GetChirpsPage
+func (q *Queries) GetChirpsPageDesc(ctx context.Context, arg GetChirpsPageDescParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsPageDesc,
+		arg.CreatedAt,
+		arg.ID,
+		arg.ViewerID,
+		arg.Limit,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -124,6 +460,7 @@ func (q *Queries) GetChirpsByUser(ctx context.Context, userID uuid.UUID) ([]Chir
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.HiddenAt,
 		); err != nil {
 			return nil, err
 		}
@@ -137,3 +474,45 @@ func (q *Queries) GetChirpsByUser(ctx context.Context, userID uuid.UUID) ([]Chir
 	}
 	return items, nil
 }
+
+const getChirpsVersion = `-- name: GetChirpsVersion :one
+SELECT COUNT(*) AS total,
+    md5(COALESCE(string_agg(id::text || ' ' || updated_at::text, ',' ORDER BY id), '')) AS digest
+FROM chirps
+WHERE hidden_at IS NULL
+AND NOT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (user_blocks.blocker_id = $1 AND user_blocks.blocked_id = chirps.user_id)
+    OR (user_blocks.blocker_id = chirps.user_id AND user_blocks.blocked_id = $1)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM user_mutes
+    WHERE user_mutes.muter_id = $1 AND user_mutes.muted_id = chirps.user_id
+)
+`
+
+type GetChirpsVersionRow struct {
+	Total  int64
+	Digest string
+}
+
+// how many chirps GetChirps has and a digest of which ones at which
+// version, enough to version the listing without reading it
+func (q *Queries) GetChirpsVersion(ctx context.Context, viewerID uuid.UUID) (GetChirpsVersionRow, error) {
+	row := q.db.QueryRowContext(ctx, getChirpsVersion, viewerID)
+	var i GetChirpsVersionRow
+	err := row.Scan(&i.Total, &i.Digest)
+	return i, err
+}
+
+const hideChirp = `-- name: HideChirp :exec
+UPDATE chirps
+SET hidden_at = NOW(),
+updated_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) HideChirp(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, hideChirp, id)
+	return err
+}
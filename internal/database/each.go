@@ -0,0 +1,35 @@
+package database
+
+// Not generated. Picks which of the chirp page queries a listing reads, so
+// the stores don't need a switch each.
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EachChirpParams picks the listing. A nil UserID is everyone's, like
+// GetChirpsPage, otherwise it's GetChirpsByUserPage. Desc is their Desc
+// versions.
+type EachChirpParams struct {
+	UserID   uuid.UUID
+	ViewerID uuid.UUID
+	Desc     bool
+}
+
+// ChirpsPage is up to limit chirps of the listing arg picks, starting after
+// the one at createdAt and id in its order.
+func (q *Queries) ChirpsPage(ctx context.Context, arg EachChirpParams, createdAt time.Time, id uuid.UUID, limit int32) ([]Chirp, error) {
+	switch {
+	case arg.UserID == uuid.Nil && arg.Desc:
+		return q.GetChirpsPageDesc(ctx, GetChirpsPageDescParams{CreatedAt: createdAt, ID: id, ViewerID: arg.ViewerID, Limit: limit})
+	case arg.UserID == uuid.Nil:
+		return q.GetChirpsPage(ctx, GetChirpsPageParams{CreatedAt: createdAt, ID: id, ViewerID: arg.ViewerID, Limit: limit})
+	case arg.Desc:
+		return q.GetChirpsByUserPageDesc(ctx, GetChirpsByUserPageDescParams{UserID: arg.UserID, CreatedAt: createdAt, ID: id, ViewerID: arg.ViewerID, Limit: limit})
+	default:
+		return q.GetChirpsByUserPage(ctx, GetChirpsByUserPageParams{UserID: arg.UserID, CreatedAt: createdAt, ID: id, ViewerID: arg.ViewerID, Limit: limit})
+	}
+}
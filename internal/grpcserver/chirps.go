@@ -0,0 +1,84 @@
+package grpcserver
+
+import (
+	"context"
+
+	"github.com/frankielb/chirpy/internal/chirpypb"
+	"github.com/frankielb/chirpy/internal/database"
+	"github.com/frankielb/chirpy/internal/service"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+type chirpServer struct {
+	chirpypb.UnimplementedChirpServiceServer
+	svc *service.Service
+}
+
+func (s *chirpServer) CreateChirp(ctx context.Context, req *chirpypb.ChirpRequest) (*chirpypb.Chirp, error) {
+	userID, err := authUserID(ctx, s.svc.Secret)
+	if err != nil {
+		return nil, err
+	}
+	chirp, err := s.svc.CreateChirp(ctx, userID, req.GetBody())
+	if err != nil {
+		return nil, err
+	}
+	return toChirp(chirp), nil
+}
+
+func (s *chirpServer) ListChirps(req *chirpypb.ListChirpsRequest, stream grpc.ServerStreamingServer[chirpypb.Chirp]) error {
+	ctx := stream.Context()
+	arg := service.ListChirpsParams{Desc: req.GetDesc()}
+	// logged in is optional, but a bad token is still an error
+	if hasAuth(ctx) {
+		viewerID, err := authUserID(ctx, s.svc.Secret)
+		if err != nil {
+			return err
+		}
+		arg.ViewerID = viewerID
+	}
+	if req.GetAuthorId() != "" {
+		authorID, err := parseID(req.GetAuthorId(), "author")
+		if err != nil {
+			return err
+		}
+		arg.AuthorID = authorID
+	}
+	return s.svc.EachChirp(ctx, arg, func(chirp database.Chirp) error {
+		return stream.Send(toChirp(chirp))
+	})
+}
+
+func (s *chirpServer) GetChirp(ctx context.Context, req *chirpypb.GetChirpRequest) (*chirpypb.Chirp, error) {
+	chirpID, err := parseID(req.GetId(), "chirp")
+	if err != nil {
+		return nil, err
+	}
+	chirp, err := s.svc.GetChirp(ctx, chirpID)
+	if err != nil {
+		return nil, err
+	}
+	return toChirp(chirp), nil
+}
+
+func (s *chirpServer) DeleteChirp(ctx context.Context, req *chirpypb.DeleteChirpRequest) (*emptypb.Empty, error) {
+	chirpID, err := parseID(req.GetId(), "chirp")
+	if err != nil {
+		return nil, err
+	}
+	userID, err := authUserID(ctx, s.svc.Secret)
+	if err != nil {
+		return nil, err
+	}
+	var match func(database.Chirp) bool
+	if req.UpdatedAt != nil {
+		match = func(chirp database.Chirp) bool {
+			return chirp.UpdatedAt.Equal(req.UpdatedAt.AsTime())
+		}
+	}
+	if err := s.svc.DeleteChirp(ctx, userID, chirpID, match); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
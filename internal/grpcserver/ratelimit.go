@@ -0,0 +1,95 @@
+package grpcserver
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/frankielb/chirpy/internal/auth"
+	"github.com/frankielb/chirpy/internal/logging"
+	"github.com/frankielb/chirpy/internal/service"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// rateLimiter limits calls by their full method name, eg
+// "/chirpy.v1.ChirpService/CreateChirp", the way the http middleware limits
+// routes. Methods without a policy fall back to the default one.
+type rateLimiter struct {
+	svc  *service.Service
+	opts Options
+}
+
+func (l rateLimiter) unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := l.take(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func (l rateLimiter) stream() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := l.take(ss.Context(), info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// take is nil if the call can go ahead, otherwise a ResourceExhausted with
+// how long to wait in its RetryInfo.
+func (l rateLimiter) take(ctx context.Context, method string) error {
+	policy, ok := l.opts.Limiter.Policy(method)
+	if !ok {
+		return nil
+	}
+	principal, red := l.principal(ctx)
+	if red {
+		policy = policy.Scale(l.svc.RateLimitRedFactor)
+	}
+	res, err := l.opts.Limiter.Take(ctx, method+" "+principal, policy)
+	if err != nil {
+		// better to let calls in than take the api down with the db
+		logging.FromContext(ctx).ErrorContext(ctx, "rate limit", "err", err)
+		return nil
+	}
+	if res.Allowed {
+		return nil
+	}
+	st := status.New(codes.ResourceExhausted, "rate limit exceeded, try again later")
+	retry := &errdetails.RetryInfo{RetryDelay: durationpb.New(max(res.RetryAfter, time.Second))}
+	if withDetails, err := st.WithDetails(retry); err == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
+
+// principal is who a call counts against, the user for a good access
+// token and the peer's ip otherwise. A bad token falls through to the ip
+// rather than getting its own bucket per token.
+func (l rateLimiter) principal(ctx context.Context) (principal string, red bool) {
+	if token, err := bearerToken(ctx); err == nil {
+		if userID, err := auth.ValidateJWT(token, l.svc.Secret); err == nil {
+			// only worth a lookup if red users get something different
+			if l.opts.IsRed != nil && l.svc.RateLimitRedFactor != 1 {
+				red = l.opts.IsRed(ctx, userID)
+			}
+			return "user:" + userID.String(), red
+		}
+	}
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "ip:unknown", false
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return "ip:" + p.Addr.String(), false
+	}
+	return "ip:" + host, false
+}
@@ -0,0 +1,253 @@
+// Package grpcserver serves the ChirpService and UserService in
+// proto/chirpy/v1/service.proto. It's a thin layer over the service
+// package, the same one the http handlers use, so the two apis can't
+// drift apart.
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/frankielb/chirpy/internal/auth"
+	"github.com/frankielb/chirpy/internal/chirpypb"
+	"github.com/frankielb/chirpy/internal/database"
+	"github.com/frankielb/chirpy/internal/logging"
+	"github.com/frankielb/chirpy/internal/ratelimit"
+	"github.com/frankielb/chirpy/internal/service"
+	"github.com/google/uuid"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// the metadata key for the request id, like the http X-Request-ID
+const metadataRequestID = "x-request-id"
+
+// Options are the extras New can turn on.
+type Options struct {
+	// serve reflection so grpcurl and friends can find their way around
+	Reflection bool
+	// limits calls per method, nil for no limits. Policies are keyed by
+	// full method name.
+	Limiter *ratelimit.Limiter
+	// IsRed says if a user gets their limits scaled by the config's
+	// RateLimitRedFactor, nil if nobody does
+	IsRed func(ctx context.Context, userID uuid.UUID) bool
+}
+
+// New is a grpc server with both services and the standard health service.
+func New(svc *service.Service, logger *slog.Logger, opts Options) *grpc.Server {
+	// logging goes first so limited calls are logged too
+	unary := []grpc.UnaryServerInterceptor{unaryInterceptor(logger)}
+	stream := []grpc.StreamServerInterceptor{streamInterceptor(logger)}
+	if opts.Limiter != nil {
+		l := rateLimiter{svc: svc, opts: opts}
+		unary = append(unary, l.unary())
+		stream = append(stream, l.stream())
+	}
+	s := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
+	)
+	chirpypb.RegisterChirpServiceServer(s, &chirpServer{svc: svc})
+	chirpypb.RegisterUserServiceServer(s, &userServer{svc: svc})
+
+	hs := health.NewServer()
+	for _, name := range []string{chirpypb.ChirpService_ServiceDesc.ServiceName, chirpypb.UserService_ServiceDesc.ServiceName} {
+		hs.SetServingStatus(name, healthpb.HealthCheckResponse_SERVING)
+	}
+	healthpb.RegisterHealthServer(s, hs)
+	if opts.Reflection {
+		reflection.Register(s)
+	}
+	return s
+}
+
+// startCall sets up the call's logging, with the caller's request id if it
+// sent one.
+func startCall(ctx context.Context, logger *slog.Logger) context.Context {
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(metadataRequestID); len(ids) > 0 {
+			id = ids[0]
+		}
+	}
+	ctx, id = logging.NewContext(ctx, logger, id)
+	grpc.SetHeader(ctx, metadata.Pairs(metadataRequestID, id))
+	return ctx
+}
+
+// endCall logs one line per call, like the http access log.
+func endCall(ctx context.Context, method string, start time.Time, err error) {
+	code := status.Code(err)
+	level := slog.LevelInfo
+	if code == codes.Internal || code == codes.Unknown {
+		level = slog.LevelError
+	}
+	logging.FromContext(ctx).LogAttrs(ctx, level, "rpc",
+		slog.String("method", method),
+		slog.String("code", code.String()),
+		slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+	)
+}
+
+// recoverCall turns a panic into an Internal error, net/http does the same
+// for the http side.
+func recoverCall(ctx context.Context, err *error) {
+	if p := recover(); p != nil {
+		logging.FromContext(ctx).ErrorContext(ctx, "panic serving rpc", "panic", p, "stack", string(debug.Stack()))
+		*err = status.Error(codes.Internal, "Internal server error")
+	}
+}
+
+func unaryInterceptor(logger *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+		start := time.Now()
+		ctx = startCall(ctx, logger)
+		defer func() { endCall(ctx, info.FullMethod, start, err) }()
+		defer recoverCall(ctx, &err)
+		resp, err = handler(ctx, req)
+		return resp, toStatus(ctx, err)
+	}
+}
+
+func streamInterceptor(logger *slog.Logger) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		start := time.Now()
+		ctx := startCall(ss.Context(), logger)
+		defer func() { endCall(ctx, info.FullMethod, start, err) }()
+		defer recoverCall(ctx, &err)
+		return toStatus(ctx, handler(srv, &serverStream{ServerStream: ss, ctx: ctx}))
+	}
+}
+
+// serverStream swaps in the context with the call's logger.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context { return s.ctx }
+
+// toStatus is the grpc status for a service error. Only the message the
+// service meant for clients goes out, the cause is logged.
+func toStatus(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	var serr *service.Error
+	if !errors.As(err, &serr) {
+		logging.FromContext(ctx).ErrorContext(ctx, "responding with server error", "err", err)
+		return status.Error(codes.Internal, "Internal server error")
+	}
+	code := codes.Internal
+	switch {
+	case errors.Is(err, service.ErrInvalid):
+		code = codes.InvalidArgument
+	case errors.Is(err, service.ErrUnauthorized):
+		code = codes.Unauthenticated
+	case errors.Is(err, service.ErrForbidden):
+		code = codes.PermissionDenied
+	case errors.Is(err, service.ErrNotFound):
+		code = codes.NotFound
+	case errors.Is(err, service.ErrConflict):
+		code = codes.AlreadyExists
+	case errors.Is(err, service.ErrPrecondition):
+		code = codes.FailedPrecondition
+	}
+	logger := logging.FromContext(ctx)
+	attrs := []any{"code", code.String(), "msg", serr.Msg}
+	if serr.Err != nil {
+		attrs = append(attrs, "err", serr.Err)
+	}
+	if code == codes.Internal {
+		logger.ErrorContext(ctx, "responding with server error", attrs...)
+	} else {
+		logger.DebugContext(ctx, "responding with client error", attrs...)
+	}
+
+	st := status.New(code, serr.Msg)
+	if len(serr.Fields) > 0 {
+		br := &errdetails.BadRequest{}
+		for _, f := range serr.Fields {
+			br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       f.Field,
+				Description: f.Message,
+				Reason:      f.Code,
+			})
+		}
+		if withDetails, err := st.WithDetails(br); err == nil {
+			st = withDetails
+		}
+	}
+	return st.Err()
+}
+
+// bearerToken is the token from the authorization metadata, the same
+// "Bearer <token>" as the http header.
+func bearerToken(ctx context.Context) (string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	return auth.GetBearerToken(http.Header{"Authorization": md.Get("authorization")})
+}
+
+// hasAuth is true if the call sent a token, good or not.
+func hasAuth(ctx context.Context) bool {
+	md, _ := metadata.FromIncomingContext(ctx)
+	return len(md.Get("authorization")) > 0
+}
+
+// authUserID is the user from the access token in the metadata.
+func authUserID(ctx context.Context, secret string) (uuid.UUID, error) {
+	token, err := bearerToken(ctx)
+	if err != nil {
+		return uuid.Nil, status.Error(codes.Unauthenticated, "unauthorized: no token")
+	}
+	userID, err := auth.ValidateJWT(token, secret)
+	if err != nil {
+		return uuid.Nil, status.Error(codes.Unauthenticated, "unauthorized: bad token")
+	}
+	logging.SetUserID(ctx, userID)
+	return userID, nil
+}
+
+// parseID is a uuid from a request, what says which one for the error.
+func parseID(s, what string) (uuid.UUID, error) {
+	id, err := uuid.Parse(s)
+	if err != nil {
+		return uuid.Nil, status.Errorf(codes.InvalidArgument, "Invalid %s ID", what)
+	}
+	return id, nil
+}
+
+func toChirp(c database.Chirp) *chirpypb.Chirp {
+	return &chirpypb.Chirp{
+		Id:        c.ID.String(),
+		CreatedAt: timestamppb.New(c.CreatedAt),
+		UpdatedAt: timestamppb.New(c.UpdatedAt),
+		Body:      c.Body,
+		UserId:    c.UserID.String(),
+	}
+}
+
+func toUser(u database.User) *chirpypb.User {
+	return &chirpypb.User{
+		Id:          u.ID.String(),
+		CreatedAt:   timestamppb.New(u.CreatedAt),
+		UpdatedAt:   timestamppb.New(u.UpdatedAt),
+		Email:       u.Email,
+		IsChirpyRed: u.IsChirpyRed,
+	}
+}
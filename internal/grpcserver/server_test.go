@@ -0,0 +1,217 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/frankielb/chirpy/internal/chirpypb"
+	"github.com/frankielb/chirpy/internal/config"
+	"github.com/frankielb/chirpy/internal/metrics"
+	"github.com/frankielb/chirpy/internal/ratelimit"
+	"github.com/frankielb/chirpy/internal/service"
+	"github.com/frankielb/chirpy/internal/store"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func newTestConn(t *testing.T, opts Options) *grpc.ClientConn {
+	t.Helper()
+	conf := config.Default()
+	conf.Secret = "test-secret"
+	svc := &service.Service{Config: &conf, DB: store.NewMemory(), Metrics: metrics.New()}
+	s := New(svc, slog.New(slog.NewTextHandler(io.Discard, nil)), opts)
+	lis := bufconn.Listen(1 << 20)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func withToken(ctx context.Context, token string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+}
+
+func TestServer(t *testing.T) {
+	ctx := context.Background()
+	conn := newTestConn(t, Options{})
+	users := chirpypb.NewUserServiceClient(conn)
+	chirps := chirpypb.NewChirpServiceClient(conn)
+
+	// validation errors say which fields
+	_, err := users.CreateUser(ctx, &chirpypb.UserRequest{Email: "nope"})
+	st := status.Convert(err)
+	if st.Code() != codes.InvalidArgument || len(st.Details()) != 1 {
+		t.Fatalf("CreateUser bad fields: %v", err)
+	}
+	if br, ok := st.Details()[0].(*errdetails.BadRequest); !ok || len(br.FieldViolations) != 2 {
+		t.Errorf("details = %v", st.Details())
+	}
+
+	if _, err := users.CreateUser(ctx, &chirpypb.UserRequest{Email: "alice@example.com", Password: "hunter2"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := users.Login(ctx, &chirpypb.UserRequest{Email: "alice@example.com", Password: "wrong"}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("wrong password: %v", err)
+	}
+	session, err := users.Login(ctx, &chirpypb.UserRequest{Email: "alice@example.com", Password: "hunter2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := users.Refresh(ctx, &chirpypb.RefreshRequest{RefreshToken: session.RefreshToken}); err != nil {
+		t.Errorf("Refresh: %v", err)
+	}
+
+	if _, err := chirps.CreateChirp(ctx, &chirpypb.ChirpRequest{Body: "no token"}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("CreateChirp without a token: %v", err)
+	}
+	authed := withToken(ctx, session.Token)
+	var created []*chirpypb.Chirp
+	for _, body := range []string{"first", "second"} {
+		c, err := chirps.CreateChirp(authed, &chirpypb.ChirpRequest{Body: body})
+		if err != nil {
+			t.Fatal(err)
+		}
+		created = append(created, c)
+	}
+
+	stream, err := chirps.ListChirps(ctx, &chirpypb.ListChirpsRequest{Desc: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for {
+		c, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, c.Body)
+	}
+	if len(got) != 2 || got[0] != "second" {
+		t.Errorf("ListChirps = %v", got)
+	}
+	stream, err = chirps.ListChirps(withToken(ctx, "not-a-jwt"), &chirpypb.ListChirpsRequest{})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("ListChirps with a bad token: %v", err)
+	}
+
+	first := created[0]
+	if _, err := chirps.GetChirp(ctx, &chirpypb.GetChirpRequest{Id: "nope"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("GetChirp bad id: %v", err)
+	}
+	// the wrong version isn't deleted
+	stale := &chirpypb.DeleteChirpRequest{Id: first.Id, UpdatedAt: timestamppb.New(first.UpdatedAt.AsTime().Add(-time.Second))}
+	if _, err := chirps.DeleteChirp(authed, stale); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("DeleteChirp stale: %v", err)
+	}
+	if _, err := chirps.DeleteChirp(authed, &chirpypb.DeleteChirpRequest{Id: first.Id, UpdatedAt: first.UpdatedAt}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chirps.GetChirp(ctx, &chirpypb.GetChirpRequest{Id: first.Id}); status.Code(err) != codes.NotFound {
+		t.Errorf("GetChirp deleted: %v", err)
+	}
+
+	res, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: "chirpy.v1.ChirpService"})
+	if err != nil || res.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("health = %v, %v", res, err)
+	}
+}
+
+func TestReflection(t *testing.T) {
+	list := func(conn *grpc.ClientConn) error {
+		stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(context.Background())
+		if err != nil {
+			return err
+		}
+		req := &reflectionpb.ServerReflectionRequest{
+			MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+		}
+		if err := stream.Send(req); err != nil {
+			return err
+		}
+		_, err = stream.Recv()
+		return err
+	}
+	// it shows off the whole api, so only when asked for
+	if err := list(newTestConn(t, Options{})); status.Code(err) != codes.Unimplemented {
+		t.Errorf("reflection by default: %v", err)
+	}
+	if err := list(newTestConn(t, Options{Reflection: true})); err != nil {
+		t.Errorf("reflection turned on: %v", err)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	ctx := context.Background()
+	limiter := ratelimit.New(ratelimit.NewMemory(), map[string]ratelimit.Policy{
+		"/chirpy.v1.UserService/Login":        {Limit: 1, Period: time.Hour, Burst: 1},
+		"/chirpy.v1.ChirpService/CreateChirp": {Limit: 1, Period: time.Hour, Burst: 1},
+	})
+	conn := newTestConn(t, Options{Limiter: limiter})
+	users := chirpypb.NewUserServiceClient(conn)
+	chirps := chirpypb.NewChirpServiceClient(conn)
+
+	for _, email := range []string{"alice@example.com", "bob@example.com"} {
+		if _, err := users.CreateUser(ctx, &chirpypb.UserRequest{Email: email, Password: "hunter2"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// logins count against the ip
+	session, err := users.Login(ctx, &chirpypb.UserRequest{Email: "alice@example.com", Password: "hunter2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = users.Login(ctx, &chirpypb.UserRequest{Email: "bob@example.com", Password: "hunter2"})
+	st := status.Convert(err)
+	if st.Code() != codes.ResourceExhausted || len(st.Details()) != 1 {
+		t.Fatalf("second login: %v", err)
+	}
+	if retry, ok := st.Details()[0].(*errdetails.RetryInfo); !ok || retry.RetryDelay.AsDuration() < time.Second {
+		t.Errorf("details = %v", st.Details())
+	}
+
+	// chirps count against the user, and methods without a policy aren't
+	// limited
+	authed := withToken(ctx, session.Token)
+	if _, err := chirps.CreateChirp(authed, &chirpypb.ChirpRequest{Body: "first"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chirps.CreateChirp(authed, &chirpypb.ChirpRequest{Body: "second"}); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("second chirp: %v", err)
+	}
+	if _, err := chirps.CreateChirp(ctx, &chirpypb.ChirpRequest{Body: "no token"}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("anonymous chirp has its own bucket: %v", err)
+	}
+	for range 3 {
+		if _, err := chirps.GetChirp(ctx, &chirpypb.GetChirpRequest{Id: "nope"}); status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("GetChirp: %v", err)
+		}
+	}
+}
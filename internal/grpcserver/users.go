@@ -0,0 +1,61 @@
+package grpcserver
+
+import (
+	"context"
+
+	"github.com/frankielb/chirpy/internal/chirpypb"
+	"github.com/frankielb/chirpy/internal/service"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+type userServer struct {
+	chirpypb.UnimplementedUserServiceServer
+	svc *service.Service
+}
+
+func (s *userServer) CreateUser(ctx context.Context, req *chirpypb.UserRequest) (*chirpypb.User, error) {
+	user, err := s.svc.CreateUser(ctx, req.GetEmail(), req.GetPassword())
+	if err != nil {
+		return nil, err
+	}
+	return toUser(user), nil
+}
+
+func (s *userServer) UpdateUser(ctx context.Context, req *chirpypb.UserRequest) (*chirpypb.User, error) {
+	userID, err := authUserID(ctx, s.svc.Secret)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.svc.UpdateUser(ctx, userID, req.GetEmail(), req.GetPassword())
+	if err != nil {
+		return nil, err
+	}
+	return toUser(user), nil
+}
+
+func (s *userServer) Login(ctx context.Context, req *chirpypb.UserRequest) (*chirpypb.Session, error) {
+	session, err := s.svc.Login(ctx, req.GetEmail(), req.GetPassword())
+	if err != nil {
+		return nil, err
+	}
+	return &chirpypb.Session{
+		User:         toUser(session.User),
+		Token:        session.Token,
+		RefreshToken: session.RefreshToken,
+	}, nil
+}
+
+func (s *userServer) Refresh(ctx context.Context, req *chirpypb.RefreshRequest) (*chirpypb.Token, error) {
+	token, err := s.svc.Refresh(ctx, req.GetRefreshToken())
+	if err != nil {
+		return nil, err
+	}
+	return &chirpypb.Token{Token: token}, nil
+}
+
+func (s *userServer) Revoke(ctx context.Context, req *chirpypb.RefreshRequest) (*emptypb.Empty, error) {
+	if err := s.svc.Revoke(ctx, req.GetRefreshToken()); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
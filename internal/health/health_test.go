@@ -0,0 +1,43 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry(50 * time.Millisecond)
+	if report := r.Run(context.Background()); !report.OK() || len(report.Checks) != 0 {
+		t.Fatalf("empty registry = %+v", report)
+	}
+
+	r.Register("database", func(ctx context.Context) error { return nil })
+	if report := r.Run(context.Background()); !report.OK() {
+		t.Fatalf("passing check = %+v", report)
+	}
+
+	r.Register("cache", func(ctx context.Context) error { return errors.New("connection refused") })
+	// ignores ctx, the registry should still give up on it
+	r.Register("mailer", func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+	report := r.Run(context.Background())
+	if report.OK() {
+		t.Fatal("report ok with failing checks")
+	}
+	if got := report.Checks["database"]; got.Status != StatusOK {
+		t.Errorf("database = %+v", got)
+	}
+	if got := report.Checks["cache"]; got.Status != StatusFail || got.Error != "connection refused" {
+		t.Errorf("cache = %+v", got)
+	}
+	if got := report.Checks["mailer"]; got.Status != StatusFail || got.Error != context.DeadlineExceeded.Error() {
+		t.Errorf("mailer = %+v", got)
+	}
+	if names := r.Names(); len(names) != 3 || names[0] != "cache" {
+		t.Errorf("names = %v", names)
+	}
+}
@@ -0,0 +1,158 @@
+// Package logging sets up slog and carries a per request logger in the
+// context, tagged with the request id and, once known, the user id.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/frankielb/chirpy/internal/httpx"
+	"github.com/google/uuid"
+)
+
+const HeaderRequestID = "X-Request-ID"
+
+// longest request id we'll take from a client
+const maxRequestIDLen = 128
+
+// New makes a json or text logger at the given level, eg "info".
+func New(w io.Writer, level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("logging: bad level %q", level)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch format {
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	}
+	return nil, fmt.Errorf("logging: bad format %q, want json or text", format)
+}
+
+type ctxKey struct{}
+
+// requestInfo is shared by pointer so handlers further in can add to what
+// the middleware logs at the end.
+type requestInfo struct {
+	mu     sync.Mutex
+	id     string
+	logger *slog.Logger
+	route  string
+}
+
+func info(ctx context.Context) *requestInfo {
+	ri, _ := ctx.Value(ctxKey{}).(*requestInfo)
+	return ri
+}
+
+// FromContext is the request's logger, or slog.Default outside a request.
+func FromContext(ctx context.Context) *slog.Logger {
+	ri := info(ctx)
+	if ri == nil {
+		return slog.Default()
+	}
+	ri.mu.Lock()
+	defer ri.mu.Unlock()
+	return ri.logger
+}
+
+// RequestID is the id the middleware gave the request, if any.
+func RequestID(ctx context.Context) string {
+	if ri := info(ctx); ri != nil {
+		return ri.id
+	}
+	return ""
+}
+
+// SetUserID adds the authenticated user to every log line after this one,
+// including the access log.
+func SetUserID(ctx context.Context, userID uuid.UUID) {
+	ri := info(ctx)
+	if ri == nil {
+		return
+	}
+	ri.mu.Lock()
+	defer ri.mu.Unlock()
+	ri.logger = ri.logger.With("user_id", userID.String())
+}
+
+// SetRoute tells the access log which route matched. The mux only sets
+// r.Pattern on its own copy of the request, and middleware in between that
+// copies it again, say to swap the context, hides that from Middleware.
+func SetRoute(ctx context.Context, route string) {
+	ri := info(ctx)
+	if ri == nil {
+		return
+	}
+	ri.mu.Lock()
+	defer ri.mu.Unlock()
+	ri.route = route
+}
+
+// validRequestID keeps junk and log injection out of the id we echo back.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	return !strings.ContainsFunc(id, func(r rune) bool {
+		return r < '!' || r > '~'
+	})
+}
+
+// NewContext starts the logging for a request, tagged with id, or a new
+// id if that one doesn't look sane. It's for servers that aren't http, like
+// the grpc one.
+func NewContext(ctx context.Context, base *slog.Logger, id string) (context.Context, string) {
+	if !validRequestID(id) {
+		id = uuid.NewString()
+	}
+	ri := &requestInfo{id: id, logger: base.With("request_id", id)}
+	return context.WithValue(ctx, ctxKey{}, ri), id
+}
+
+// Middleware gives every request an id, taking the caller's X-Request-ID
+// when it looks sane, and logs one line per request when it's done.
+func Middleware(base *slog.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ctx, id := NewContext(r.Context(), base, r.Header.Get(HeaderRequestID))
+		w.Header().Set(HeaderRequestID, id)
+		ri := info(ctx)
+		r = r.WithContext(ctx)
+
+		rec := httpx.NewStatusRecorder(w)
+		next.ServeHTTP(rec, r)
+
+		// the mux fills in r.Pattern when it routes
+		route := r.Pattern
+		ri.mu.Lock()
+		if ri.route != "" {
+			route = ri.route
+		}
+		ri.mu.Unlock()
+		if route == "" {
+			route = "unmatched"
+		}
+		level := slog.LevelInfo
+		if rec.Status >= 500 {
+			level = slog.LevelError
+		}
+		// just the path, query strings can have tokens in
+		FromContext(r.Context()).LogAttrs(r.Context(), level, "request",
+			slog.String("method", r.Method),
+			slog.String("route", route),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.Status),
+			slog.Int("bytes", rec.Bytes),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+		)
+	})
+}
@@ -0,0 +1,121 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "info", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID := uuid.New()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /things/{id}", func(w http.ResponseWriter, r *http.Request) {
+		SetUserID(r.Context(), userID)
+		if RequestID(r.Context()) == "" {
+			t.Error("no request id in the handler")
+		}
+		w.WriteHeader(http.StatusTeapot)
+	})
+	h := Middleware(logger, mux)
+
+	tests := []struct {
+		name   string
+		header string
+		keep   bool
+	}{
+		{"Propagated", "abc-123", true},
+		{"Missing", "", false},
+		{"Junk", "bad id\nwith newline", false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			buf.Reset()
+			req := httptest.NewRequest("GET", "/things/42?token=secret", nil)
+			if tc.header != "" {
+				req.Header.Set(HeaderRequestID, tc.header)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			id := rec.Header().Get(HeaderRequestID)
+			if tc.keep && id != tc.header {
+				t.Errorf("request id = %q, want %q", id, tc.header)
+			}
+			if !tc.keep {
+				if _, err := uuid.Parse(id); err != nil {
+					t.Errorf("expected a generated uuid, got %q", id)
+				}
+			}
+
+			var line map[string]any
+			if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+				t.Fatalf("bad log line %q: %v", buf.String(), err)
+			}
+			want := map[string]any{
+				"request_id": id,
+				"user_id":    userID.String(),
+				"route":      "GET /things/{id}",
+				"path":       "/things/42",
+				"status":     float64(http.StatusTeapot),
+			}
+			for k, v := range want {
+				if line[k] != v {
+					t.Errorf("%s = %v, want %v", k, line[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestSetRoute(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "info", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /things/{id}", func(w http.ResponseWriter, r *http.Request) {
+		SetRoute(r.Context(), r.Pattern)
+	})
+	// a copy in between, so the mux fills in a request we never see
+	copying := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.ServeHTTP(w, r.WithContext(r.Context()))
+	})
+	Middleware(logger, copying).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/things/42", nil))
+
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("bad log line %q: %v", buf.String(), err)
+	}
+	if line["route"] != "GET /things/{id}" {
+		t.Errorf("route = %v", line["route"])
+	}
+}
+
+func TestFromContextDefault(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	if FromContext(req.Context()) != slog.Default() {
+		t.Error("expected the default logger outside a request")
+	}
+	// no info in the context, shouldn't panic
+	SetUserID(req.Context(), uuid.New())
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New(&bytes.Buffer{}, "loud", "json"); err == nil {
+		t.Error("expected an error for a bad level")
+	}
+	if _, err := New(&bytes.Buffer{}, "debug", "xml"); err == nil {
+		t.Error("expected an error for a bad format")
+	}
+}
@@ -0,0 +1,145 @@
+// Package metrics holds the prometheus collectors for the server, on their
+// own registry so tests can make as many as they like.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/frankielb/chirpy/internal/httpx"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const namespace = "chirpy"
+
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	Requests        *prometheus.CounterVec
+	RequestDuration *prometheus.HistogramVec
+	FileserverHits  prometheus.Counter
+
+	ChirpsCreated prometheus.Counter
+	Logins        prometheus.Counter
+	FailedLogins  prometheus.Counter
+	// by event and what we did with it
+	WebhookEvents *prometheus.CounterVec
+
+	// prometheus counters never go down, the admin reset just moves this
+	mu       sync.Mutex
+	hitsBase float64
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		Requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by method, route pattern and status code.",
+		}, []string{"method", "route", "code"}),
+		RequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by method, route pattern and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "code"}),
+		FileserverHits: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "fileserver_hits_total",
+			Help:      "Requests served from /app/.",
+		}),
+		ChirpsCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "chirps_created_total",
+			Help:      "Chirps posted.",
+		}),
+		Logins: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "logins_total",
+			Help:      "Successful logins.",
+		}),
+		FailedLogins: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "failed_logins_total",
+			Help:      "Logins rejected for a bad email or password.",
+		}),
+		WebhookEvents: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "webhook_events_total",
+			Help:      "Polka webhook events by event and result.",
+		}, []string{"event", "result"}),
+	}
+	m.Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.Requests,
+		m.RequestDuration,
+		m.FileserverHits,
+		m.ChirpsCreated,
+		m.Logins,
+		m.FailedLogins,
+		m.WebhookEvents,
+	)
+	return m
+}
+
+// RegisterDB exports the connection pool stats from db.Stats().
+func (m *Metrics) RegisterDB(db *sql.DB) {
+	m.Registry.MustRegister(collectors.NewDBStatsCollector(db, namespace))
+}
+
+// Handler serves the registry in the prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{Registry: m.Registry})
+}
+
+// Hits is the fileserver hits since the last ResetHits.
+func (m *Metrics) Hits() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return int(counterValue(m.FileserverHits) - m.hitsBase)
+}
+
+func (m *Metrics) ResetHits() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hitsBase = counterValue(m.FileserverHits)
+}
+
+// counterValue reads a counter back out the same way the registry does.
+func counterValue(c prometheus.Counter) float64 {
+	var out dto.Metric
+	if err := c.Write(&out); err != nil {
+		return 0
+	}
+	return out.GetCounter().GetValue()
+}
+
+// Middleware records every request against the mux pattern it matched, not
+// the raw path, so ids in urls don't blow up the label count.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := httpx.NewStatusRecorder(w)
+		next.ServeHTTP(rec, r)
+		// the mux fills in r.Pattern when it routes
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		labels := prometheus.Labels{
+			"method": r.Method,
+			"route":  route,
+			"code":   strconv.Itoa(rec.Status),
+		}
+		m.Requests.With(labels).Inc()
+		m.RequestDuration.With(labels).Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,97 @@
+// Package migrate runs the embedded goose migrations for postgres and sqlite.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+
+	schema "github.com/frankielb/chirpy/sql"
+	"github.com/pressly/goose/v3"
+)
+
+// ErrBehind means the database is missing migrations this build needs.
+var ErrBehind = errors.New("migrate: database schema is behind")
+
+// provider builds a goose provider for the driver names store.Driver gives.
+func provider(db *sql.DB, driver string) (*goose.Provider, error) {
+	var (
+		dialect goose.Dialect
+		fsys    fs.FS
+		err     error
+	)
+	switch driver {
+	case "postgres":
+		dialect = goose.DialectPostgres
+		fsys, err = fs.Sub(schema.Postgres, "schema")
+	case "sqlite":
+		dialect = goose.DialectSQLite3
+		fsys, err = fs.Sub(schema.SQLite, "sqlite/schema")
+	default:
+		return nil, fmt.Errorf("migrate: no migrations for %q", driver)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return goose.NewProvider(dialect, db, fsys)
+}
+
+// Up applies every pending migration.
+func Up(ctx context.Context, db *sql.DB, driver string) error {
+	p, err := provider(db, driver)
+	if err != nil {
+		return err
+	}
+	_, err = p.Up(ctx)
+	return err
+}
+
+// Down rolls back the latest migration.
+func Down(ctx context.Context, db *sql.DB, driver string) error {
+	p, err := provider(db, driver)
+	if err != nil {
+		return err
+	}
+	_, err = p.Down(ctx)
+	return err
+}
+
+// Status writes one line per migration saying if and when it was applied.
+func Status(ctx context.Context, db *sql.DB, driver string, w io.Writer) error {
+	p, err := provider(db, driver)
+	if err != nil {
+		return err
+	}
+	statuses, err := p.Status(ctx)
+	if err != nil {
+		return err
+	}
+	for _, s := range statuses {
+		applied := "pending"
+		if s.State == goose.StateApplied {
+			applied = s.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "%-20s %s\n", applied, s.Source.Path)
+	}
+	return nil
+}
+
+// Check returns ErrBehind if the database version is older than the newest
+// embedded migration.
+func Check(ctx context.Context, db *sql.DB, driver string) error {
+	p, err := provider(db, driver)
+	if err != nil {
+		return err
+	}
+	current, target, err := p.GetVersions(ctx)
+	if err != nil {
+		return err
+	}
+	if current < target {
+		return fmt.Errorf("%w: at version %d, need %d", ErrBehind, current, target)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+func TestUpDownCheck(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", "file::memory:?_pragma=foreign_keys(1)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+
+	if err := Check(ctx, db, "sqlite"); !errors.Is(err, ErrBehind) {
+		t.Fatalf("fresh db: got %v, want ErrBehind", err)
+	}
+	if err := Up(ctx, db, "sqlite"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Check(ctx, db, "sqlite"); err != nil {
+		t.Fatalf("after up: %v", err)
+	}
+	if _, err := db.Exec("SELECT role, suspended_until FROM users"); err != nil {
+		t.Fatalf("schema not applied: %v", err)
+	}
+
+	if err := Down(ctx, db, "sqlite"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Check(ctx, db, "sqlite"); !errors.Is(err, ErrBehind) {
+		t.Fatalf("after down: got %v, want ErrBehind", err)
+	}
+
+	var out strings.Builder
+	if err := Status(ctx, db, "sqlite", &out); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if last := lines[len(lines)-1]; !strings.HasPrefix(last, "pending") || !strings.HasSuffix(last, "011_idempotency_headers.sql") {
+		t.Fatalf("last status line = %q", last)
+	}
+}
+
+func TestUnknownDriver(t *testing.T) {
+	if err := Up(context.Background(), &sql.DB{}, "memory"); err == nil {
+		t.Fatal("expected an error for the memory driver")
+	}
+}
@@ -0,0 +1,56 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/frankielb/chirpy/internal/database"
+)
+
+// Queries is the part of database.Queries Postgres uses.
+type Queries interface {
+	TakeRateLimitToken(ctx context.Context, arg database.TakeRateLimitTokenParams) (float64, error)
+	GetRateLimit(ctx context.Context, key string) (database.RateLimit, error)
+	DeleteRateLimitsBefore(ctx context.Context, updatedAt time.Time) error
+}
+
+// Postgres keeps buckets in the rate_limits table so every instance shares
+// them. The refill and take is one upsert, so it's safe across instances.
+type Postgres struct {
+	q Queries
+}
+
+func NewPostgres(q Queries) *Postgres {
+	return &Postgres{q: q}
+}
+
+func (pg *Postgres) Take(ctx context.Context, key string, p Policy, now time.Time) (Result, error) {
+	// timestamp columns have no zone, keep everything in utc
+	now = now.UTC()
+	tokens, err := pg.q.TakeRateLimitToken(ctx, database.TakeRateLimitTokenParams{
+		Key:   key,
+		Burst: float64(p.Burst),
+		Now:   now,
+		Rate:  p.rate(),
+	})
+	if err == nil {
+		return result(p, tokens, true), nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return Result{}, err
+	}
+	// refused, read the bucket back for the headers
+	row, err := pg.q.GetRateLimit(ctx, key)
+	if err != nil {
+		return Result{}, err
+	}
+	return result(p, refill(p, row.Tokens, row.UpdatedAt, now), false), nil
+}
+
+// Sweep deletes buckets untouched since before. Pass a time at least the
+// longest policy period ago so only full buckets go.
+func (pg *Postgres) Sweep(ctx context.Context, before time.Time) error {
+	return pg.q.DeleteRateLimitsBefore(ctx, before.UTC())
+}
@@ -0,0 +1,169 @@
+// Package ratelimit is token bucket rate limiting with an in-memory backend
+// for one instance and a postgres one for several.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultRoute is the policies key for routes without their own policy.
+const DefaultRoute = "*"
+
+// Policy is a bucket of Burst tokens refilled at Limit per Period, each
+// request takes one.
+type Policy struct {
+	Limit  int
+	Period time.Duration
+	Burst  int
+}
+
+// ParsePolicy reads "limit/period", eg "30/1m" or "5/h", with an optional
+// " burst n" when the bucket should hold more or less than limit.
+// "off" gives the zero Policy, which doesn't limit anything.
+func ParsePolicy(s string) (Policy, error) {
+	s = strings.TrimSpace(s)
+	if s == "off" {
+		return Policy{}, nil
+	}
+	rate, burst, hasBurst := strings.Cut(s, " burst ")
+	limit, period, ok := strings.Cut(strings.TrimSpace(rate), "/")
+	if !ok {
+		return Policy{}, fmt.Errorf("ratelimit: policy %q should look like 30/1m", s)
+	}
+	p := Policy{}
+	var err error
+	if p.Limit, err = strconv.Atoi(limit); err != nil || p.Limit < 1 {
+		return Policy{}, fmt.Errorf("ratelimit: policy %q: limit must be a positive number", s)
+	}
+	// 1m can be written m
+	if period != "" && !strings.ContainsAny(period[:1], "0123456789") {
+		period = "1" + period
+	}
+	if p.Period, err = time.ParseDuration(period); err != nil || p.Period <= 0 {
+		return Policy{}, fmt.Errorf("ratelimit: policy %q: bad period", s)
+	}
+	p.Burst = p.Limit
+	if hasBurst {
+		if p.Burst, err = strconv.Atoi(strings.TrimSpace(burst)); err != nil || p.Burst < 1 {
+			return Policy{}, fmt.Errorf("ratelimit: policy %q: burst must be a positive number", s)
+		}
+	}
+	return p, nil
+}
+
+func (p Policy) String() string {
+	if p.Off() {
+		return "off"
+	}
+	s := strconv.Itoa(p.Limit) + "/" + p.Period.String()
+	if p.Burst != p.Limit {
+		s += " burst " + strconv.Itoa(p.Burst)
+	}
+	return s
+}
+
+// Off is true for the zero Policy.
+func (p Policy) Off() bool { return p.Limit == 0 }
+
+// Scale multiplies the limit and burst, for users who get more.
+func (p Policy) Scale(f float64) Policy {
+	if p.Off() {
+		return p
+	}
+	p.Limit = max(1, int(math.Round(float64(p.Limit)*f)))
+	p.Burst = max(1, int(math.Round(float64(p.Burst)*f)))
+	return p
+}
+
+// rate is tokens per second.
+func (p Policy) rate() float64 {
+	return float64(p.Limit) / p.Period.Seconds()
+}
+
+// Result is what a Take decided, with what the RateLimit headers need.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// until the bucket is full again
+	Reset time.Duration
+	// until the next token, zero when allowed
+	RetryAfter time.Duration
+}
+
+// Backend keeps the buckets. Take refills key's bucket as of now and takes
+// a token from it if there is one.
+type Backend interface {
+	Take(ctx context.Context, key string, p Policy, now time.Time) (Result, error)
+}
+
+// refill is how many tokens a bucket left with tokens at updated has by now.
+func refill(p Policy, tokens float64, updated, now time.Time) float64 {
+	elapsed := max(0, now.Sub(updated).Seconds())
+	return math.Min(float64(p.Burst), tokens+elapsed*p.rate())
+}
+
+// result describes a bucket holding tokens after the take, or after it was
+// refused.
+func result(p Policy, tokens float64, allowed bool) Result {
+	res := Result{
+		Allowed:   allowed,
+		Limit:     p.Limit,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     secs((float64(p.Burst) - tokens) / p.rate()),
+	}
+	if !allowed {
+		res.RetryAfter = secs((1 - tokens) / p.rate())
+	}
+	return res
+}
+
+func secs(s float64) time.Duration {
+	return time.Duration(max(0, s) * float64(time.Second))
+}
+
+// Limiter picks the policy for a route and takes from the backend.
+type Limiter struct {
+	backend  Backend
+	policies map[string]Policy
+	// now is time.Now, tests replace it
+	now func() time.Time
+}
+
+// New makes a Limiter over backend with policies by route pattern, as the
+// mux has them, and DefaultRoute for the rest.
+func New(backend Backend, policies map[string]Policy) *Limiter {
+	return &Limiter{backend: backend, policies: policies, now: time.Now}
+}
+
+// Policy is the route's policy, or the default. ok is false if neither
+// limits anything.
+func (l *Limiter) Policy(route string) (Policy, bool) {
+	p, ok := l.policies[route]
+	if !ok {
+		p = l.policies[DefaultRoute]
+	}
+	return p, !p.Off()
+}
+
+// Take takes a token from key's bucket.
+func (l *Limiter) Take(ctx context.Context, key string, p Policy) (Result, error) {
+	return l.backend.Take(ctx, key, p, l.now())
+}
+
+// Refill is the longest any policy takes to fill from empty. Buckets left
+// alone that long are full and can be forgotten.
+func (l *Limiter) Refill() time.Duration {
+	longest := time.Duration(0)
+	for _, p := range l.policies {
+		if !p.Off() {
+			longest = max(longest, secs(float64(p.Burst)/p.rate()))
+		}
+	}
+	return longest
+}
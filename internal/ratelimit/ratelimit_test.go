@@ -0,0 +1,137 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/frankielb/chirpy/internal/database"
+)
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Policy
+	}{
+		{"30/1m", Policy{Limit: 30, Period: time.Minute, Burst: 30}},
+		{"5/h", Policy{Limit: 5, Period: time.Hour, Burst: 5}},
+		{"30/1m burst 10", Policy{Limit: 30, Period: time.Minute, Burst: 10}},
+		{"off", Policy{}},
+	}
+	for _, tt := range tests {
+		got, err := ParsePolicy(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ParsePolicy(%q) = %+v, %v, want %+v", tt.in, got, err, tt.want)
+		}
+		// String gives back something that parses the same
+		if again, err := ParsePolicy(got.String()); err != nil || again != got {
+			t.Errorf("ParsePolicy(%q) = %+v, %v", got.String(), again, err)
+		}
+	}
+	for _, bad := range []string{"", "30", "0/1m", "x/1m", "30/soon", "30/-1m", "30/1m burst 0"} {
+		if _, err := ParsePolicy(bad); err == nil {
+			t.Errorf("ParsePolicy(%q): expected an error", bad)
+		}
+	}
+}
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	p := Policy{Limit: 2, Period: time.Second, Burst: 3}
+	now := time.Unix(1000, 0)
+
+	for i := range 3 {
+		res, _ := m.Take(ctx, "k", p, now)
+		if !res.Allowed || res.Remaining != 2-i {
+			t.Fatalf("take %d: %+v", i, res)
+		}
+	}
+	res, _ := m.Take(ctx, "k", p, now)
+	if res.Allowed || res.RetryAfter != 500*time.Millisecond || res.Reset != 1500*time.Millisecond {
+		t.Fatalf("empty bucket: %+v", res)
+	}
+	// other keys have their own bucket
+	if res, _ := m.Take(ctx, "other", p, now); !res.Allowed {
+		t.Fatalf("other key: %+v", res)
+	}
+	// a token every half second
+	if res, _ := m.Take(ctx, "k", p, now.Add(500*time.Millisecond)); !res.Allowed || res.Remaining != 0 {
+		t.Fatalf("after refill: %+v", res)
+	}
+
+	// full buckets get swept
+	m.Take(ctx, "k", p, now.Add(time.Hour))
+	if len(m.buckets) != 1 {
+		t.Errorf("%d buckets after sweep, want 1", len(m.buckets))
+	}
+}
+
+// fakeQueries does in go what the upsert does in postgres.
+type fakeQueries struct {
+	rows map[string]database.RateLimit
+}
+
+func (f *fakeQueries) TakeRateLimitToken(ctx context.Context, arg database.TakeRateLimitTokenParams) (float64, error) {
+	row, ok := f.rows[arg.Key]
+	tokens := arg.Burst
+	if ok {
+		tokens = min(arg.Burst, row.Tokens+max(0, arg.Now.Sub(row.UpdatedAt).Seconds())*arg.Rate)
+	}
+	if tokens < 1 {
+		return 0, sql.ErrNoRows
+	}
+	f.rows[arg.Key] = database.RateLimit{Key: arg.Key, Tokens: tokens - 1, UpdatedAt: arg.Now}
+	return tokens - 1, nil
+}
+
+func (f *fakeQueries) GetRateLimit(ctx context.Context, key string) (database.RateLimit, error) {
+	row, ok := f.rows[key]
+	if !ok {
+		return row, sql.ErrNoRows
+	}
+	return row, nil
+}
+
+func (f *fakeQueries) DeleteRateLimitsBefore(ctx context.Context, updatedAt time.Time) error {
+	for key, row := range f.rows {
+		if row.UpdatedAt.Before(updatedAt) {
+			delete(f.rows, key)
+		}
+	}
+	return nil
+}
+
+func TestPostgres(t *testing.T) {
+	ctx := context.Background()
+	pg := NewPostgres(&fakeQueries{rows: map[string]database.RateLimit{}})
+	l := New(pg, map[string]Policy{
+		DefaultRoute:  {Limit: 1, Period: time.Minute, Burst: 1},
+		"GET /health": {},
+	})
+	now := time.Unix(1000, 0)
+	l.now = func() time.Time { return now }
+
+	if _, ok := l.Policy("GET /health"); ok {
+		t.Error("an off policy should not limit")
+	}
+	p, ok := l.Policy("POST /things")
+	if !ok {
+		t.Fatal("expected the default policy")
+	}
+	if res, err := l.Take(ctx, "k", p); err != nil || !res.Allowed {
+		t.Fatalf("first take: %+v, %v", res, err)
+	}
+	res, err := l.Take(ctx, "k", p)
+	if err != nil || res.Allowed || res.RetryAfter != time.Minute {
+		t.Fatalf("second take: %+v, %v", res, err)
+	}
+	now = now.Add(time.Minute)
+	if res, err := l.Take(ctx, "k", p); err != nil || !res.Allowed {
+		t.Fatalf("after a minute: %+v, %v", res, err)
+	}
+	if l.Refill() != time.Minute {
+		t.Errorf("Refill = %v", l.Refill())
+	}
+}
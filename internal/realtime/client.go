@@ -0,0 +1,151 @@
+package realtime
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// time allowed to write a message to the peer
+	writeWait = 10 * time.Second
+	// time allowed to read the next pong from the peer
+	pongWait = 60 * time.Second
+	// send pings at this period, must be less than pongWait
+	pingPeriod = (pongWait * 9) / 10
+	// biggest message we accept from a client
+	maxMessageSize = 4096
+	// queued messages per client before we treat it as too slow
+	sendBuffer = 64
+)
+
+// Client is one websocket connection for an authenticated user.
+type Client struct {
+	UserID uuid.UUID
+	hub    *Hub
+	conn   *websocket.Conn
+	send   chan Message
+	// only touched while holding hub.mu
+	topics    map[string]struct{}
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func NewClient(hub *Hub, conn *websocket.Conn, userID uuid.UUID) *Client {
+	return &Client{
+		UserID: userID,
+		hub:    hub,
+		conn:   conn,
+		send:   make(chan Message, sendBuffer),
+		topics: map[string]struct{}{},
+		done:   make(chan struct{}),
+	}
+}
+
+// enqueue never blocks, a full buffer means the client cant keep up so it
+// gets disconnected (backpressure).
+func (c *Client) enqueue(msg Message) {
+	select {
+	case <-c.done:
+	case c.send <- msg:
+	default:
+		c.close(websocket.CloseTryAgainLater, "client too slow")
+	}
+}
+
+func (c *Client) close(code int, reason string) {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(code, reason),
+			time.Now().Add(writeWait))
+		c.conn.Close()
+	})
+}
+
+// Run pumps messages both ways until the connection drops.
+func (c *Client) Run() {
+	go c.writePump()
+	c.readPump()
+}
+
+func (c *Client) readPump() {
+	defer func() {
+		c.hub.Unregister(c)
+		c.close(websocket.CloseNormalClosure, "")
+	}()
+	c.conn.SetReadLimit(maxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		c.conn.SetReadDeadline(time.Now().Add(pongWait))
+		return nil
+	})
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var msg Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			c.enqueue(Message{Type: TypeError, Error: "invalid message"})
+			continue
+		}
+		c.handle(msg)
+	}
+}
+
+func (c *Client) handle(msg Message) {
+	topics := msg.Topics
+	if msg.Topic != "" {
+		topics = append(topics, msg.Topic)
+	}
+	switch msg.Type {
+	case "subscribe":
+		ok := []string{}
+		for _, topic := range topics {
+			if err := c.hub.Subscribe(c, topic); err != nil {
+				c.enqueue(Message{Type: TypeError, Topic: topic, Error: err.Error()})
+				continue
+			}
+			normal, _ := NormalizeTopic(topic)
+			ok = append(ok, normal)
+		}
+		c.enqueue(Message{Type: TypeSubscribed, Topics: ok})
+	case "unsubscribe":
+		for _, topic := range topics {
+			c.hub.Unsubscribe(c, topic)
+		}
+		c.enqueue(Message{Type: TypeUnsubscribed, Topics: topics})
+	case "ping":
+		c.enqueue(Message{Type: TypePong})
+	default:
+		c.enqueue(Message{Type: TypeError, Error: "unknown message type"})
+	}
+}
+
+func (c *Client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case msg := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteJSON(msg); err != nil {
+				c.close(websocket.CloseInternalServerErr, "")
+				return
+			}
+		case <-ticker.C:
+			// heartbeat, the pong handler keeps the read deadline moving
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				c.close(websocket.CloseGoingAway, "")
+				return
+			}
+		}
+	}
+}
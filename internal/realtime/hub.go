@@ -0,0 +1,234 @@
+package realtime
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// message types sent by the server
+const (
+	TypeChirpCreated   = "chirp.created"
+	TypeChirpDeleted   = "chirp.deleted"
+	TypeUserUpgraded   = "user.upgraded"
+	TypeMessageCreated = "message.created"
+	// a moderator warned the user about one of their chirps
+	TypeModerationWarning = "moderation.warning"
+	TypeSubscribed        = "subscribed"
+	TypeUnsubscribed      = "unsubscribed"
+	TypePong              = "pong"
+	TypeError             = "error"
+)
+
+// topic prefixes clients can subscribe to
+const (
+	TopicUser    = "user:"    // own notifications, only the user themselves
+	TopicAuthor  = "author:"  // chirps from a followed user
+	TopicHashtag = "hashtag:" // chirps containing #tag
+)
+
+var (
+	ErrTooManyConnections = errors.New("too many connections for user")
+	ErrInvalidTopic       = errors.New("invalid topic")
+	ErrForbiddenTopic     = errors.New("cannot subscribe to another user's notifications")
+)
+
+// Message is the typed JSON envelope for everything on the socket.
+type Message struct {
+	Type   string   `json:"type"`
+	Topic  string   `json:"topic,omitempty"`
+	Topics []string `json:"topics,omitempty"`
+	Data   any      `json:"data,omitempty"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// Hub is the server side registry of connections and their topics.
+type Hub struct {
+	mu     sync.RWMutex
+	users  map[uuid.UUID]map[*Client]struct{}
+	topics map[string]map[*Client]struct{}
+	// max open sockets per user, 0 means no limit
+	MaxConnsPerUser int
+}
+
+func NewHub(maxConnsPerUser int) *Hub {
+	return &Hub{
+		users:           map[uuid.UUID]map[*Client]struct{}{},
+		topics:          map[string]map[*Client]struct{}{},
+		MaxConnsPerUser: maxConnsPerUser,
+	}
+}
+
+// Register adds a client, checking the per user limit.
+func (h *Hub) Register(c *Client) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	conns := h.users[c.UserID]
+	if h.MaxConnsPerUser > 0 && len(conns) >= h.MaxConnsPerUser {
+		return ErrTooManyConnections
+	}
+	if conns == nil {
+		conns = map[*Client]struct{}{}
+		h.users[c.UserID] = conns
+	}
+	conns[c] = struct{}{}
+	return nil
+}
+
+// CanRegister reports if a user is under the limit, used before upgrading.
+func (h *Hub) CanRegister(userID uuid.UUID) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.MaxConnsPerUser <= 0 || len(h.users[userID]) < h.MaxConnsPerUser
+}
+
+// Unregister removes a client and all its subscriptions.
+func (h *Hub) Unregister(c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if conns, ok := h.users[c.UserID]; ok {
+		delete(conns, c)
+		if len(conns) == 0 {
+			delete(h.users, c.UserID)
+		}
+	}
+	for topic := range c.topics {
+		h.removeFromTopic(topic, c)
+	}
+	c.topics = map[string]struct{}{}
+}
+
+func (h *Hub) Subscribe(c *Client, topic string) error {
+	topic, err := NormalizeTopic(topic)
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(topic, TopicUser) && topic != UserTopic(c.UserID) {
+		return ErrForbiddenTopic
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	subs := h.topics[topic]
+	if subs == nil {
+		subs = map[*Client]struct{}{}
+		h.topics[topic] = subs
+	}
+	subs[c] = struct{}{}
+	c.topics[topic] = struct{}{}
+	return nil
+}
+
+func (h *Hub) Unsubscribe(c *Client, topic string) {
+	topic, err := NormalizeTopic(topic)
+	if err != nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.removeFromTopic(topic, c)
+	delete(c.topics, topic)
+}
+
+func (h *Hub) removeFromTopic(topic string, c *Client) {
+	if subs, ok := h.topics[topic]; ok {
+		delete(subs, c)
+		if len(subs) == 0 {
+			delete(h.topics, topic)
+		}
+	}
+}
+
+// Publish sends a message to everyone subscribed to the topic, except users
+// in skip. Slow clients get dropped rather than blocking the publisher.
+func (h *Hub) Publish(topic, msgType string, data any, skip map[uuid.UUID]bool) {
+	msg := Message{Type: msgType, Topic: topic, Data: data}
+	h.mu.RLock()
+	subs := make([]*Client, 0, len(h.topics[topic]))
+	for c := range h.topics[topic] {
+		subs = append(subs, c)
+	}
+	h.mu.RUnlock()
+	for _, c := range subs {
+		if skip[c.UserID] {
+			continue
+		}
+		c.enqueue(msg)
+	}
+}
+
+// CloseAll disconnects every client with a going away close frame, for
+// shutdown. http.Server.Shutdown doesn't wait on hijacked websockets.
+func (h *Hub) CloseAll() {
+	h.mu.RLock()
+	var clients []*Client
+	for _, conns := range h.users {
+		for c := range conns {
+			clients = append(clients, c)
+		}
+	}
+	h.mu.RUnlock()
+	for _, c := range clients {
+		c.close(websocket.CloseGoingAway, "server shutting down")
+	}
+}
+
+// ConnCount is the number of open sockets for a user.
+func (h *Hub) ConnCount(userID uuid.UUID) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.users[userID])
+}
+
+func UserTopic(id uuid.UUID) string   { return TopicUser + id.String() }
+func AuthorTopic(id uuid.UUID) string { return TopicAuthor + id.String() }
+func HashtagTopic(tag string) string  { return TopicHashtag + strings.ToLower(tag) }
+
+// NormalizeTopic checks the topic is one we know and cleans it up.
+func NormalizeTopic(topic string) (string, error) {
+	switch {
+	case strings.HasPrefix(topic, TopicUser), strings.HasPrefix(topic, TopicAuthor):
+		prefix, rest, _ := strings.Cut(topic, ":")
+		id, err := uuid.Parse(rest)
+		if err != nil {
+			return "", ErrInvalidTopic
+		}
+		return prefix + ":" + id.String(), nil
+	case strings.HasPrefix(topic, TopicHashtag):
+		tag := strings.TrimPrefix(strings.TrimPrefix(topic, TopicHashtag), "#")
+		if tag == "" || !isTag(tag) {
+			return "", ErrInvalidTopic
+		}
+		return HashtagTopic(tag), nil
+	}
+	return "", ErrInvalidTopic
+}
+
+// Hashtags pulls the unique lower cased #tags out of a chirp body.
+func Hashtags(body string) []string {
+	seen := map[string]bool{}
+	tags := []string{}
+	for _, word := range strings.Fields(body) {
+		if !strings.HasPrefix(word, "#") {
+			continue
+		}
+		tag := strings.ToLower(strings.TrimRight(word[1:], ".,!?;:"))
+		if tag == "" || !isTag(tag) || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+func isTag(s string) bool {
+	for _, r := range s {
+		if !(r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
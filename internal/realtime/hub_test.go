@@ -0,0 +1,62 @@
+package realtime
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestHubSubscribeAndPublish(t *testing.T) {
+	hub := NewHub(2)
+	userID := uuid.New()
+
+	t.Run("Connection Limit", func(t *testing.T) {
+		a := NewClient(hub, nil, userID)
+		b := NewClient(hub, nil, userID)
+		if err := hub.Register(a); err != nil {
+			t.Fatalf("failed to register: %v", err)
+		}
+		if err := hub.Register(b); err != nil {
+			t.Fatalf("failed to register: %v", err)
+		}
+		if err := hub.Register(NewClient(hub, nil, userID)); err != ErrTooManyConnections {
+			t.Errorf("expected ErrTooManyConnections, got: %v", err)
+		}
+		hub.Unregister(a)
+		hub.Unregister(b)
+		if hub.ConnCount(userID) != 0 {
+			t.Errorf("expected no connections, got: %d", hub.ConnCount(userID))
+		}
+	})
+	t.Run("Topics", func(t *testing.T) {
+		c := NewClient(hub, nil, userID)
+		hub.Register(c)
+		defer hub.Unregister(c)
+
+		if err := hub.Subscribe(c, UserTopic(uuid.New())); err != ErrForbiddenTopic {
+			t.Errorf("expected ErrForbiddenTopic, got: %v", err)
+		}
+		if err := hub.Subscribe(c, "nonsense"); err != ErrInvalidTopic {
+			t.Errorf("expected ErrInvalidTopic, got: %v", err)
+		}
+		if err := hub.Subscribe(c, "hashtag:#Go"); err != nil {
+			t.Fatalf("failed to subscribe: %v", err)
+		}
+		hub.Publish(HashtagTopic("go"), TypeChirpCreated, "hi", nil)
+		hub.Publish(HashtagTopic("rust"), TypeChirpCreated, "nope", nil)
+		if len(c.send) != 1 {
+			t.Fatalf("expected 1 queued message, got: %d", len(c.send))
+		}
+		msg := <-c.send
+		if msg.Topic != "hashtag:go" || msg.Data != "hi" {
+			t.Errorf("wrong message: %+v", msg)
+		}
+	})
+}
+
+func TestHashtags(t *testing.T) {
+	got := Hashtags("loving #Go and #go, also #rust! not#this #")
+	if len(got) != 2 || got[0] != "go" || got[1] != "rust" {
+		t.Errorf("wrong tags: %v", got)
+	}
+}
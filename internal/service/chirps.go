@@ -0,0 +1,173 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/frankielb/chirpy/internal/database"
+	"github.com/frankielb/chirpy/internal/realtime"
+	"github.com/frankielb/chirpy/internal/store"
+	"github.com/google/uuid"
+)
+
+// swapped for **** in new chirps
+var profanes = map[string]bool{
+	"kerfuffle": true,
+	"sharbert":  true,
+	"fornax":    true,
+}
+
+// cleanBody stars out the swearwords.
+func cleanBody(body string) string {
+	words := strings.Split(body, " ")
+	for i, word := range words {
+		if profanes[strings.ToLower(word)] {
+			words[i] = "****"
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// CreateChirp posts body as the user, with the swearwords starred out.
+func (s *Service) CreateChirp(ctx context.Context, userID uuid.UUID, body string) (database.Chirp, error) {
+	if err := s.CheckNotSuspended(ctx, userID); err != nil {
+		return database.Chirp{}, err
+	}
+	var v Validator
+	v.Check(body != "", "body", "required", "Chirp is empty")
+	v.Check(len(body) <= s.MaxChirpLength, "body", "too_long", "Chirp is too long")
+	if err := v.Err(); err != nil {
+		return database.Chirp{}, err
+	}
+
+	chirp, err := s.DB.CreateChirp(ctx, database.CreateChirpParams{
+		Body:   cleanBody(body),
+		UserID: userID,
+	})
+	if store.IsUniqueViolation(err) {
+		return database.Chirp{}, fail(ErrConflict, "That chirp has already been posted", err)
+	}
+	if err != nil {
+		return database.Chirp{}, fail(ErrInternal, "Couldn't create chirp", err)
+	}
+	s.Metrics.ChirpsCreated.Inc()
+	s.publish(ctx, realtime.TypeChirpCreated, chirp)
+	return chirp, nil
+}
+
+// ListChirpsParams picks the chirps for EachChirp.
+type ListChirpsParams struct {
+	// who's asking, uuid.Nil when logged out. Their blocks and mutes are
+	// left out.
+	ViewerID uuid.UUID
+	// only this user's chirps if set
+	AuthorID uuid.UUID
+	// newest first
+	Desc bool
+}
+
+// EachChirp calls fn with each chirp as it's read, an error from fn stops
+// it and is returned as it is.
+func (s *Service) EachChirp(ctx context.Context, arg ListChirpsParams, fn func(database.Chirp) error) error {
+	var fnErr error
+	err := s.DB.EachChirp(ctx, database.EachChirpParams{
+		UserID:   arg.AuthorID,
+		ViewerID: arg.ViewerID,
+		Desc:     arg.Desc,
+	}, func(c database.Chirp) error {
+		fnErr = fn(c)
+		return fnErr
+	})
+	if err != nil && err == fnErr {
+		return err
+	}
+	if err != nil {
+		return fail(ErrInternal, "Couldn't get chirps", err)
+	}
+	return nil
+}
+
+// ChirpsVersion is the number of chirps EachChirp would give for arg and a
+// digest of which ones at which version. Adding, removing, editing or
+// hiding a chirp in the listing, or a block that changes who's in it,
+// changes it without reading the lot.
+func (s *Service) ChirpsVersion(ctx context.Context, arg ListChirpsParams) (database.GetChirpsVersionRow, error) {
+	var v database.GetChirpsVersionRow
+	var err error
+	if arg.AuthorID == uuid.Nil {
+		v, err = s.DB.GetChirpsVersion(ctx, arg.ViewerID)
+	} else {
+		var byUser database.GetChirpsByUserVersionRow
+		byUser, err = s.DB.GetChirpsByUserVersion(ctx, database.GetChirpsByUserVersionParams{
+			UserID:   arg.AuthorID,
+			ViewerID: arg.ViewerID,
+		})
+		v = database.GetChirpsVersionRow(byUser)
+	}
+	if err != nil {
+		return v, fail(ErrInternal, "Couldn't get chirps", err)
+	}
+	return v, nil
+}
+
+// GetChirp finds a chirp, ones hidden by a moderator aren't found.
+func (s *Service) GetChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	chirp, err := s.DB.GetChirp(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return database.Chirp{}, fail(ErrNotFound, "Chirp not found", err)
+		}
+		return database.Chirp{}, fail(ErrInternal, "Internal server error", err)
+	}
+	if chirp.HiddenAt.Valid {
+		return database.Chirp{}, fail(ErrNotFound, "Chirp not found", nil)
+	}
+	return chirp, nil
+}
+
+// DeleteChirp deletes one of the user's own chirps. match, if given, is
+// asked whether the chirp is still the version the client saw.
+func (s *Service) DeleteChirp(ctx context.Context, userID, chirpID uuid.UUID, match func(database.Chirp) bool) error {
+	chirp, err := s.DB.GetChirp(ctx, chirpID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fail(ErrNotFound, "Chirp not found", err)
+		}
+		return fail(ErrInternal, "Internal server error", err)
+	}
+	if userID != chirp.UserID {
+		return fail(ErrForbidden, "unauthorized", nil)
+	}
+	// someone else may have changed it since this client last saw it
+	if match != nil && !match(chirp) {
+		return fail(ErrPrecondition, "the chirp has changed since you fetched it", nil)
+	}
+	if match == nil {
+		err = s.DB.DeleteChirpByID(ctx, chirpID)
+	} else {
+		// or between here and the delete, so it only goes if it's still the
+		// version match passed
+		var n int64
+		n, err = s.DB.DeleteChirpIfUnchanged(ctx, database.DeleteChirpIfUnchangedParams{
+			ID:        chirpID,
+			UserID:    userID,
+			UpdatedAt: chirp.UpdatedAt,
+		})
+		if err == nil && n == 0 {
+			return fail(ErrPrecondition, "the chirp has changed since you fetched it", nil)
+		}
+	}
+	if err != nil {
+		return fail(ErrInternal, "couldn't delete chirp", err)
+	}
+	s.publish(ctx, realtime.TypeChirpDeleted, chirp)
+	return nil
+}
+
+func (s *Service) publish(ctx context.Context, msgType string, chirp database.Chirp) {
+	if s.OnChirp != nil {
+		s.OnChirp(ctx, msgType, chirp)
+	}
+}
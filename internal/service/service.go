@@ -0,0 +1,120 @@
+// Package service is the business logic behind both the http api and the
+// grpc one. It doesn't know about either, the callers work out who the
+// user is and turn the errors into their own statuses.
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/frankielb/chirpy/internal/config"
+	"github.com/frankielb/chirpy/internal/database"
+	"github.com/frankielb/chirpy/internal/metrics"
+	"github.com/frankielb/chirpy/internal/store"
+	"github.com/google/uuid"
+)
+
+// The kinds of failure, match them with errors.Is.
+var (
+	ErrInvalid      = errors.New("invalid")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrPrecondition = errors.New("precondition failed")
+	ErrInternal     = errors.New("internal")
+)
+
+// FieldError is one thing wrong with one field of a request.
+type FieldError struct {
+	Field   string
+	Code    string
+	Message string
+}
+
+// Error is what the service methods fail with. Msg is fine to show the
+// client, Err is the cause and only for the logs.
+type Error struct {
+	Kind   error
+	Msg    string
+	Fields []FieldError
+	Err    error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Msg, e.Err)
+	}
+	return e.Msg
+}
+
+func (e *Error) Is(target error) bool { return target == e.Kind }
+func (e *Error) Unwrap() error        { return e.Err }
+
+func fail(kind error, msg string, err error) *Error {
+	return &Error{Kind: kind, Msg: msg, Err: err}
+}
+
+// Validator collects every bad field so the client hears about them all at
+// once, not one per round trip. The http handlers use it for their own
+// request checks too.
+type Validator struct {
+	fields []FieldError
+}
+
+// Check records a problem with field unless ok.
+func (v *Validator) Check(ok bool, field, code, msg string) {
+	if !ok {
+		v.fields = append(v.fields, FieldError{Field: field, Code: code, Message: msg})
+	}
+}
+
+// Err is nil if every check passed, otherwise an ErrInvalid with a
+// FieldError for each failure.
+func (v *Validator) Err() error {
+	if len(v.fields) == 0 {
+		return nil
+	}
+	return &Error{Kind: ErrInvalid, Msg: v.fields[0].Message, Fields: v.fields}
+}
+
+// Service holds what the business logic needs, the http and grpc servers
+// share one.
+type Service struct {
+	// Secret, token lifetimes and chirp length come from here. A pointer so
+	// it stays the same config the http side has.
+	*config.Config
+	DB      store.Store
+	Metrics *metrics.Metrics
+	// told about chirps being created and deleted, msgType is one of the
+	// realtime.TypeChirp* ones
+	OnChirp func(ctx context.Context, msgType string, chirp database.Chirp)
+}
+
+// IsSuspended is true while a suspension is running, one with no end
+// never runs out.
+func IsSuspended(user database.User) bool {
+	if !user.SuspendedAt.Valid {
+		return false
+	}
+	return !user.SuspendedUntil.Valid || user.SuspendedUntil.Time.After(time.Now())
+}
+
+// CheckNotSuspended fails if the user is gone or suspended, for anything
+// that posts.
+func (s *Service) CheckNotSuspended(ctx context.Context, userID uuid.UUID) error {
+	user, err := s.DB.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fail(ErrUnauthorized, "unauthorized: no user", err)
+		}
+		return fail(ErrInternal, "Couldn't get user", err)
+	}
+	if IsSuspended(user) {
+		return fail(ErrForbidden, "account suspended", nil)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/frankielb/chirpy/internal/config"
+	"github.com/frankielb/chirpy/internal/database"
+	"github.com/frankielb/chirpy/internal/metrics"
+	"github.com/frankielb/chirpy/internal/realtime"
+	"github.com/frankielb/chirpy/internal/store"
+)
+
+func newTestService(t *testing.T) (*Service, *[]string) {
+	t.Helper()
+	conf := config.Default()
+	conf.Secret = "test-secret"
+	var published []string
+	s := &Service{
+		Config:  &conf,
+		DB:      store.NewMemory(),
+		Metrics: metrics.New(),
+		OnChirp: func(ctx context.Context, msgType string, chirp database.Chirp) {
+			published = append(published, msgType)
+		},
+	}
+	return s, &published
+}
+
+func TestUsers(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestService(t)
+
+	// both bad fields come back at once
+	_, err := s.CreateUser(ctx, "nope", "")
+	var serr *Error
+	if !errors.As(err, &serr) || !errors.Is(err, ErrInvalid) || len(serr.Fields) != 2 {
+		t.Fatalf("CreateUser bad fields: %v", err)
+	}
+	user, err := s.CreateUser(ctx, "alice@example.com", "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateUser(ctx, "alice@example.com", "other"); !errors.Is(err, ErrConflict) {
+		t.Errorf("duplicate email: %v", err)
+	}
+
+	if _, err := s.Login(ctx, "alice@example.com", "wrong"); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("wrong password: %v", err)
+	}
+	session, err := s.Login(ctx, "alice@example.com", "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.User.ID != user.ID || session.Token == "" || session.RefreshToken == "" {
+		t.Errorf("session = %+v", session)
+	}
+	if _, err := s.Refresh(ctx, session.RefreshToken); err != nil {
+		t.Errorf("Refresh: %v", err)
+	}
+	if err := s.Revoke(ctx, session.RefreshToken); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Refresh(ctx, session.RefreshToken); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Refresh after revoke: %v", err)
+	}
+
+	updated, err := s.UpdateUser(ctx, user.ID, "alice2@example.com", "hunter3")
+	if err != nil || updated.Email != "alice2@example.com" {
+		t.Errorf("UpdateUser = %+v, %v", updated, err)
+	}
+}
+
+func TestChirps(t *testing.T) {
+	ctx := context.Background()
+	s, published := newTestService(t)
+	alice, err := s.CreateUser(ctx, "alice@example.com", "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := s.CreateUser(ctx, "bob@example.com", "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chirp, err := s.CreateChirp(ctx, alice.ID, "what a Kerfuffle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chirp.Body != "what a ****" {
+		t.Errorf("body = %q", chirp.Body)
+	}
+	long := make([]byte, s.MaxChirpLength+1)
+	if _, err := s.CreateChirp(ctx, alice.ID, string(long)); !errors.Is(err, ErrInvalid) {
+		t.Errorf("too long: %v", err)
+	}
+	if _, err := s.CreateChirp(ctx, alice.ID, "what a Kerfuffle"); !errors.Is(err, ErrConflict) {
+		t.Errorf("repeat: %v", err)
+	}
+
+	var n int
+	if err := s.EachChirp(ctx, ListChirpsParams{AuthorID: alice.ID}, func(database.Chirp) error {
+		n++
+		return nil
+	}); err != nil || n != 1 {
+		t.Errorf("EachChirp got %d, %v", n, err)
+	}
+	stop := errors.New("stop")
+	if err := s.EachChirp(ctx, ListChirpsParams{}, func(database.Chirp) error { return stop }); err != stop {
+		t.Errorf("EachChirp didn't hand back fn's error: %v", err)
+	}
+
+	if err := s.DeleteChirp(ctx, bob.ID, chirp.ID, nil); !errors.Is(err, ErrForbidden) {
+		t.Errorf("someone else's chirp: %v", err)
+	}
+	never := func(database.Chirp) bool { return false }
+	if err := s.DeleteChirp(ctx, alice.ID, chirp.ID, never); !errors.Is(err, ErrPrecondition) {
+		t.Errorf("changed chirp: %v", err)
+	}
+	// changed between the check and the delete
+	hideFirst := func(database.Chirp) bool {
+		if err := s.DB.HideChirp(ctx, chirp.ID); err != nil {
+			t.Fatal(err)
+		}
+		return true
+	}
+	if err := s.DeleteChirp(ctx, alice.ID, chirp.ID, hideFirst); !errors.Is(err, ErrPrecondition) {
+		t.Errorf("chirp changed mid delete: %v", err)
+	}
+	if err := s.DeleteChirp(ctx, alice.ID, chirp.ID, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetChirp(ctx, chirp.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("deleted chirp: %v", err)
+	}
+	want := []string{realtime.TypeChirpCreated, realtime.TypeChirpDeleted}
+	if len(*published) != 2 || (*published)[0] != want[0] || (*published)[1] != want[1] {
+		t.Errorf("published %v, want %v", *published, want)
+	}
+}
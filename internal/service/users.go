@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/frankielb/chirpy/internal/auth"
+	"github.com/frankielb/chirpy/internal/database"
+	"github.com/frankielb/chirpy/internal/store"
+	"github.com/google/uuid"
+)
+
+func checkUser(email, password string) error {
+	var v Validator
+	v.Check(strings.Contains(email, "@"), "email", "invalid", "Email isn't an email address")
+	v.Check(password != "", "password", "required", "Password is required")
+	return v.Err()
+}
+
+// CreateUser signs up a new user.
+func (s *Service) CreateUser(ctx context.Context, email, password string) (database.User, error) {
+	if err := checkUser(email, password); err != nil {
+		return database.User{}, err
+	}
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return database.User{}, fail(ErrInternal, "Couldnt hash password", err)
+	}
+	user, err := s.DB.CreateUser(ctx, database.CreateUserParams{
+		Email:          email,
+		HashedPassword: hash,
+	})
+	if err != nil {
+		if store.IsUniqueViolation(err) {
+			return database.User{}, fail(ErrConflict, "Email is already taken", err)
+		}
+		return database.User{}, fail(ErrInternal, "Couldn't create user", err)
+	}
+	return user, nil
+}
+
+// UpdateUser changes the user's email and password.
+func (s *Service) UpdateUser(ctx context.Context, userID uuid.UUID, email, password string) (database.User, error) {
+	if err := checkUser(email, password); err != nil {
+		return database.User{}, err
+	}
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return database.User{}, fail(ErrInternal, "couldn't hash password", err)
+	}
+	if err := s.DB.UpdatePswdEml(ctx, database.UpdatePswdEmlParams{
+		HashedPassword: hash,
+		Email:          email,
+		ID:             userID,
+	}); err != nil {
+		if store.IsUniqueViolation(err) {
+			return database.User{}, fail(ErrConflict, "Email is already taken", err)
+		}
+		return database.User{}, fail(ErrInternal, "couldn't update", err)
+	}
+	user, err := s.DB.GetUserByID(ctx, userID)
+	if err != nil {
+		return database.User{}, fail(ErrInternal, "didnt update", err)
+	}
+	return user, nil
+}
+
+// Session is what a login gets, an access token and the refresh token to
+// get more with.
+type Session struct {
+	User         database.User
+	Token        string
+	RefreshToken string
+}
+
+// Login checks the password and starts a session.
+func (s *Service) Login(ctx context.Context, email, password string) (Session, error) {
+	var v Validator
+	v.Check(email != "", "email", "required", "Email is required")
+	v.Check(password != "", "password", "required", "Password is required")
+	if err := v.Err(); err != nil {
+		return Session{}, err
+	}
+	user, err := s.DB.GetUserByEmail(ctx, email)
+	if err != nil {
+		s.Metrics.FailedLogins.Inc()
+		return Session{}, fail(ErrUnauthorized, "Incorrect email or password", err)
+	}
+	if err := auth.CheckPasswordHash(user.HashedPassword, password); err != nil {
+		s.Metrics.FailedLogins.Inc()
+		return Session{}, fail(ErrUnauthorized, "Incorrect email or password", err)
+	}
+	if IsSuspended(user) {
+		return Session{}, fail(ErrForbidden, "account suspended", nil)
+	}
+
+	token, err := auth.MakeJWT(user.ID, s.Secret, s.AccessTokenTTL)
+	if err != nil {
+		return Session{}, fail(ErrInternal, "coiuldnt create auth token", err)
+	}
+	refresh, err := auth.MakeRefreshToken()
+	if err != nil {
+		return Session{}, fail(ErrInternal, "coiuldnt create auth token", err)
+	}
+	if _, err := s.DB.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+		Token:     refresh,
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(s.RefreshTokenTTL),
+	}); err != nil {
+		return Session{}, fail(ErrInternal, "coiuldnt add re token to db", err)
+	}
+	s.Metrics.Logins.Inc()
+	return Session{User: user, Token: token, RefreshToken: refresh}, nil
+}
+
+// Refresh makes a new access token from a refresh token that's still good.
+func (s *Service) Refresh(ctx context.Context, refreshToken string) (string, error) {
+	token, err := s.DB.GetRefreshTokenFromToken(ctx, refreshToken)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", fail(ErrUnauthorized, "invalid token: nf", err)
+		}
+		return "", fail(ErrInternal, "couldn't get token", err)
+	}
+	if token.ExpiresAt.Before(time.Now()) {
+		return "", fail(ErrUnauthorized, "invalid token: exp", nil)
+	}
+	if token.RevokedAt.Valid {
+		return "", fail(ErrUnauthorized, "invalid token: rvkd", nil)
+	}
+	if err := s.CheckNotSuspended(ctx, token.UserID); err != nil {
+		return "", err
+	}
+	access, err := auth.MakeJWT(token.UserID, s.Secret, s.AccessTokenTTL)
+	if err != nil {
+		return "", fail(ErrInternal, "couldn't create access token", err)
+	}
+	return access, nil
+}
+
+// Revoke ends the session the refresh token belongs to.
+func (s *Service) Revoke(ctx context.Context, refreshToken string) error {
+	if err := s.DB.RevokeToken(ctx, refreshToken); err != nil {
+		return fail(ErrInternal, "couldn't revoke token", err)
+	}
+	return nil
+}
@@ -0,0 +1,835 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/frankielb/chirpy/internal/database"
+	"github.com/frankielb/chirpy/internal/migrate"
+	"github.com/google/uuid"
+)
+
+// every backend runs the same suite so the handlers cant tell them apart.
+// postgres only runs when CHIRPY_TEST_POSTGRES_URL is set, it gets wiped.
+func TestConformance(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		runConformance(t, func(t *testing.T) Store { return NewMemory() })
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		runConformance(t, func(t *testing.T) Store {
+			s, conn, err := Open("sqlite::memory:")
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { conn.Close() })
+			if err := migrate.Up(context.Background(), conn, DriverSQLite); err != nil {
+				t.Fatal(err)
+			}
+			return s
+		})
+	})
+	t.Run("postgres", func(t *testing.T) {
+		url := os.Getenv("CHIRPY_TEST_POSTGRES_URL")
+		if url == "" {
+			t.Skip("CHIRPY_TEST_POSTGRES_URL not set")
+		}
+		runConformance(t, func(t *testing.T) Store {
+			s, conn, err := Open(url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { conn.Close() })
+			if err := migrate.Up(context.Background(), conn, DriverPostgres); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.DeleteAllUsers(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			return s
+		})
+	})
+}
+
+func runConformance(t *testing.T, newStore func(t *testing.T) Store) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s Store)
+	}{
+		{"users", testUsers},
+		{"chirps", testChirps},
+		{"chirp pages", testChirpPages},
+		{"chirps version", testChirpsVersion},
+		{"refresh tokens", testRefreshTokens},
+		{"conversations", testConversations},
+		{"blocks and mutes", testBlocks},
+		{"reports", testReports},
+		{"idempotency keys", testIdempotencyKeys},
+		{"delete all users", testDeleteAllUsers},
+		{"transactions", testTransactions},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore(t))
+		})
+	}
+}
+
+func mustUser(t *testing.T, s Store) database.User {
+	t.Helper()
+	u, err := s.CreateUser(context.Background(), database.CreateUserParams{
+		Email:          uuid.NewString() + "@example.com",
+		HashedPassword: "hash",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func mustChirp(t *testing.T, s Store, userID uuid.UUID, body string) database.Chirp {
+	t.Helper()
+	c, err := s.CreateChirp(context.Background(), database.CreateChirpParams{Body: body, UserID: userID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func chirpBodies(chirps []database.Chirp) []string {
+	var out []string
+	for _, c := range chirps {
+		out = append(out, c.Body)
+	}
+	return out
+}
+
+func testUsers(t *testing.T, s Store) {
+	ctx := context.Background()
+	u := mustUser(t, s)
+	if u.ID == uuid.Nil || u.CreatedAt.IsZero() || u.Role != "user" || u.IsChirpyRed {
+		t.Fatalf("bad new user: %+v", u)
+	}
+
+	_, err := s.CreateUser(ctx, database.CreateUserParams{Email: u.Email, HashedPassword: "x"})
+	if !IsUniqueViolation(err) {
+		t.Fatalf("duplicate email: got %v, want unique violation", err)
+	}
+
+	got, err := s.GetUserByEmail(ctx, u.Email)
+	if err != nil || got.ID != u.ID {
+		t.Fatalf("GetUserByEmail = %v, %v", got.ID, err)
+	}
+	if _, err := s.GetUserByID(ctx, uuid.New()); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("missing user: got %v, want sql.ErrNoRows", err)
+	}
+
+	err = s.UpdatePswdEml(ctx, database.UpdatePswdEmlParams{
+		HashedPassword: "new",
+		Email:          "changed-" + u.Email,
+		ID:             u.ID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpgradeRedByID(ctx, u.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetUserRole(ctx, database.SetUserRoleParams{ID: u.ID, Role: "moderator"}); err != nil {
+		t.Fatal(err)
+	}
+	until := time.Now().Add(time.Hour).Truncate(time.Microsecond)
+	err = s.SuspendUser(ctx, database.SuspendUserParams{
+		ID:             u.ID,
+		SuspendedUntil: sql.NullTime{Time: until, Valid: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = s.GetUserByID(ctx, u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.HashedPassword != "new" || got.Email != "changed-"+u.Email || !got.IsChirpyRed || got.Role != "moderator" {
+		t.Fatalf("updates not saved: %+v", got)
+	}
+	if !got.SuspendedAt.Valid || !got.SuspendedUntil.Time.Equal(until) {
+		t.Fatalf("suspension = %v until %v, want until %v", got.SuspendedAt, got.SuspendedUntil, until)
+	}
+
+	if err := s.UnsuspendUser(ctx, u.ID); err != nil {
+		t.Fatal(err)
+	}
+	got, _ = s.GetUserByID(ctx, u.ID)
+	if got.SuspendedAt.Valid || got.SuspendedUntil.Valid {
+		t.Fatalf("still suspended: %+v", got)
+	}
+
+	if err := s.DowngradeRedByID(ctx, u.ID); err != nil {
+		t.Fatal(err)
+	}
+	other := mustUser(t, s)
+	users, err := s.ListUsers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || users[0].ID != u.ID || users[1].ID != other.ID || users[0].IsChirpyRed {
+		t.Fatalf("ListUsers = %+v", users)
+	}
+
+	// racing for the same email, only one may get it
+	var wg sync.WaitGroup
+	var won atomic.Int32
+	email := "taken-" + u.Email
+	for range 4 {
+		racer := mustUser(t, s)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := s.UpdatePswdEml(ctx, database.UpdatePswdEmlParams{HashedPassword: "x", Email: email, ID: racer.ID})
+			if err == nil {
+				won.Add(1)
+			} else if !IsUniqueViolation(err) {
+				t.Errorf("racing UpdatePswdEml: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if won.Load() != 1 {
+		t.Fatalf("%d users got the same email", won.Load())
+	}
+}
+
+func testChirps(t *testing.T, s Store) {
+	ctx := context.Background()
+	alice, bob := mustUser(t, s), mustUser(t, s)
+	first := mustChirp(t, s, alice.ID, "first")
+	mustChirp(t, s, bob.ID, "second")
+	hidden := mustChirp(t, s, alice.ID, "hidden")
+	mustChirp(t, s, alice.ID, "third")
+
+	if err := s.HideChirp(ctx, hidden.ID); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.GetChirp(ctx, hidden.ID)
+	if err != nil || !got.HiddenAt.Valid {
+		t.Fatalf("hidden chirp = %+v, %v", got, err)
+	}
+
+	all, err := s.GetChirps(ctx, uuid.Nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(chirpBodies(all), ","); got != "first,second,third" {
+		t.Fatalf("GetChirps = %s", got)
+	}
+	mine, err := s.GetChirpsByUser(ctx, database.GetChirpsByUserParams{UserID: alice.ID, ViewerID: uuid.Nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(chirpBodies(mine), ","); got != "first,third" {
+		t.Fatalf("GetChirpsByUser = %s", got)
+	}
+	each := func(arg database.EachChirpParams) string {
+		var bodies []string
+		if err := s.EachChirp(ctx, arg, func(c database.Chirp) error {
+			bodies = append(bodies, c.Body)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return strings.Join(bodies, ",")
+	}
+	if got := each(database.EachChirpParams{}); got != "first,second,third" {
+		t.Fatalf("EachChirp = %s", got)
+	}
+	if got := each(database.EachChirpParams{UserID: alice.ID, Desc: true}); got != "third,first" {
+		t.Fatalf("EachChirp by alice desc = %s", got)
+	}
+	stop := errors.New("stop")
+	n := 0
+	err = s.EachChirp(ctx, database.EachChirpParams{}, func(database.Chirp) error {
+		n++
+		return stop
+	})
+	if err != stop || n != 1 {
+		t.Fatalf("EachChirp after fn error = %v, %d rows", err, n)
+	}
+
+	// hidden isn't in the listing
+	v, err := s.GetChirpsVersion(ctx, uuid.Nil)
+	if err != nil || v.Total != 3 || v.Digest == "" {
+		t.Fatalf("GetChirpsVersion = %+v, %v", v, err)
+	}
+
+	stale := database.DeleteChirpIfUnchangedParams{ID: first.ID, UserID: alice.ID, UpdatedAt: first.UpdatedAt.Add(-time.Second)}
+	if n, err := s.DeleteChirpIfUnchanged(ctx, stale); err != nil || n != 0 {
+		t.Fatalf("DeleteChirpIfUnchanged on an old version = %d, %v", n, err)
+	}
+	notMine := database.DeleteChirpIfUnchangedParams{ID: first.ID, UserID: uuid.New(), UpdatedAt: first.UpdatedAt}
+	if n, err := s.DeleteChirpIfUnchanged(ctx, notMine); err != nil || n != 0 {
+		t.Fatalf("DeleteChirpIfUnchanged by someone else = %d, %v", n, err)
+	}
+	if n, err := s.DeleteChirpIfUnchanged(ctx, database.DeleteChirpIfUnchangedParams{ID: first.ID, UserID: alice.ID, UpdatedAt: first.UpdatedAt}); err != nil || n != 1 {
+		t.Fatalf("DeleteChirpIfUnchanged = %d, %v", n, err)
+	}
+	if _, err := s.GetChirp(ctx, first.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("deleted chirp: got %v, want sql.ErrNoRows", err)
+	}
+	mv, err := s.GetChirpsByUserVersion(ctx, database.GetChirpsByUserVersionParams{UserID: alice.ID})
+	if err != nil || mv.Total != 1 {
+		t.Fatalf("GetChirpsByUserVersion after a delete = %+v, %v", mv, err)
+	}
+	mv, err = s.GetChirpsByUserVersion(ctx, database.GetChirpsByUserVersionParams{UserID: uuid.New()})
+	if err != nil || mv.Total != 0 {
+		t.Fatalf("version of no chirps = %+v, %v", mv, err)
+	}
+}
+
+// the listing version changes with anything that changes which chirps are
+// in it or their versions, even when the count doesn't
+func testChirpsVersion(t *testing.T, s Store) {
+	ctx := context.Background()
+	alice, bob := mustUser(t, s), mustUser(t, s)
+	first := mustChirp(t, s, alice.ID, "first")
+	second := mustChirp(t, s, bob.ID, "second")
+
+	version := func() database.GetChirpsVersionRow {
+		t.Helper()
+		v, err := s.GetChirpsVersion(ctx, alice.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	var prev database.GetChirpsVersionRow
+	check := func(what string, total int64) {
+		t.Helper()
+		v := version()
+		if v.Total != total {
+			t.Fatalf("%s: total %d, want %d", what, v.Total, total)
+		}
+		if v != version() {
+			t.Fatalf("%s: version isn't stable", what)
+		}
+		if v == prev {
+			t.Fatalf("%s didn't change the version", what)
+		}
+		prev = v
+	}
+	check("start", 2)
+
+	// a delete and an insert leave the count alone
+	if err := s.DeleteChirpByID(ctx, first.ID); err != nil {
+		t.Fatal(err)
+	}
+	mustChirp(t, s, alice.ID, "replacement")
+	check("delete and insert", 2)
+
+	if err := s.HideChirp(ctx, second.ID); err != nil {
+		t.Fatal(err)
+	}
+	check("hide", 1)
+
+	third := mustChirp(t, s, bob.ID, "third")
+	check("insert", 2)
+	if err := s.BlockUser(ctx, database.BlockUserParams{BlockerID: alice.ID, BlockedID: bob.ID}); err != nil {
+		t.Fatal(err)
+	}
+	check("block", 1)
+	if err := s.DeleteChirpByID(ctx, third.ID); err != nil {
+		t.Fatal(err)
+	}
+	if version() != prev {
+		t.Fatalf("deleting a chirp the viewer can't see changed the version")
+	}
+}
+
+// a listing longer than a page comes back whole and in order, and fn can
+// use the store while it runs, on sqlite's one connection too
+func testChirpPages(t *testing.T, s Store) {
+	ctx := context.Background()
+	u := mustUser(t, s)
+	n := chirpPageSize + 1
+	for i := 0; i < n; i++ {
+		mustChirp(t, s, u.ID, strconv.Itoa(i))
+	}
+	for _, desc := range []bool{false, true} {
+		var got []database.Chirp
+		err := s.EachChirp(ctx, database.EachChirpParams{UserID: u.ID, Desc: desc}, func(c database.Chirp) error {
+			if _, err := s.GetChirp(ctx, c.ID); err != nil {
+				return err
+			}
+			got = append(got, c)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != n {
+			t.Fatalf("EachChirp desc=%v gave %d chirps, want %d", desc, len(got), n)
+		}
+		for i := 1; i < n; i++ {
+			a, b := got[i-1], got[i]
+			if desc {
+				a, b = b, a
+			}
+			if a.CreatedAt.After(b.CreatedAt) || a.ID == b.ID {
+				t.Fatalf("EachChirp desc=%v out of order at %d", desc, i)
+			}
+		}
+	}
+}
+
+func testRefreshTokens(t *testing.T, s Store) {
+	ctx := context.Background()
+	u := mustUser(t, s)
+	expires := time.Now().Add(time.Hour).Truncate(time.Microsecond)
+	_, err := s.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+		Token:     "tok",
+		UserID:    u.ID,
+		ExpiresAt: expires,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{Token: "tok", UserID: u.ID, ExpiresAt: expires})
+	if !IsUniqueViolation(err) {
+		t.Fatalf("duplicate token: got %v, want unique violation", err)
+	}
+
+	if err := s.RevokeToken(ctx, "tok"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.GetRefreshTokenFromToken(ctx, "tok")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.UserID != u.ID || !got.ExpiresAt.Equal(expires) || !got.RevokedAt.Valid {
+		t.Fatalf("token = %+v", got)
+	}
+
+	for _, token := range []string{"a", "b"} {
+		_, err := s.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{Token: token, UserID: u.ID, ExpiresAt: expires})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.RevokeAllUserTokens(ctx, u.ID); err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range []string{"a", "b"} {
+		got, err := s.GetRefreshTokenFromToken(ctx, token)
+		if err != nil || !got.RevokedAt.Valid {
+			t.Fatalf("token %s = %+v, %v", token, got, err)
+		}
+	}
+}
+
+func testConversations(t *testing.T, s Store) {
+	ctx := context.Background()
+	alice, bob, carol := mustUser(t, s), mustUser(t, s), mustUser(t, s)
+
+	direct, err := s.CreateConversation(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	group, err := s.CreateConversation(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	add := func(c database.Conversation, users ...database.User) {
+		for _, u := range users {
+			err := s.AddConversationMember(ctx, database.AddConversationMemberParams{ConversationID: c.ID, UserID: u.ID})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	add(direct, alice, bob)
+	add(group, alice, bob, carol)
+	err = s.AddConversationMember(ctx, database.AddConversationMemberParams{ConversationID: direct.ID, UserID: bob.ID})
+	if !IsUniqueViolation(err) {
+		t.Fatalf("duplicate member: got %v, want unique violation", err)
+	}
+
+	got, err := s.GetDirectConversation(ctx, database.GetDirectConversationParams{UserID: alice.ID, UserID_2: bob.ID})
+	if err != nil || got.ID != direct.ID {
+		t.Fatalf("GetDirectConversation = %v, %v, want %v", got.ID, err, direct.ID)
+	}
+	_, err = s.GetDirectConversation(ctx, database.GetDirectConversationParams{UserID: alice.ID, UserID_2: carol.ID})
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("no direct conversation: got %v, want sql.ErrNoRows", err)
+	}
+
+	// touching the direct one moves it to the front
+	if err := s.TouchConversation(ctx, direct.ID); err != nil {
+		t.Fatal(err)
+	}
+	convos, err := s.GetConversationsForUser(ctx, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(convos) != 2 || convos[0].ID != direct.ID {
+		t.Fatalf("GetConversationsForUser = %+v", convos)
+	}
+
+	var sent []database.Message
+	for _, body := range []string{"one", "two", "three"} {
+		m, err := s.CreateMessage(ctx, database.CreateMessageParams{ConversationID: group.ID, SenderID: alice.ID, Body: body})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sent = append(sent, m)
+	}
+	page, err := s.GetMessages(ctx, database.GetMessagesParams{
+		ConversationID: group.ID,
+		CreatedAt:      time.Now().Add(time.Minute),
+		Limit:          2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 2 || page[0].Body != "three" || page[1].Body != "two" {
+		t.Fatalf("first page = %+v", page)
+	}
+	page, err = s.GetMessages(ctx, database.GetMessagesParams{
+		ConversationID: group.ID,
+		CreatedAt:      page[1].CreatedAt,
+		ID:             page[1].ID,
+		Limit:          2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 1 || page[0].ID != sent[0].ID {
+		t.Fatalf("second page = %+v", page)
+	}
+
+	err = s.MarkConversationRead(ctx, database.MarkConversationReadParams{ConversationID: group.ID, UserID: bob.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	members, err := s.GetConversationMembers(ctx, group.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 3 {
+		t.Fatalf("got %d members, want 3", len(members))
+	}
+	for _, m := range members {
+		if m.LastReadAt.Valid != (m.UserID == bob.ID) {
+			t.Fatalf("last read wrong for %v: %+v", m.UserID, m.LastReadAt)
+		}
+	}
+}
+
+func testBlocks(t *testing.T, s Store) {
+	ctx := context.Background()
+	alice, bob, carol := mustUser(t, s), mustUser(t, s), mustUser(t, s)
+	mustChirp(t, s, alice.ID, "from alice")
+	mustChirp(t, s, bob.ID, "from bob")
+	mustChirp(t, s, carol.ID, "from carol")
+
+	block := database.BlockUserParams{BlockerID: alice.ID, BlockedID: bob.ID}
+	// twice to check it is a no-op
+	for range 2 {
+		if err := s.BlockUser(ctx, block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.MuteUser(ctx, database.MuteUserParams{MuterID: alice.ID, MutedID: carol.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	blocked, err := s.IsBlockedEitherWay(ctx, database.IsBlockedEitherWayParams{BlockerID: bob.ID, BlockedID: alice.ID})
+	if err != nil || !blocked {
+		t.Fatalf("IsBlockedEitherWay = %v, %v", blocked, err)
+	}
+
+	feed, err := s.GetChirps(ctx, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(chirpBodies(feed), ","); got != "from alice" {
+		t.Fatalf("alice sees %s", got)
+	}
+	feed, err = s.GetChirps(ctx, bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(chirpBodies(feed), ","); got != "from bob,from carol" {
+		t.Fatalf("bob sees %s", got)
+	}
+
+	hiding, err := s.GetUsersHidingAuthor(ctx, alice.ID)
+	if err != nil || len(hiding) != 1 || hiding[0] != bob.ID {
+		t.Fatalf("hiding alice = %v, %v", hiding, err)
+	}
+	hiding, err = s.GetUsersHidingAuthor(ctx, carol.ID)
+	if err != nil || len(hiding) != 1 || hiding[0] != alice.ID {
+		t.Fatalf("hiding carol = %v, %v", hiding, err)
+	}
+
+	if err := s.UnblockUser(ctx, database.UnblockUserParams(block)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UnmuteUser(ctx, database.UnmuteUserParams{MuterID: alice.ID, MutedID: carol.ID}); err != nil {
+		t.Fatal(err)
+	}
+	feed, err = s.GetChirps(ctx, alice.ID)
+	if err != nil || len(feed) != 3 {
+		t.Fatalf("after unblock alice sees %v, %v", chirpBodies(feed), err)
+	}
+}
+
+func testReports(t *testing.T, s Store) {
+	ctx := context.Background()
+	author, reporter, mod := mustUser(t, s), mustUser(t, s), mustUser(t, s)
+	chirp := mustChirp(t, s, author.ID, "bad")
+
+	report, err := s.CreateReport(ctx, database.CreateReportParams{
+		ChirpID:    chirp.ID,
+		ReporterID: reporter.ID,
+		Reason:     "spam",
+		Details:    "buy now",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Status != "open" {
+		t.Fatalf("status = %q, want open", report.Status)
+	}
+	_, err = s.CreateReport(ctx, database.CreateReportParams{ChirpID: chirp.ID, ReporterID: reporter.ID, Reason: "spam"})
+	if !IsUniqueViolation(err) {
+		t.Fatalf("duplicate report: got %v, want unique violation", err)
+	}
+
+	claimed, err := s.ClaimReport(ctx, database.ClaimReportParams{ID: report.ID, ClaimedBy: uuid.NullUUID{UUID: mod.ID, Valid: true}})
+	if err != nil || claimed.Status != "claimed" || claimed.ClaimedBy.UUID != mod.ID {
+		t.Fatalf("ClaimReport = %+v, %v", claimed, err)
+	}
+	// someone else cant take it over
+	_, err = s.ClaimReport(ctx, database.ClaimReportParams{ID: report.ID, ClaimedBy: uuid.NullUUID{UUID: reporter.ID, Valid: true}})
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("second claim: got %v, want sql.ErrNoRows", err)
+	}
+
+	open, err := s.GetReportsByStatus(ctx, "claimed")
+	if err != nil || len(open) != 1 {
+		t.Fatalf("claimed reports = %v, %v", open, err)
+	}
+	// or resolve it
+	_, err = s.ResolveReport(ctx, database.ResolveReportParams{
+		ID:         report.ID,
+		Resolution: sql.NullString{String: "dismiss", Valid: true},
+		ClaimedBy:  uuid.NullUUID{UUID: reporter.ID, Valid: true},
+	})
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("resolving someone else's claim: got %v, want sql.ErrNoRows", err)
+	}
+	resolved, err := s.ResolveReport(ctx, database.ResolveReportParams{
+		ID:         report.ID,
+		Resolution: sql.NullString{String: "dismiss", Valid: true},
+		ClaimedBy:  uuid.NullUUID{UUID: mod.ID, Valid: true},
+	})
+	if err != nil || resolved.Status != "resolved" || !resolved.ResolvedAt.Valid {
+		t.Fatalf("ResolveReport = %+v, %v", resolved, err)
+	}
+
+	for _, action := range []string{"claim", "dismiss"} {
+		_, err := s.CreateModerationAction(ctx, database.CreateModerationActionParams{
+			ModeratorID: mod.ID,
+			Action:      action,
+			ReportID:    uuid.NullUUID{UUID: report.ID, Valid: true},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	actions, err := s.GetModerationActions(ctx, 1)
+	if err != nil || len(actions) != 1 || actions[0].Action != "dismiss" {
+		t.Fatalf("GetModerationActions = %+v, %v", actions, err)
+	}
+}
+
+func testIdempotencyKeys(t *testing.T, s Store) {
+	ctx := context.Background()
+	u := mustUser(t, s)
+	key := database.GetIdempotencyKeyParams{UserID: u.ID, Key: "k"}
+	if _, err := s.GetIdempotencyKey(ctx, key); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("missing key: got %v, want sql.ErrNoRows", err)
+	}
+	expires := time.Now().Add(time.Hour).Truncate(time.Microsecond)
+	created, err := s.CreateIdempotencyKey(ctx, database.CreateIdempotencyKeyParams{
+		UserID:      u.ID,
+		Key:         "k",
+		RequestHash: "hash",
+		ExpiresAt:   expires,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Status.Valid || !created.ExpiresAt.Equal(expires) {
+		t.Fatalf("created = %+v", created)
+	}
+	_, err = s.CreateIdempotencyKey(ctx, database.CreateIdempotencyKeyParams{UserID: u.ID, Key: "k", RequestHash: "other", ExpiresAt: expires})
+	if !IsUniqueViolation(err) {
+		t.Fatalf("duplicate key: got %v, want unique violation", err)
+	}
+
+	if err := s.SaveIdempotencyResponse(ctx, database.SaveIdempotencyResponseParams{
+		UserID:      u.ID,
+		Key:         "k",
+		Status:      sql.NullInt32{Int32: 201, Valid: true},
+		ContentType: "application/json",
+		Body:        []byte(`{"id":1}`),
+		Headers:     `{"Etag":["\"v1\""]}`,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.GetIdempotencyKey(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.RequestHash != "hash" || got.Status.Int32 != 201 || got.ContentType != "application/json" || string(got.Body) != `{"id":1}` || got.Headers != `{"Etag":["\"v1\""]}` {
+		t.Fatalf("saved = %+v", got)
+	}
+
+	// only expired keys get swept
+	_, err = s.CreateIdempotencyKey(ctx, database.CreateIdempotencyKeyParams{UserID: u.ID, Key: "old", RequestHash: "h", ExpiresAt: time.Now().Add(-time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteExpiredIdempotencyKeys(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetIdempotencyKey(ctx, database.GetIdempotencyKeyParams{UserID: u.ID, Key: "old"}); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expired key: got %v, want sql.ErrNoRows", err)
+	}
+	if err := s.DeleteIdempotencyKey(ctx, database.DeleteIdempotencyKeyParams(key)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetIdempotencyKey(ctx, key); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("deleted key: got %v, want sql.ErrNoRows", err)
+	}
+}
+
+func testDeleteAllUsers(t *testing.T, s Store) {
+	ctx := context.Background()
+	u := mustUser(t, s)
+	c := mustChirp(t, s, u.ID, "gone soon")
+	if err := s.DeleteAllUsers(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetUserByID(ctx, u.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("user: got %v, want sql.ErrNoRows", err)
+	}
+	if _, err := s.GetChirp(ctx, c.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("chirp should cascade: got %v", err)
+	}
+}
+
+func testTransactions(t *testing.T, s Store) {
+	ctx := context.Background()
+	var rolledBack, committed database.User
+	boom := errors.New("boom")
+	err := s.InTx(ctx, nil, func(tx Store) error {
+		rolledBack = mustUser(t, tx)
+		return boom
+	})
+	if err != boom {
+		t.Fatalf("InTx = %v, want fn's error", err)
+	}
+	if _, err := s.GetUserByID(ctx, rolledBack.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("rolled back user: got %v, want sql.ErrNoRows", err)
+	}
+
+	err = s.InTx(ctx, nil, func(tx Store) error {
+		// a nested one joins instead of waiting on the outer one
+		return tx.InTx(ctx, nil, func(tx Store) error {
+			committed = mustUser(t, tx)
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetUserByID(ctx, committed.ID); err != nil {
+		t.Fatalf("committed user: %v", err)
+	}
+}
+
+// messages sent in the same instant mustn't fall through a page boundary,
+// the timestamps are forced equal since the clock rarely obliges.
+func TestMessagesSameCreatedAt(t *testing.T) {
+	run := func(t *testing.T, s Store, setCreatedAt func(convoID uuid.UUID, at time.Time)) {
+		ctx := context.Background()
+		u := mustUser(t, s)
+		convo, err := s.CreateConversation(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.AddConversationMember(ctx, database.AddConversationMemberParams{ConversationID: convo.ID, UserID: u.ID}); err != nil {
+			t.Fatal(err)
+		}
+		for _, body := range []string{"a", "b", "c"} {
+			if _, err := s.CreateMessage(ctx, database.CreateMessageParams{ConversationID: convo.ID, SenderID: u.ID, Body: body}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		at := time.Now().UTC().Truncate(time.Microsecond)
+		setCreatedAt(convo.ID, at)
+
+		seen := map[uuid.UUID]bool{}
+		arg := database.GetMessagesParams{ConversationID: convo.ID, CreatedAt: at.Add(time.Second), Limit: 1}
+		for i := 0; i < 4; i++ {
+			page, err := s.GetMessages(ctx, arg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(page) == 0 {
+				break
+			}
+			if seen[page[0].ID] {
+				t.Fatalf("message %s came back twice", page[0].ID)
+			}
+			seen[page[0].ID] = true
+			arg.CreatedAt, arg.ID = page[0].CreatedAt, page[0].ID
+		}
+		if len(seen) != 3 {
+			t.Fatalf("paged through %d messages, want 3", len(seen))
+		}
+	}
+
+	t.Run("memory", func(t *testing.T) {
+		m := NewMemory()
+		run(t, m, func(convoID uuid.UUID, at time.Time) {
+			for i := range m.messages {
+				m.messages[i].CreatedAt = at
+			}
+		})
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		s, conn, err := Open("sqlite::memory:")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		if err := migrate.Up(context.Background(), conn, DriverSQLite); err != nil {
+			t.Fatal(err)
+		}
+		run(t, s, func(convoID uuid.UUID, at time.Time) {
+			if _, err := conn.Exec("UPDATE messages SET created_at = ? WHERE conversation_id = ?", at, convoID); err != nil {
+				t.Fatal(err)
+			}
+		})
+	})
+}
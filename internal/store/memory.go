@@ -0,0 +1,909 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/frankielb/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// ErrForeignKey is returned by Memory when a row points at something missing.
+var ErrForeignKey = errors.New("store: foreign key violated")
+
+type pair struct {
+	a, b uuid.UUID
+}
+
+// Memory is a thread safe Store that keeps everything in memory. It follows
+// the postgres queries closely, including sql.ErrNoRows for missing rows and
+// the ON DELETE CASCADEs, so handlers behave the same on either.
+type Memory struct {
+	// one transaction at a time, see InTx
+	txMu          sync.Mutex
+	mu            sync.RWMutex
+	users         map[uuid.UUID]database.User
+	chirps        []database.Chirp // insertion order, like created_at
+	refreshTokens map[string]database.RefreshToken
+	conversations map[uuid.UUID]database.Conversation
+	members       []database.ConversationMember
+	messages      []database.Message
+	blocks        map[pair]time.Time
+	mutes         map[pair]time.Time
+	reports       []database.Report
+	actions       []database.ModerationAction
+	idempotency   map[idempotencyKey]database.IdempotencyKey
+}
+
+type idempotencyKey struct {
+	userID uuid.UUID
+	key    string
+}
+
+var _ Store = (*Memory)(nil)
+
+func NewMemory() *Memory {
+	return &Memory{
+		users:         map[uuid.UUID]database.User{},
+		refreshTokens: map[string]database.RefreshToken{},
+		conversations: map[uuid.UUID]database.Conversation{},
+		blocks:        map[pair]time.Time{},
+		mutes:         map[pair]time.Time{},
+		idempotency:   map[idempotencyKey]database.IdempotencyKey{},
+	}
+}
+
+// memoryState is everything a rolled back transaction puts back.
+type memoryState struct {
+	users         map[uuid.UUID]database.User
+	chirps        []database.Chirp
+	refreshTokens map[string]database.RefreshToken
+	conversations map[uuid.UUID]database.Conversation
+	members       []database.ConversationMember
+	messages      []database.Message
+	blocks        map[pair]time.Time
+	mutes         map[pair]time.Time
+	reports       []database.Report
+	actions       []database.ModerationAction
+	idempotency   map[idempotencyKey]database.IdempotencyKey
+}
+
+// InTx runs one transaction at a time and puts everything back if fn
+// fails. It isn't isolated from calls outside a transaction, and a rollback
+// undoes theirs too, good enough for tests and trying things out.
+func (m *Memory) InTx(ctx context.Context, opts *sql.TxOptions, fn func(Store) error) error {
+	m.txMu.Lock()
+	defer m.txMu.Unlock()
+	m.mu.RLock()
+	saved := memoryState{
+		users:         maps.Clone(m.users),
+		chirps:        slices.Clone(m.chirps),
+		refreshTokens: maps.Clone(m.refreshTokens),
+		conversations: maps.Clone(m.conversations),
+		members:       slices.Clone(m.members),
+		messages:      slices.Clone(m.messages),
+		blocks:        maps.Clone(m.blocks),
+		mutes:         maps.Clone(m.mutes),
+		reports:       slices.Clone(m.reports),
+		actions:       slices.Clone(m.actions),
+		idempotency:   maps.Clone(m.idempotency),
+	}
+	m.mu.RUnlock()
+	err := fn(memoryTx{m})
+	if err != nil {
+		m.mu.Lock()
+		m.users, m.chirps, m.refreshTokens = saved.users, saved.chirps, saved.refreshTokens
+		m.conversations, m.members, m.messages = saved.conversations, saved.members, saved.messages
+		m.blocks, m.mutes = saved.blocks, saved.mutes
+		m.reports, m.actions, m.idempotency = saved.reports, saved.actions, saved.idempotency
+		m.mu.Unlock()
+	}
+	return err
+}
+
+// memoryTx is the Memory inside InTx, another InTx joins the one running
+// rather than waiting on it forever.
+type memoryTx struct {
+	*Memory
+}
+
+func (t memoryTx) InTx(ctx context.Context, opts *sql.TxOptions, fn func(Store) error) error {
+	return fn(t)
+}
+
+func now() time.Time {
+	return time.Now().UTC()
+}
+
+// users
+
+func (m *Memory) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, u := range m.users {
+		if u.Email == arg.Email {
+			return database.User{}, ErrConflict
+		}
+	}
+	t := now()
+	user := database.User{
+		ID:             uuid.New(),
+		CreatedAt:      t,
+		UpdatedAt:      t,
+		Email:          arg.Email,
+		HashedPassword: arg.HashedPassword,
+		Role:           "user",
+	}
+	m.users[user.ID] = user
+	return user, nil
+}
+
+func (m *Memory) DeleteAllUsers(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// everything pointing at users cascades
+	m.users = map[uuid.UUID]database.User{}
+	m.chirps = nil
+	m.refreshTokens = map[string]database.RefreshToken{}
+	m.members = nil
+	m.messages = nil
+	m.blocks = map[pair]time.Time{}
+	m.mutes = map[pair]time.Time{}
+	m.reports = nil
+	m.idempotency = map[idempotencyKey]database.IdempotencyKey{}
+	return nil
+}
+
+func (m *Memory) DowngradeRedByID(ctx context.Context, id uuid.UUID) error {
+	m.updateUser(id, func(u *database.User) { u.IsChirpyRed = false })
+	return nil
+}
+
+func (m *Memory) GetUserByEmail(ctx context.Context, email string) (database.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, u := range m.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return database.User{}, sql.ErrNoRows
+}
+
+func (m *Memory) GetUserByID(ctx context.Context, id uuid.UUID) (database.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	u, ok := m.users[id]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	return u, nil
+}
+
+func (m *Memory) ListUsers(ctx context.Context) ([]database.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var users []database.User
+	for _, u := range m.users {
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].CreatedAt.Before(users[j].CreatedAt)
+	})
+	return users, nil
+}
+
+// updateUser applies fn to the user if they exist, like an UPDATE ... WHERE id.
+func (m *Memory) updateUser(id uuid.UUID, fn func(u *database.User)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.updateUserLocked(id, fn)
+}
+
+// updateUserLocked is updateUser for callers already holding m.mu.
+func (m *Memory) updateUserLocked(id uuid.UUID, fn func(u *database.User)) {
+	u, ok := m.users[id]
+	if !ok {
+		return
+	}
+	fn(&u)
+	u.UpdatedAt = now()
+	m.users[id] = u
+}
+
+func (m *Memory) SetUserRole(ctx context.Context, arg database.SetUserRoleParams) error {
+	switch arg.Role {
+	case "user", "moderator", "admin":
+	default:
+		return errors.New("store: invalid role")
+	}
+	m.updateUser(arg.ID, func(u *database.User) { u.Role = arg.Role })
+	return nil
+}
+
+func (m *Memory) SuspendUser(ctx context.Context, arg database.SuspendUserParams) error {
+	m.updateUser(arg.ID, func(u *database.User) {
+		u.SuspendedAt = sql.NullTime{Time: now(), Valid: true}
+		u.SuspendedUntil = arg.SuspendedUntil
+	})
+	return nil
+}
+
+func (m *Memory) UnsuspendUser(ctx context.Context, id uuid.UUID) error {
+	m.updateUser(id, func(u *database.User) {
+		u.SuspendedAt = sql.NullTime{}
+		u.SuspendedUntil = sql.NullTime{}
+	})
+	return nil
+}
+
+func (m *Memory) UpdatePswdEml(ctx context.Context, arg database.UpdatePswdEmlParams) error {
+	// one lock for the check and the write, like the unique index would
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, u := range m.users {
+		if u.Email == arg.Email && u.ID != arg.ID {
+			return ErrConflict
+		}
+	}
+	m.updateUserLocked(arg.ID, func(u *database.User) {
+		u.HashedPassword = arg.HashedPassword
+		u.Email = arg.Email
+	})
+	return nil
+}
+
+func (m *Memory) UpgradeRedByID(ctx context.Context, id uuid.UUID) error {
+	m.updateUser(id, func(u *database.User) { u.IsChirpyRed = true })
+	return nil
+}
+
+// chirps
+
+func (m *Memory) CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[arg.UserID]; !ok {
+		return database.Chirp{}, ErrForeignKey
+	}
+	for _, c := range m.chirps {
+		if c.Body == arg.Body {
+			return database.Chirp{}, ErrConflict
+		}
+	}
+	t := now()
+	chirp := database.Chirp{
+		ID:        uuid.New(),
+		CreatedAt: t,
+		UpdatedAt: t,
+		Body:      arg.Body,
+		UserID:    arg.UserID,
+	}
+	m.chirps = append(m.chirps, chirp)
+	return chirp, nil
+}
+
+func (m *Memory) DeleteChirpByID(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.chirps = filter(m.chirps, func(c database.Chirp) bool { return c.ID != id })
+	m.reports = filter(m.reports, func(r database.Report) bool { return r.ChirpID != id })
+	return nil
+}
+
+func (m *Memory) DeleteChirpIfUnchanged(ctx context.Context, arg database.DeleteChirpIfUnchangedParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := len(m.chirps)
+	m.chirps = filter(m.chirps, func(c database.Chirp) bool {
+		return c.ID != arg.ID || c.UserID != arg.UserID || !c.UpdatedAt.Equal(arg.UpdatedAt)
+	})
+	if len(m.chirps) == n {
+		return 0, nil
+	}
+	m.reports = filter(m.reports, func(r database.Report) bool { return r.ChirpID != arg.ID })
+	return 1, nil
+}
+
+func (m *Memory) GetChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, c := range m.chirps {
+		if c.ID == id {
+			return c, nil
+		}
+	}
+	return database.Chirp{}, sql.ErrNoRows
+}
+
+// visible is the block, mute and hidden filter from GetChirps.
+func (m *Memory) visible(c database.Chirp, viewerID uuid.UUID) bool {
+	if c.HiddenAt.Valid {
+		return false
+	}
+	if _, ok := m.blocks[pair{viewerID, c.UserID}]; ok {
+		return false
+	}
+	if _, ok := m.blocks[pair{c.UserID, viewerID}]; ok {
+		return false
+	}
+	_, muted := m.mutes[pair{viewerID, c.UserID}]
+	return !muted
+}
+
+func (m *Memory) GetChirps(ctx context.Context, viewerID uuid.UUID) ([]database.Chirp, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return filter(m.chirps, func(c database.Chirp) bool { return m.visible(c, viewerID) }), nil
+}
+
+func (m *Memory) GetChirpsByUser(ctx context.Context, arg database.GetChirpsByUserParams) ([]database.Chirp, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return filter(m.chirps, func(c database.Chirp) bool {
+		return c.UserID == arg.UserID && m.visible(c, arg.ViewerID)
+	}), nil
+}
+
+func (m *Memory) GetChirpsByUserVersion(ctx context.Context, arg database.GetChirpsByUserVersionParams) (database.GetChirpsByUserVersionRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	v := chirpsVersion(filter(m.chirps, func(c database.Chirp) bool {
+		return c.UserID == arg.UserID && m.visible(c, arg.ViewerID)
+	}))
+	return database.GetChirpsByUserVersionRow(v), nil
+}
+
+func (m *Memory) GetChirpsVersion(ctx context.Context, viewerID uuid.UUID) (database.GetChirpsVersionRow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return chirpsVersion(filter(m.chirps, func(c database.Chirp) bool { return m.visible(c, viewerID) })), nil
+}
+
+// chirpsVersion is the count and a digest of the chirps' ids and versions,
+// like the queries.
+func chirpsVersion(chirps []database.Chirp) database.GetChirpsVersionRow {
+	slices.SortFunc(chirps, func(a, b database.Chirp) int { return bytes.Compare(a.ID[:], b.ID[:]) })
+	h := sha256.New()
+	for _, c := range chirps {
+		fmt.Fprintf(h, "%s %d,", c.ID, c.UpdatedAt.UnixNano())
+	}
+	return database.GetChirpsVersionRow{Total: int64(len(chirps)), Digest: hex.EncodeToString(h.Sum(nil))}
+}
+
+// EachChirp copies the chirps out first, fn may be slow and shouldn't hold
+// up writers.
+func (m *Memory) EachChirp(ctx context.Context, arg database.EachChirpParams, fn func(database.Chirp) error) error {
+	m.mu.RLock()
+	chirps := filter(m.chirps, func(c database.Chirp) bool {
+		return (arg.UserID == uuid.Nil || c.UserID == arg.UserID) && m.visible(c, arg.ViewerID)
+	})
+	m.mu.RUnlock()
+	if arg.Desc {
+		slices.Reverse(chirps)
+	}
+	for _, c := range chirps {
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Memory) HideChirp(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, c := range m.chirps {
+		if c.ID == id {
+			t := now()
+			m.chirps[i].HiddenAt = sql.NullTime{Time: t, Valid: true}
+			m.chirps[i].UpdatedAt = t
+		}
+	}
+	return nil
+}
+
+// refresh tokens
+
+func (m *Memory) CreateRefreshToken(ctx context.Context, arg database.CreateRefreshTokenParams) (database.RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[arg.UserID]; !ok {
+		return database.RefreshToken{}, ErrForeignKey
+	}
+	if _, ok := m.refreshTokens[arg.Token]; ok {
+		return database.RefreshToken{}, ErrConflict
+	}
+	t := now()
+	token := database.RefreshToken{
+		Token:     arg.Token,
+		CreatedAt: t,
+		UpdatedAt: t,
+		UserID:    arg.UserID,
+		ExpiresAt: arg.ExpiresAt,
+	}
+	m.refreshTokens[arg.Token] = token
+	return token, nil
+}
+
+func (m *Memory) GetRefreshTokenFromToken(ctx context.Context, token string) (database.RefreshToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	t, ok := m.refreshTokens[token]
+	if !ok {
+		return database.RefreshToken{}, sql.ErrNoRows
+	}
+	return t, nil
+}
+
+func (m *Memory) RevokeAllUserTokens(ctx context.Context, userID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for token, t := range m.refreshTokens {
+		if t.UserID != userID || t.RevokedAt.Valid {
+			continue
+		}
+		t.UpdatedAt = now()
+		t.RevokedAt = sql.NullTime{Time: t.UpdatedAt, Valid: true}
+		m.refreshTokens[token] = t
+	}
+	return nil
+}
+
+func (m *Memory) RevokeToken(ctx context.Context, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.refreshTokens[token]
+	if !ok {
+		return nil
+	}
+	t.UpdatedAt = now()
+	t.RevokedAt = sql.NullTime{Time: t.UpdatedAt, Valid: true}
+	m.refreshTokens[token] = t
+	return nil
+}
+
+// direct messages
+
+func (m *Memory) AddConversationMember(ctx context.Context, arg database.AddConversationMemberParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.conversations[arg.ConversationID]; !ok {
+		return ErrForeignKey
+	}
+	if _, ok := m.users[arg.UserID]; !ok {
+		return ErrForeignKey
+	}
+	for _, mem := range m.members {
+		if mem.ConversationID == arg.ConversationID && mem.UserID == arg.UserID {
+			return ErrConflict
+		}
+	}
+	m.members = append(m.members, database.ConversationMember{
+		ConversationID: arg.ConversationID,
+		UserID:         arg.UserID,
+		JoinedAt:       now(),
+	})
+	return nil
+}
+
+func (m *Memory) CreateConversation(ctx context.Context) (database.Conversation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := now()
+	convo := database.Conversation{
+		ID:        uuid.New(),
+		CreatedAt: t,
+		UpdatedAt: t,
+	}
+	m.conversations[convo.ID] = convo
+	return convo, nil
+}
+
+func (m *Memory) CreateMessage(ctx context.Context, arg database.CreateMessageParams) (database.Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.conversations[arg.ConversationID]; !ok {
+		return database.Message{}, ErrForeignKey
+	}
+	if _, ok := m.users[arg.SenderID]; !ok {
+		return database.Message{}, ErrForeignKey
+	}
+	msg := database.Message{
+		ID:             uuid.New(),
+		CreatedAt:      now(),
+		ConversationID: arg.ConversationID,
+		SenderID:       arg.SenderID,
+		Body:           arg.Body,
+	}
+	m.messages = append(m.messages, msg)
+	return msg, nil
+}
+
+func (m *Memory) GetConversation(ctx context.Context, id uuid.UUID) (database.Conversation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	convo, ok := m.conversations[id]
+	if !ok {
+		return database.Conversation{}, sql.ErrNoRows
+	}
+	return convo, nil
+}
+
+func (m *Memory) GetConversationMembers(ctx context.Context, conversationID uuid.UUID) ([]database.ConversationMember, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return filter(m.members, func(mem database.ConversationMember) bool {
+		return mem.ConversationID == conversationID
+	}), nil
+}
+
+func (m *Memory) GetConversationsForUser(ctx context.Context, userID uuid.UUID) ([]database.Conversation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var convos []database.Conversation
+	for _, mem := range m.members {
+		if mem.UserID == userID {
+			convos = append(convos, m.conversations[mem.ConversationID])
+		}
+	}
+	sort.SliceStable(convos, func(i, j int) bool {
+		return convos[i].UpdatedAt.After(convos[j].UpdatedAt)
+	})
+	return convos, nil
+}
+
+func (m *Memory) GetDirectConversation(ctx context.Context, arg database.GetDirectConversationParams) (database.Conversation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	counts := map[uuid.UUID]int{}
+	both := map[uuid.UUID]int{}
+	for _, mem := range m.members {
+		counts[mem.ConversationID]++
+		if mem.UserID == arg.UserID || mem.UserID == arg.UserID_2 {
+			both[mem.ConversationID]++
+		}
+	}
+	for id, n := range both {
+		if n == 2 && counts[id] == 2 {
+			return m.conversations[id], nil
+		}
+	}
+	return database.Conversation{}, sql.ErrNoRows
+}
+
+func (m *Memory) GetMessages(ctx context.Context, arg database.GetMessagesParams) ([]database.Message, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var msgs []database.Message
+	for _, msg := range m.messages {
+		if msg.ConversationID != arg.ConversationID {
+			continue
+		}
+		// before the (created_at, id) cursor
+		if msg.CreatedAt.Before(arg.CreatedAt) ||
+			(msg.CreatedAt.Equal(arg.CreatedAt) && bytes.Compare(msg.ID[:], arg.ID[:]) < 0) {
+			msgs = append(msgs, msg)
+		}
+	}
+	// newest first, ties by id like the sql
+	sort.SliceStable(msgs, func(i, j int) bool {
+		if !msgs[i].CreatedAt.Equal(msgs[j].CreatedAt) {
+			return msgs[i].CreatedAt.After(msgs[j].CreatedAt)
+		}
+		return bytes.Compare(msgs[i].ID[:], msgs[j].ID[:]) > 0
+	})
+	if len(msgs) > int(arg.Limit) {
+		msgs = msgs[:arg.Limit]
+	}
+	return msgs, nil
+}
+
+func (m *Memory) MarkConversationRead(ctx context.Context, arg database.MarkConversationReadParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, mem := range m.members {
+		if mem.ConversationID == arg.ConversationID && mem.UserID == arg.UserID {
+			m.members[i].LastReadAt = sql.NullTime{Time: now(), Valid: true}
+		}
+	}
+	return nil
+}
+
+func (m *Memory) TouchConversation(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if convo, ok := m.conversations[id]; ok {
+		convo.UpdatedAt = now()
+		m.conversations[id] = convo
+	}
+	return nil
+}
+
+// blocks and mutes
+
+func (m *Memory) BlockUser(ctx context.Context, arg database.BlockUserParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := pair{arg.BlockerID, arg.BlockedID}
+	if _, ok := m.blocks[key]; !ok {
+		m.blocks[key] = now()
+	}
+	return nil
+}
+
+func (m *Memory) GetUsersHidingAuthor(ctx context.Context, blockerID uuid.UUID) ([]uuid.UUID, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	seen := map[uuid.UUID]bool{}
+	var ids []uuid.UUID
+	add := func(id uuid.UUID) {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	for key := range m.blocks {
+		if key.a == blockerID {
+			add(key.b)
+		}
+		if key.b == blockerID {
+			add(key.a)
+		}
+	}
+	for key := range m.mutes {
+		if key.b == blockerID {
+			add(key.a)
+		}
+	}
+	return ids, nil
+}
+
+func (m *Memory) IsBlockedEitherWay(ctx context.Context, arg database.IsBlockedEitherWayParams) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, a := m.blocks[pair{arg.BlockerID, arg.BlockedID}]
+	_, b := m.blocks[pair{arg.BlockedID, arg.BlockerID}]
+	return a || b, nil
+}
+
+func (m *Memory) MuteUser(ctx context.Context, arg database.MuteUserParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := pair{arg.MuterID, arg.MutedID}
+	if _, ok := m.mutes[key]; !ok {
+		m.mutes[key] = now()
+	}
+	return nil
+}
+
+func (m *Memory) UnblockUser(ctx context.Context, arg database.UnblockUserParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.blocks, pair{arg.BlockerID, arg.BlockedID})
+	return nil
+}
+
+func (m *Memory) UnmuteUser(ctx context.Context, arg database.UnmuteUserParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.mutes, pair{arg.MuterID, arg.MutedID})
+	return nil
+}
+
+// moderation
+
+func (m *Memory) ClaimReport(ctx context.Context, arg database.ClaimReportParams) (database.Report, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, r := range m.reports {
+		if r.ID != arg.ID {
+			continue
+		}
+		claimable := r.Status == "open" ||
+			(r.Status == "claimed" && r.ClaimedBy.Valid && arg.ClaimedBy.Valid && r.ClaimedBy.UUID == arg.ClaimedBy.UUID)
+		if !claimable {
+			break
+		}
+		t := now()
+		r.Status = "claimed"
+		r.ClaimedBy = arg.ClaimedBy
+		r.ClaimedAt = sql.NullTime{Time: t, Valid: true}
+		r.UpdatedAt = t
+		m.reports[i] = r
+		return r, nil
+	}
+	return database.Report{}, sql.ErrNoRows
+}
+
+func (m *Memory) CreateModerationAction(ctx context.Context, arg database.CreateModerationActionParams) (database.ModerationAction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	action := database.ModerationAction{
+		ID:           uuid.New(),
+		CreatedAt:    now(),
+		ModeratorID:  arg.ModeratorID,
+		Action:       arg.Action,
+		ReportID:     arg.ReportID,
+		ChirpID:      arg.ChirpID,
+		TargetUserID: arg.TargetUserID,
+		Note:         arg.Note,
+	}
+	m.actions = append(m.actions, action)
+	return action, nil
+}
+
+func (m *Memory) CreateReport(ctx context.Context, arg database.CreateReportParams) (database.Report, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[arg.ReporterID]; !ok {
+		return database.Report{}, ErrForeignKey
+	}
+	found := false
+	for _, c := range m.chirps {
+		if c.ID == arg.ChirpID {
+			found = true
+		}
+	}
+	if !found {
+		return database.Report{}, ErrForeignKey
+	}
+	for _, r := range m.reports {
+		if r.ChirpID == arg.ChirpID && r.ReporterID == arg.ReporterID {
+			return database.Report{}, ErrConflict
+		}
+	}
+	t := now()
+	report := database.Report{
+		ID:         uuid.New(),
+		CreatedAt:  t,
+		UpdatedAt:  t,
+		ChirpID:    arg.ChirpID,
+		ReporterID: arg.ReporterID,
+		Reason:     arg.Reason,
+		Details:    arg.Details,
+		Status:     "open",
+	}
+	m.reports = append(m.reports, report)
+	return report, nil
+}
+
+func (m *Memory) GetModerationActions(ctx context.Context, limit int32) ([]database.ModerationAction, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var actions []database.ModerationAction
+	for i := len(m.actions) - 1; i >= 0 && len(actions) < int(limit); i-- {
+		actions = append(actions, m.actions[i])
+	}
+	return actions, nil
+}
+
+func (m *Memory) GetReport(ctx context.Context, id uuid.UUID) (database.Report, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, r := range m.reports {
+		if r.ID == id {
+			return r, nil
+		}
+	}
+	return database.Report{}, sql.ErrNoRows
+}
+
+func (m *Memory) GetReportsByStatus(ctx context.Context, status string) ([]database.Report, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return filter(m.reports, func(r database.Report) bool { return r.Status == status }), nil
+}
+
+func (m *Memory) ResolveReport(ctx context.Context, arg database.ResolveReportParams) (database.Report, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, r := range m.reports {
+		if r.ID != arg.ID || r.Status == "resolved" {
+			continue
+		}
+		// someone else's claim
+		if r.ClaimedBy.Valid && r.ClaimedBy != arg.ClaimedBy {
+			continue
+		}
+		t := now()
+		r.Status = "resolved"
+		r.Resolution = arg.Resolution
+		r.ResolvedAt = sql.NullTime{Time: t, Valid: true}
+		r.UpdatedAt = t
+		m.reports[i] = r
+		return r, nil
+	}
+	return database.Report{}, sql.ErrNoRows
+}
+
+// idempotency keys
+
+func (m *Memory) CreateIdempotencyKey(ctx context.Context, arg database.CreateIdempotencyKeyParams) (database.IdempotencyKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.users[arg.UserID]; !ok {
+		return database.IdempotencyKey{}, ErrForeignKey
+	}
+	k := idempotencyKey{arg.UserID, arg.Key}
+	if _, ok := m.idempotency[k]; ok {
+		return database.IdempotencyKey{}, ErrConflict
+	}
+	row := database.IdempotencyKey{
+		UserID:      arg.UserID,
+		Key:         arg.Key,
+		RequestHash: arg.RequestHash,
+		CreatedAt:   now(),
+		ExpiresAt:   arg.ExpiresAt,
+	}
+	m.idempotency[k] = row
+	return row, nil
+}
+
+func (m *Memory) DeleteExpiredIdempotencyKeys(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := now()
+	for k, row := range m.idempotency {
+		if row.ExpiresAt.Before(t) {
+			delete(m.idempotency, k)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) DeleteIdempotencyKey(ctx context.Context, arg database.DeleteIdempotencyKeyParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.idempotency, idempotencyKey{arg.UserID, arg.Key})
+	return nil
+}
+
+func (m *Memory) GetIdempotencyKey(ctx context.Context, arg database.GetIdempotencyKeyParams) (database.IdempotencyKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	row, ok := m.idempotency[idempotencyKey{arg.UserID, arg.Key}]
+	if !ok {
+		return database.IdempotencyKey{}, sql.ErrNoRows
+	}
+	// a copy, so callers can't change the stored body
+	row.Body = bytes.Clone(row.Body)
+	return row, nil
+}
+
+func (m *Memory) SaveIdempotencyResponse(ctx context.Context, arg database.SaveIdempotencyResponseParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := idempotencyKey{arg.UserID, arg.Key}
+	row, ok := m.idempotency[k]
+	if !ok {
+		return nil
+	}
+	row.Status = arg.Status
+	row.ContentType = arg.ContentType
+	row.Body = bytes.Clone(arg.Body)
+	row.Headers = arg.Headers
+	m.idempotency[k] = row
+	return nil
+}
+
+// filter returns a new slice of the items keep is true for.
+func filter[T any](items []T, keep func(T) bool) []T {
+	var out []T
+	for _, item := range items {
+		if keep(item) {
+			out = append(out, item)
+		}
+	}
+	return out
+}
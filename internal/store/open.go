@@ -0,0 +1,76 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/frankielb/chirpy/internal/tracing"
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+// backends picked by Open from the DB_URL
+const (
+	DriverMemory   = "memory"
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// Driver says which backend a DB_URL is for, by its scheme:
+// postgres:// or postgresql:// for postgres, sqlite: or file: for sqlite,
+// and empty or "memory" for the in-memory store.
+func Driver(dbURL string) (string, error) {
+	switch {
+	case dbURL == "" || dbURL == "memory":
+		return DriverMemory, nil
+	case strings.HasPrefix(dbURL, "postgres://"), strings.HasPrefix(dbURL, "postgresql://"):
+		return DriverPostgres, nil
+	case strings.HasPrefix(dbURL, "sqlite:"), strings.HasPrefix(dbURL, "file:"):
+		return DriverSQLite, nil
+	}
+	return "", fmt.Errorf("store: unknown DB_URL scheme in %q", dbURL)
+}
+
+// Open connects to whatever dbURL points at. The *sql.DB is nil for the
+// in-memory store, otherwise the caller should close it.
+func Open(dbURL string) (Store, *sql.DB, error) {
+	driver, err := Driver(dbURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch driver {
+	case DriverPostgres:
+		conn, err := sql.Open("postgres", dbURL)
+		if err != nil {
+			return nil, nil, err
+		}
+		return NewPostgres(conn), conn, nil
+	case DriverSQLite:
+		conn, err := sql.Open("sqlite", sqliteDSN(dbURL))
+		if err != nil {
+			return nil, nil, err
+		}
+		// one writer at a time, also keeps :memory: to a single database
+		conn.SetMaxOpenConns(1)
+		s := NewSQLite(tracing.WrapDB(conn, "sqlite"))
+		s.conn = conn
+		return s, conn, nil
+	}
+	return NewMemory(), nil, nil
+}
+
+// sqliteDSN turns sqlite:path or sqlite://path into a modernc file: dsn with
+// foreign keys on and times stored in a format sqlite can sort.
+func sqliteDSN(dbURL string) string {
+	dsn := dbURL
+	if !strings.HasPrefix(dsn, "file:") {
+		dsn = strings.TrimPrefix(dsn, "sqlite:")
+		dsn = "file:" + strings.TrimPrefix(dsn, "//")
+	}
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	return dsn + sep + "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_time_format=sqlite"
+}
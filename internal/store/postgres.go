@@ -0,0 +1,82 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/frankielb/chirpy/internal/database"
+	"github.com/frankielb/chirpy/internal/tracing"
+	"github.com/google/uuid"
+)
+
+// Postgres is the sqlc generated queries plus the connection they need to
+// start transactions.
+type Postgres struct {
+	*database.Queries
+	// nil inside a transaction
+	conn *sql.DB
+}
+
+var _ Store = (*Postgres)(nil)
+
+// NewPostgres wraps conn with tracing and the sqlc queries.
+func NewPostgres(conn *sql.DB) *Postgres {
+	return &Postgres{Queries: database.New(tracing.WrapDB(conn, "postgresql")), conn: conn}
+}
+
+func (p *Postgres) InTx(ctx context.Context, opts *sql.TxOptions, fn func(Store) error) error {
+	// already in one, postgres doesn't nest them
+	if p.conn == nil {
+		return fn(p)
+	}
+	tx, err := p.conn.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+	if err := fn(&Postgres{Queries: database.New(tracing.WrapDB(tx, "postgresql"))}); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (p *Postgres) EachChirp(ctx context.Context, arg database.EachChirpParams, fn func(database.Chirp) error) error {
+	return eachChirp(arg.Desc, func(createdAt time.Time, id uuid.UUID) ([]database.Chirp, error) {
+		return p.ChirpsPage(ctx, arg, createdAt, id, chirpPageSize)
+	}, fn)
+}
+
+// chirpPageSize is how many chirps eachChirp reads at a time.
+const chirpPageSize = 100
+
+// eachChirp reads a chirp listing a page at a time for both sql stores,
+// page being the one after the chirp at createdAt and id. Each page is read
+// and its rows closed before fn sees it, a slow client writing the listing
+// out shouldn't hold a connection, and on sqlite there's only the one. An
+// error from fn stops it and is returned.
+func eachChirp(desc bool, page func(createdAt time.Time, id uuid.UUID) ([]database.Chirp, error), fn func(database.Chirp) error) error {
+	// start from before the first chirp either way
+	var createdAt time.Time
+	id := uuid.Nil
+	if desc {
+		createdAt = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+		id = uuid.Max
+	}
+	for {
+		chirps, err := page(createdAt, id)
+		if err != nil {
+			return err
+		}
+		for _, c := range chirps {
+			if err := fn(c); err != nil {
+				return err
+			}
+		}
+		if len(chirps) < chirpPageSize {
+			return nil
+		}
+		last := chirps[len(chirps)-1]
+		createdAt, id = last.CreatedAt, last.ID
+	}
+}
@@ -0,0 +1,455 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/frankielb/chirpy/internal/database"
+	"github.com/frankielb/chirpy/internal/sqlitedb"
+	"github.com/frankielb/chirpy/internal/tracing"
+	"github.com/google/uuid"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// SQLite is the Store on top of the sqlc generated sqlite queries. SQLite
+// has no gen_random_uuid() or NOW() so ids and timestamps are made here, and
+// the rows are converted to the database package types the handlers use.
+type SQLite struct {
+	q *sqlitedb.Queries
+	// for starting transactions, nil inside one or without Open
+	conn *sql.DB
+}
+
+var _ Store = (*SQLite)(nil)
+
+func NewSQLite(db sqlitedb.DBTX) *SQLite {
+	return &SQLite{q: sqlitedb.New(db)}
+}
+
+func (s *SQLite) InTx(ctx context.Context, opts *sql.TxOptions, fn func(Store) error) error {
+	if s.conn == nil {
+		return fn(s)
+	}
+	tx, err := s.conn.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+	if err := fn(NewSQLite(tracing.WrapDB(tx, "sqlite"))); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// sqliteErr turns constraint errors into ErrConflict like postgres' 23505.
+func sqliteErr(err error) error {
+	var sqliteError *sqlite.Error
+	if errors.As(err, &sqliteError) {
+		switch sqliteError.Code() {
+		case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+			return fmt.Errorf("%w: %v", ErrConflict, err)
+		}
+	}
+	return err
+}
+
+// convertAll converts each row, keeping nil for no rows like sqlc does.
+func convertAll[From, To any](items []From, convert func(From) To) []To {
+	var out []To
+	for _, item := range items {
+		out = append(out, convert(item))
+	}
+	return out
+}
+
+func toUser(u sqlitedb.User) database.User                         { return database.User(u) }
+func toChirp(c sqlitedb.Chirp) database.Chirp                      { return database.Chirp(c) }
+func toConversation(c sqlitedb.Conversation) database.Conversation { return database.Conversation(c) }
+func toMember(m sqlitedb.ConversationMember) database.ConversationMember {
+	return database.ConversationMember(m)
+}
+func toMessage(m sqlitedb.Message) database.Message { return database.Message(m) }
+func toAction(a sqlitedb.ModerationAction) database.ModerationAction {
+	return database.ModerationAction(a)
+}
+func toReport(r sqlitedb.Report) database.Report { return database.Report(r) }
+
+// toIdempotencyKey is a copy rather than a conversion, sqlite integers
+// come back as int64.
+func toIdempotencyKey(k sqlitedb.IdempotencyKey) database.IdempotencyKey {
+	return database.IdempotencyKey{
+		UserID:      k.UserID,
+		Key:         k.Key,
+		RequestHash: k.RequestHash,
+		CreatedAt:   k.CreatedAt,
+		ExpiresAt:   k.ExpiresAt,
+		Status:      sql.NullInt32{Int32: int32(k.Status.Int64), Valid: k.Status.Valid},
+		ContentType: k.ContentType,
+		Body:        k.Body,
+		Headers:     k.Headers,
+	}
+}
+
+// utc keeps every stored time in one zone so text comparisons order right.
+func utc(t sql.NullTime) sql.NullTime {
+	t.Time = t.Time.UTC()
+	return t
+}
+
+// users
+
+func (s *SQLite) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.User, error) {
+	u, err := s.q.CreateUser(ctx, sqlitedb.CreateUserParams{
+		ID:             uuid.New(),
+		Now:            now(),
+		Email:          arg.Email,
+		HashedPassword: arg.HashedPassword,
+	})
+	return database.User(u), sqliteErr(err)
+}
+
+func (s *SQLite) DeleteAllUsers(ctx context.Context) error {
+	return s.q.DeleteAllUsers(ctx)
+}
+
+func (s *SQLite) DowngradeRedByID(ctx context.Context, id uuid.UUID) error {
+	return s.q.DowngradeRedByID(ctx, sqlitedb.DowngradeRedByIDParams{Now: now(), ID: id})
+}
+
+func (s *SQLite) GetUserByEmail(ctx context.Context, email string) (database.User, error) {
+	u, err := s.q.GetUserByEmail(ctx, email)
+	return database.User(u), err
+}
+
+func (s *SQLite) GetUserByID(ctx context.Context, id uuid.UUID) (database.User, error) {
+	u, err := s.q.GetUserByID(ctx, id)
+	return database.User(u), err
+}
+
+func (s *SQLite) ListUsers(ctx context.Context) ([]database.User, error) {
+	users, err := s.q.ListUsers(ctx)
+	return convertAll(users, toUser), err
+}
+
+func (s *SQLite) SetUserRole(ctx context.Context, arg database.SetUserRoleParams) error {
+	return s.q.SetUserRole(ctx, sqlitedb.SetUserRoleParams{
+		Role: arg.Role,
+		Now:  now(),
+		ID:   arg.ID,
+	})
+}
+
+func (s *SQLite) SuspendUser(ctx context.Context, arg database.SuspendUserParams) error {
+	return s.q.SuspendUser(ctx, sqlitedb.SuspendUserParams{
+		Now:            now(),
+		SuspendedUntil: utc(arg.SuspendedUntil),
+		ID:             arg.ID,
+	})
+}
+
+func (s *SQLite) UnsuspendUser(ctx context.Context, id uuid.UUID) error {
+	return s.q.UnsuspendUser(ctx, sqlitedb.UnsuspendUserParams{Now: now(), ID: id})
+}
+
+func (s *SQLite) UpdatePswdEml(ctx context.Context, arg database.UpdatePswdEmlParams) error {
+	return sqliteErr(s.q.UpdatePswdEml(ctx, sqlitedb.UpdatePswdEmlParams{
+		HashedPassword: arg.HashedPassword,
+		Email:          arg.Email,
+		Now:            now(),
+		ID:             arg.ID,
+	}))
+}
+
+func (s *SQLite) UpgradeRedByID(ctx context.Context, id uuid.UUID) error {
+	return s.q.UpgradeRedByID(ctx, sqlitedb.UpgradeRedByIDParams{Now: now(), ID: id})
+}
+
+// chirps
+
+func (s *SQLite) CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error) {
+	c, err := s.q.CreateChirp(ctx, sqlitedb.CreateChirpParams{
+		ID:     uuid.New(),
+		Now:    now(),
+		Body:   arg.Body,
+		UserID: arg.UserID,
+	})
+	return database.Chirp(c), sqliteErr(err)
+}
+
+func (s *SQLite) DeleteChirpByID(ctx context.Context, id uuid.UUID) error {
+	return s.q.DeleteChirpByID(ctx, id)
+}
+
+func (s *SQLite) DeleteChirpIfUnchanged(ctx context.Context, arg database.DeleteChirpIfUnchangedParams) (int64, error) {
+	return s.q.DeleteChirpIfUnchanged(ctx, sqlitedb.DeleteChirpIfUnchangedParams{
+		ID:        arg.ID,
+		UserID:    arg.UserID,
+		UpdatedAt: arg.UpdatedAt.UTC(),
+	})
+}
+
+func (s *SQLite) EachChirp(ctx context.Context, arg database.EachChirpParams, fn func(database.Chirp) error) error {
+	return eachChirp(arg.Desc, func(createdAt time.Time, id uuid.UUID) ([]database.Chirp, error) {
+		chirps, err := s.q.ChirpsPage(ctx, sqlitedb.EachChirpParams(arg), createdAt.UTC(), id, chirpPageSize)
+		return convertAll(chirps, toChirp), err
+	}, fn)
+}
+
+func (s *SQLite) GetChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	c, err := s.q.GetChirp(ctx, id)
+	return database.Chirp(c), err
+}
+
+func (s *SQLite) GetChirps(ctx context.Context, viewerID uuid.UUID) ([]database.Chirp, error) {
+	chirps, err := s.q.GetChirps(ctx, viewerID)
+	return convertAll(chirps, toChirp), err
+}
+
+func (s *SQLite) GetChirpsByUser(ctx context.Context, arg database.GetChirpsByUserParams) ([]database.Chirp, error) {
+	chirps, err := s.q.GetChirpsByUser(ctx, sqlitedb.GetChirpsByUserParams(arg))
+	return convertAll(chirps, toChirp), err
+}
+
+func (s *SQLite) GetChirpsByUserVersion(ctx context.Context, arg database.GetChirpsByUserVersionParams) (database.GetChirpsByUserVersionRow, error) {
+	v, err := s.q.GetChirpsByUserVersion(ctx, sqlitedb.GetChirpsByUserVersionParams(arg))
+	return database.GetChirpsByUserVersionRow(v), err
+}
+
+func (s *SQLite) GetChirpsVersion(ctx context.Context, viewerID uuid.UUID) (database.GetChirpsVersionRow, error) {
+	v, err := s.q.GetChirpsVersion(ctx, viewerID)
+	return database.GetChirpsVersionRow(v), err
+}
+
+func (s *SQLite) HideChirp(ctx context.Context, id uuid.UUID) error {
+	return s.q.HideChirp(ctx, sqlitedb.HideChirpParams{Now: now(), ID: id})
+}
+
+// refresh tokens
+
+func (s *SQLite) CreateRefreshToken(ctx context.Context, arg database.CreateRefreshTokenParams) (database.RefreshToken, error) {
+	t, err := s.q.CreateRefreshToken(ctx, sqlitedb.CreateRefreshTokenParams{
+		Token:     arg.Token,
+		Now:       now(),
+		UserID:    arg.UserID,
+		ExpiresAt: arg.ExpiresAt.UTC(),
+	})
+	return database.RefreshToken(t), sqliteErr(err)
+}
+
+func (s *SQLite) GetRefreshTokenFromToken(ctx context.Context, token string) (database.RefreshToken, error) {
+	t, err := s.q.GetRefreshTokenFromToken(ctx, token)
+	return database.RefreshToken(t), err
+}
+
+func (s *SQLite) RevokeAllUserTokens(ctx context.Context, userID uuid.UUID) error {
+	return s.q.RevokeAllUserTokens(ctx, sqlitedb.RevokeAllUserTokensParams{Now: now(), UserID: userID})
+}
+
+func (s *SQLite) RevokeToken(ctx context.Context, token string) error {
+	return s.q.RevokeToken(ctx, sqlitedb.RevokeTokenParams{Now: now(), Token: token})
+}
+
+// direct messages
+
+func (s *SQLite) AddConversationMember(ctx context.Context, arg database.AddConversationMemberParams) error {
+	return sqliteErr(s.q.AddConversationMember(ctx, sqlitedb.AddConversationMemberParams{
+		ConversationID: arg.ConversationID,
+		UserID:         arg.UserID,
+		Now:            now(),
+	}))
+}
+
+func (s *SQLite) CreateConversation(ctx context.Context) (database.Conversation, error) {
+	c, err := s.q.CreateConversation(ctx, sqlitedb.CreateConversationParams{ID: uuid.New(), Now: now()})
+	return database.Conversation(c), err
+}
+
+func (s *SQLite) CreateMessage(ctx context.Context, arg database.CreateMessageParams) (database.Message, error) {
+	m, err := s.q.CreateMessage(ctx, sqlitedb.CreateMessageParams{
+		ID:             uuid.New(),
+		Now:            now(),
+		ConversationID: arg.ConversationID,
+		SenderID:       arg.SenderID,
+		Body:           arg.Body,
+	})
+	return database.Message(m), err
+}
+
+func (s *SQLite) GetConversation(ctx context.Context, id uuid.UUID) (database.Conversation, error) {
+	c, err := s.q.GetConversation(ctx, id)
+	return database.Conversation(c), err
+}
+
+func (s *SQLite) GetConversationMembers(ctx context.Context, conversationID uuid.UUID) ([]database.ConversationMember, error) {
+	members, err := s.q.GetConversationMembers(ctx, conversationID)
+	return convertAll(members, toMember), err
+}
+
+func (s *SQLite) GetConversationsForUser(ctx context.Context, userID uuid.UUID) ([]database.Conversation, error) {
+	convos, err := s.q.GetConversationsForUser(ctx, userID)
+	return convertAll(convos, toConversation), err
+}
+
+func (s *SQLite) GetDirectConversation(ctx context.Context, arg database.GetDirectConversationParams) (database.Conversation, error) {
+	c, err := s.q.GetDirectConversation(ctx, sqlitedb.GetDirectConversationParams(arg))
+	return database.Conversation(c), err
+}
+
+func (s *SQLite) GetMessages(ctx context.Context, arg database.GetMessagesParams) ([]database.Message, error) {
+	msgs, err := s.q.GetMessages(ctx, sqlitedb.GetMessagesParams{
+		ConversationID: arg.ConversationID,
+		CreatedAt:      arg.CreatedAt.UTC(),
+		ID:             arg.ID,
+		Limit:          int64(arg.Limit),
+	})
+	return convertAll(msgs, toMessage), err
+}
+
+func (s *SQLite) MarkConversationRead(ctx context.Context, arg database.MarkConversationReadParams) error {
+	return s.q.MarkConversationRead(ctx, sqlitedb.MarkConversationReadParams{
+		Now:            now(),
+		ConversationID: arg.ConversationID,
+		UserID:         arg.UserID,
+	})
+}
+
+func (s *SQLite) TouchConversation(ctx context.Context, id uuid.UUID) error {
+	return s.q.TouchConversation(ctx, sqlitedb.TouchConversationParams{Now: now(), ID: id})
+}
+
+// blocks and mutes
+
+func (s *SQLite) BlockUser(ctx context.Context, arg database.BlockUserParams) error {
+	return s.q.BlockUser(ctx, sqlitedb.BlockUserParams{
+		BlockerID: arg.BlockerID,
+		BlockedID: arg.BlockedID,
+		Now:       now(),
+	})
+}
+
+func (s *SQLite) GetUsersHidingAuthor(ctx context.Context, blockerID uuid.UUID) ([]uuid.UUID, error) {
+	return s.q.GetUsersHidingAuthor(ctx, blockerID)
+}
+
+func (s *SQLite) IsBlockedEitherWay(ctx context.Context, arg database.IsBlockedEitherWayParams) (bool, error) {
+	return s.q.IsBlockedEitherWay(ctx, sqlitedb.IsBlockedEitherWayParams(arg))
+}
+
+func (s *SQLite) MuteUser(ctx context.Context, arg database.MuteUserParams) error {
+	return s.q.MuteUser(ctx, sqlitedb.MuteUserParams{
+		MuterID: arg.MuterID,
+		MutedID: arg.MutedID,
+		Now:     now(),
+	})
+}
+
+func (s *SQLite) UnblockUser(ctx context.Context, arg database.UnblockUserParams) error {
+	return s.q.UnblockUser(ctx, sqlitedb.UnblockUserParams(arg))
+}
+
+func (s *SQLite) UnmuteUser(ctx context.Context, arg database.UnmuteUserParams) error {
+	return s.q.UnmuteUser(ctx, sqlitedb.UnmuteUserParams(arg))
+}
+
+// moderation
+
+func (s *SQLite) ClaimReport(ctx context.Context, arg database.ClaimReportParams) (database.Report, error) {
+	r, err := s.q.ClaimReport(ctx, sqlitedb.ClaimReportParams{
+		ClaimedBy: arg.ClaimedBy,
+		Now:       now(),
+		ID:        arg.ID,
+	})
+	return database.Report(r), err
+}
+
+func (s *SQLite) CreateModerationAction(ctx context.Context, arg database.CreateModerationActionParams) (database.ModerationAction, error) {
+	a, err := s.q.CreateModerationAction(ctx, sqlitedb.CreateModerationActionParams{
+		ID:           uuid.New(),
+		Now:          now(),
+		ModeratorID:  arg.ModeratorID,
+		Action:       arg.Action,
+		ReportID:     arg.ReportID,
+		ChirpID:      arg.ChirpID,
+		TargetUserID: arg.TargetUserID,
+		Note:         arg.Note,
+	})
+	return database.ModerationAction(a), err
+}
+
+func (s *SQLite) CreateReport(ctx context.Context, arg database.CreateReportParams) (database.Report, error) {
+	r, err := s.q.CreateReport(ctx, sqlitedb.CreateReportParams{
+		ID:         uuid.New(),
+		Now:        now(),
+		ChirpID:    arg.ChirpID,
+		ReporterID: arg.ReporterID,
+		Reason:     arg.Reason,
+		Details:    arg.Details,
+	})
+	return database.Report(r), sqliteErr(err)
+}
+
+func (s *SQLite) GetModerationActions(ctx context.Context, limit int32) ([]database.ModerationAction, error) {
+	actions, err := s.q.GetModerationActions(ctx, int64(limit))
+	return convertAll(actions, toAction), err
+}
+
+func (s *SQLite) GetReport(ctx context.Context, id uuid.UUID) (database.Report, error) {
+	r, err := s.q.GetReport(ctx, id)
+	return database.Report(r), err
+}
+
+func (s *SQLite) GetReportsByStatus(ctx context.Context, status string) ([]database.Report, error) {
+	reports, err := s.q.GetReportsByStatus(ctx, status)
+	return convertAll(reports, toReport), err
+}
+
+func (s *SQLite) ResolveReport(ctx context.Context, arg database.ResolveReportParams) (database.Report, error) {
+	r, err := s.q.ResolveReport(ctx, sqlitedb.ResolveReportParams{
+		Resolution: arg.Resolution,
+		Now:        now(),
+		ID:         arg.ID,
+		ClaimedBy:  arg.ClaimedBy,
+	})
+	return database.Report(r), err
+}
+
+// idempotency keys
+
+func (s *SQLite) CreateIdempotencyKey(ctx context.Context, arg database.CreateIdempotencyKeyParams) (database.IdempotencyKey, error) {
+	k, err := s.q.CreateIdempotencyKey(ctx, sqlitedb.CreateIdempotencyKeyParams{
+		UserID:      arg.UserID,
+		Key:         arg.Key,
+		RequestHash: arg.RequestHash,
+		Now:         now(),
+		ExpiresAt:   arg.ExpiresAt.UTC(),
+	})
+	return toIdempotencyKey(k), sqliteErr(err)
+}
+
+func (s *SQLite) DeleteExpiredIdempotencyKeys(ctx context.Context) error {
+	return s.q.DeleteExpiredIdempotencyKeys(ctx, now())
+}
+
+func (s *SQLite) DeleteIdempotencyKey(ctx context.Context, arg database.DeleteIdempotencyKeyParams) error {
+	return s.q.DeleteIdempotencyKey(ctx, sqlitedb.DeleteIdempotencyKeyParams(arg))
+}
+
+func (s *SQLite) GetIdempotencyKey(ctx context.Context, arg database.GetIdempotencyKeyParams) (database.IdempotencyKey, error) {
+	k, err := s.q.GetIdempotencyKey(ctx, sqlitedb.GetIdempotencyKeyParams(arg))
+	return toIdempotencyKey(k), err
+}
+
+func (s *SQLite) SaveIdempotencyResponse(ctx context.Context, arg database.SaveIdempotencyResponseParams) error {
+	return s.q.SaveIdempotencyResponse(ctx, sqlitedb.SaveIdempotencyResponseParams{
+		UserID:      arg.UserID,
+		Key:         arg.Key,
+		Status:      sql.NullInt64{Int64: int64(arg.Status.Int32), Valid: arg.Status.Valid},
+		ContentType: arg.ContentType,
+		Body:        arg.Body,
+		Headers:     arg.Headers,
+	})
+}
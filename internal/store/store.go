@@ -0,0 +1,103 @@
+// Package store is what the handlers talk to instead of a concrete database.
+// Postgres is the sqlc generated *database.Queries plus transactions, Memory
+// keeps everything in maps for tests and running without a database.
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/frankielb/chirpy/internal/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// ErrConflict is returned by the non postgres stores when a unique
+// constraint would be broken, check with IsUniqueViolation.
+var ErrConflict = errors.New("store: unique constraint violated")
+
+type Store interface {
+	// InTx runs fn in one transaction, committed if it returns nil and
+	// rolled back otherwise. fn must only use the Store it's given, sqlite
+	// has one connection and the tx is holding it. Calls already in a
+	// transaction just join it.
+	InTx(ctx context.Context, opts *sql.TxOptions, fn func(Store) error) error
+
+	// users
+	CreateUser(ctx context.Context, arg database.CreateUserParams) (database.User, error)
+	DeleteAllUsers(ctx context.Context) error
+	DowngradeRedByID(ctx context.Context, id uuid.UUID) error
+	GetUserByEmail(ctx context.Context, email string) (database.User, error)
+	GetUserByID(ctx context.Context, id uuid.UUID) (database.User, error)
+	ListUsers(ctx context.Context) ([]database.User, error)
+	SetUserRole(ctx context.Context, arg database.SetUserRoleParams) error
+	SuspendUser(ctx context.Context, arg database.SuspendUserParams) error
+	UnsuspendUser(ctx context.Context, id uuid.UUID) error
+	UpdatePswdEml(ctx context.Context, arg database.UpdatePswdEmlParams) error
+	UpgradeRedByID(ctx context.Context, id uuid.UUID) error
+
+	// chirps
+	CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error)
+	DeleteChirpByID(ctx context.Context, id uuid.UUID) error
+	DeleteChirpIfUnchanged(ctx context.Context, arg database.DeleteChirpIfUnchangedParams) (int64, error)
+	EachChirp(ctx context.Context, arg database.EachChirpParams, fn func(database.Chirp) error) error
+	GetChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error)
+	GetChirps(ctx context.Context, viewerID uuid.UUID) ([]database.Chirp, error)
+	GetChirpsByUser(ctx context.Context, arg database.GetChirpsByUserParams) ([]database.Chirp, error)
+	GetChirpsByUserVersion(ctx context.Context, arg database.GetChirpsByUserVersionParams) (database.GetChirpsByUserVersionRow, error)
+	GetChirpsVersion(ctx context.Context, viewerID uuid.UUID) (database.GetChirpsVersionRow, error)
+	HideChirp(ctx context.Context, id uuid.UUID) error
+
+	// refresh tokens
+	CreateRefreshToken(ctx context.Context, arg database.CreateRefreshTokenParams) (database.RefreshToken, error)
+	GetRefreshTokenFromToken(ctx context.Context, token string) (database.RefreshToken, error)
+	RevokeAllUserTokens(ctx context.Context, userID uuid.UUID) error
+	RevokeToken(ctx context.Context, token string) error
+
+	// direct messages
+	AddConversationMember(ctx context.Context, arg database.AddConversationMemberParams) error
+	CreateConversation(ctx context.Context) (database.Conversation, error)
+	CreateMessage(ctx context.Context, arg database.CreateMessageParams) (database.Message, error)
+	GetConversation(ctx context.Context, id uuid.UUID) (database.Conversation, error)
+	GetConversationMembers(ctx context.Context, conversationID uuid.UUID) ([]database.ConversationMember, error)
+	GetConversationsForUser(ctx context.Context, userID uuid.UUID) ([]database.Conversation, error)
+	GetDirectConversation(ctx context.Context, arg database.GetDirectConversationParams) (database.Conversation, error)
+	GetMessages(ctx context.Context, arg database.GetMessagesParams) ([]database.Message, error)
+	MarkConversationRead(ctx context.Context, arg database.MarkConversationReadParams) error
+	TouchConversation(ctx context.Context, id uuid.UUID) error
+
+	// blocks and mutes
+	BlockUser(ctx context.Context, arg database.BlockUserParams) error
+	GetUsersHidingAuthor(ctx context.Context, blockerID uuid.UUID) ([]uuid.UUID, error)
+	IsBlockedEitherWay(ctx context.Context, arg database.IsBlockedEitherWayParams) (bool, error)
+	MuteUser(ctx context.Context, arg database.MuteUserParams) error
+	UnblockUser(ctx context.Context, arg database.UnblockUserParams) error
+	UnmuteUser(ctx context.Context, arg database.UnmuteUserParams) error
+
+	// moderation
+	ClaimReport(ctx context.Context, arg database.ClaimReportParams) (database.Report, error)
+	CreateModerationAction(ctx context.Context, arg database.CreateModerationActionParams) (database.ModerationAction, error)
+	CreateReport(ctx context.Context, arg database.CreateReportParams) (database.Report, error)
+	GetModerationActions(ctx context.Context, limit int32) ([]database.ModerationAction, error)
+	GetReport(ctx context.Context, id uuid.UUID) (database.Report, error)
+	GetReportsByStatus(ctx context.Context, status string) ([]database.Report, error)
+	ResolveReport(ctx context.Context, arg database.ResolveReportParams) (database.Report, error)
+
+	// idempotency keys
+	CreateIdempotencyKey(ctx context.Context, arg database.CreateIdempotencyKeyParams) (database.IdempotencyKey, error)
+	DeleteExpiredIdempotencyKeys(ctx context.Context) error
+	DeleteIdempotencyKey(ctx context.Context, arg database.DeleteIdempotencyKeyParams) error
+	GetIdempotencyKey(ctx context.Context, arg database.GetIdempotencyKeyParams) (database.IdempotencyKey, error)
+	SaveIdempotencyResponse(ctx context.Context, arg database.SaveIdempotencyResponseParams) error
+}
+
+// IsUniqueViolation reports if err came from breaking a unique constraint,
+// whichever store it came from.
+func IsUniqueViolation(err error) bool {
+	if errors.Is(err, ErrConflict) {
+		return true
+	}
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
@@ -0,0 +1,122 @@
+// Package tracing sets up opentelemetry, with server spans for each route
+// and a span for every query the sqlc code runs.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentation = "github.com/frankielb/chirpy/internal/tracing"
+
+// exporters Setup knows about
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+// Setup installs the global tracer provider and the w3c traceparent
+// propagator. stdout writes pretty json spans to file, or stdout if file is
+// empty. otlp sends over http and reads OTEL_EXPORTER_OTLP_ENDPOINT and
+// friends itself. The returned func flushes and closes everything.
+func Setup(ctx context.Context, exporter, file string) (func(context.Context) error, error) {
+	// propagate even when not exporting so traces pass through us
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exp sdktrace.SpanExporter
+	var closer io.Closer
+	switch exporter {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		var out io.Writer = os.Stdout
+		if file != "" {
+			f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+			if err != nil {
+				return nil, fmt.Errorf("tracing: %w", err)
+			}
+			out, closer = f, f
+		}
+		e, err := stdouttrace.New(stdouttrace.WithWriter(out), stdouttrace.WithPrettyPrint())
+		if err != nil {
+			return nil, fmt.Errorf("tracing: %w", err)
+		}
+		exp = e
+	case ExporterOTLP:
+		e, err := otlptracehttp.New(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("tracing: %w", err)
+		}
+		exp = e
+	default:
+		return nil, fmt.Errorf("tracing: unknown exporter %q, want none, stdout or otlp", exporter)
+	}
+
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES still win
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName("chirpy")))
+	if err != nil {
+		return nil, fmt.Errorf("tracing: %w", err)
+	}
+	res, err = resource.Merge(res, resource.Environment())
+	if err != nil {
+		return nil, fmt.Errorf("tracing: %w", err)
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+	return func(ctx context.Context) error {
+		err := tp.Shutdown(ctx)
+		if closer != nil {
+			err = errors.Join(err, closer.Close())
+		}
+		return err
+	}, nil
+}
+
+// Middleware starts a server span per request, continuing the caller's
+// trace if it sent a traceparent. The span is named after the mux pattern
+// once routing has happened, so ids in paths don't make every name unique.
+// Middleware between this and the mux that copies the request hides the
+// pattern, routes behind any call SetRoute instead.
+func Middleware(next http.Handler) http.Handler {
+	named := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+		// the mux fills in r.Pattern when it routes
+		if r.Pattern == "" {
+			return
+		}
+		span := trace.SpanFromContext(r.Context())
+		span.SetName(r.Pattern)
+		span.SetAttributes(semconv.HTTPRoute(r.Pattern))
+	})
+	return otelhttp.NewHandler(named, "unmatched",
+		// prometheus scrapes are just noise
+		otelhttp.WithFilter(func(r *http.Request) bool { return r.URL.Path != "/metrics" }),
+	)
+}
+
+// SetRoute names the request's server span after the route that matched,
+// for when Middleware can't see r.Pattern.
+func SetRoute(ctx context.Context, route string) {
+	span := trace.SpanFromContext(ctx)
+	span.SetName(route)
+	span.SetAttributes(semconv.HTTPRoute(route))
+}
@@ -0,0 +1,105 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	_ "modernc.org/sqlite"
+)
+
+func TestQueryName(t *testing.T) {
+	tests := map[string]string{
+		"-- name: GetChirps :many\nSELECT 1": "GetChirps",
+		"select 1":                           "SELECT",
+		"  PRAGMA foreign_keys":              "PRAGMA",
+	}
+	for query, want := range tests {
+		if got := queryName(query); got != want {
+			t.Errorf("queryName(%q) = %q, want %q", query, got, want)
+		}
+	}
+}
+
+func TestSpans(t *testing.T) {
+	if _, err := Setup(context.Background(), ExporterNone, ""); err != nil {
+		t.Fatal(err)
+	}
+	rec := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+
+	conn, err := sql.Open("sqlite", "file::memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	db := WrapDB(conn, "sqlite")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /things/{id}", func(w http.ResponseWriter, r *http.Request) {
+		var n int
+		if err := db.QueryRowContext(r.Context(), "-- name: CountThings :one\nSELECT 1").Scan(&n); err != nil {
+			t.Error(err)
+		}
+	})
+	// a copy of the request going on, like compression does, hides
+	// r.Pattern so the route has to name the span itself
+	mux.HandleFunc("GET /copied/{id}", func(w http.ResponseWriter, r *http.Request) {
+		SetRoute(r.Context(), r.Pattern)
+	})
+	srv := httptest.NewServer(Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/copied/") {
+			r = r.Clone(r.Context())
+		}
+		mux.ServeHTTP(w, r)
+	})))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/copied/42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if spans := rec.Ended(); len(spans) != 1 || spans[0].Name() != "GET /copied/{id}" {
+		t.Fatalf("copied request spans = %v", spans)
+	}
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req, _ := http.NewRequest("GET", srv.URL+"/things/42", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	spans := rec.Ended()[1:]
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	dbSpan, server := spans[0], spans[1]
+	if dbSpan.Name() != "db CountThings" {
+		t.Errorf("db span name = %q", dbSpan.Name())
+	}
+	if server.Name() != "GET /things/{id}" {
+		t.Errorf("server span name = %q", server.Name())
+	}
+	if dbSpan.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Error("db span isn't a child of the server span")
+	}
+	if got := server.SpanContext().TraceID().String(); got != traceID {
+		t.Errorf("trace id = %s, want the one from traceparent", got)
+	}
+}
+
+func TestSetupUnknown(t *testing.T) {
+	if _, err := Setup(context.Background(), "zipkin", ""); err == nil {
+		t.Error("expected an error for an unknown exporter")
+	}
+}
@@ -1,40 +1,241 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
-	"log"
+	"errors"
+	"io"
+	"log/slog"
 	"net/http"
+	"strings"
+
+	"github.com/frankielb/chirpy/internal/logging"
+	"github.com/frankielb/chirpy/internal/service"
+	"google.golang.org/protobuf/encoding/protowire"
 )
 
-func respondJSONError(w http.ResponseWriter, code int, msg string, err error) {
-	if err != nil {
-		log.Println(err)
-	}
-	// server errors
-	if code > 499 {
-		log.Printf("Responding with 5XX error: %s", msg)
+// problem is an RFC 7807 error body, sent as application/problem+json.
+// Code is for programs to switch on, Detail is for people.
+type problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []fieldError `json:"errors,omitempty"`
+}
+
+// fieldError is one thing wrong with one field of a request body.
+type fieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// codes that aren't just the status text
+const (
+	codeMalformedJSON    = "malformed_json"
+	codeMalformedBody    = "malformed_body"
+	codeEmptyBody        = "empty_body"
+	codeUnknownField     = "unknown_field"
+	codeBodyTooLarge     = "body_too_large"
+	codeUnsupportedMedia = "unsupported_media_type"
+	codeValidation       = "validation_failed"
+)
+
+// statusCode turns "Not Found" into "not_found", for errors that don't need
+// anything more specific.
+func statusCode(status int) string {
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
+
+func respondJSONError(w http.ResponseWriter, r *http.Request, code int, msg string, err error) {
+	respondProblem(w, r, problem{Status: code, Detail: msg}, err)
+}
+
+// respondServiceError turns an error from the service layer into its
+// problem response.
+func respondServiceError(w http.ResponseWriter, r *http.Request, err error) {
+	var serr *service.Error
+	if !errors.As(err, &serr) {
+		respondJSONError(w, r, http.StatusInternalServerError, "Internal server error", err)
+		return
 	}
-	type errResponse struct {
-		Err string `json:"error"`
+	p := problem{Detail: serr.Msg}
+	switch {
+	case errors.Is(err, service.ErrInvalid):
+		p.Status = http.StatusUnprocessableEntity
+		p.Code = codeValidation
+		for _, f := range serr.Fields {
+			p.Errors = append(p.Errors, fieldError{Field: f.Field, Code: f.Code, Message: f.Message})
+		}
+	case errors.Is(err, service.ErrUnauthorized):
+		p.Status = http.StatusUnauthorized
+	case errors.Is(err, service.ErrForbidden):
+		p.Status = http.StatusForbidden
+	case errors.Is(err, service.ErrNotFound):
+		p.Status = http.StatusNotFound
+	case errors.Is(err, service.ErrConflict):
+		p.Status = http.StatusConflict
+	case errors.Is(err, service.ErrPrecondition):
+		p.Status = http.StatusPreconditionFailed
+	default:
+		p.Status = http.StatusInternalServerError
 	}
-	respondJSON(w, code, errResponse{
-		Err: msg,
-	})
+	respondProblem(w, r, p, serr.Err)
 }
 
-func respondJSON(w http.ResponseWriter, statusCode int, data interface{}) {
-	//interface{} means anything, so any struct
+// respondProblem fills in whatever p leaves empty from the status and the
+// request, logs it, and writes it. err is only logged, never sent.
+func respondProblem(w http.ResponseWriter, r *http.Request, p problem, err error) {
+	if p.Type == "" {
+		// the status and code say it all, see RFC 7807 section 4.2
+		p.Type = "about:blank"
+	}
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+	if p.Code == "" {
+		p.Code = statusCode(p.Status)
+	}
+	p.Instance = r.URL.Path
+	p.RequestID = logging.RequestID(r.Context())
 
-	// metadata, tells the client its json
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
+	// the request logger already has the request id and user on it
+	logger := logging.FromContext(r.Context())
+	attrs := []any{"status", p.Status, "code", p.Code, "msg", p.Detail}
+	if err != nil {
+		attrs = append(attrs, "err", err)
+	}
+	// server errors are ours, client ones are just noise unless debugging
+	if p.Status > 499 {
+		logger.ErrorContext(r.Context(), "responding with server error", attrs...)
+	} else {
+		logger.DebugContext(r.Context(), "responding with client error", attrs...)
+	}
+	writeBody(w, r, "application/problem+json", p.Status, p)
+}
+
+// respondJSON is named for the default, the body goes out in whichever
+// format the client's Accept asks for.
+func respondJSON(w http.ResponseWriter, r *http.Request, statusCode int, data interface{}) {
+	writeBody(w, r, mediaJSON, statusCode, data)
+}
 
-	jsonData, err := json.Marshal(data)
+// writeBody writes data in the negotiated format. jsonType is the
+// Content-Type when that's json.
+func writeBody(w http.ResponseWriter, r *http.Request, jsonType string, statusCode int, data interface{}) {
+	//interface{} means anything, so any struct
+	f := negotiateFormat(r, protoMessage(data) != nil)
+	body, err := marshalBody(f, data)
 	if err != nil {
-		log.Printf("Error marshalling JSON: %s", err)
+		slog.Error("marshalling response", "err", err)
 		w.WriteHeader(500)
 		return
 	}
+
+	// metadata, tells the client what it's getting
+	contentType := jsonType
+	if f != formatJSON {
+		contentType = formatMedia[f][0]
+	}
+	w.Header().Set("Content-Type", contentType)
+	varyAccept(w.Header())
 	w.WriteHeader(statusCode)
-	w.Write(jsonData)
+	w.Write(body)
+}
+
+// respondJSONArray streams an array, each calls add once per element and
+// they're encoded and written as they come, so the whole list is never in
+// memory. An error before anything is sent is a normal 500 with msg. After
+// that the status is gone so the connection is cut instead, the client
+// mustn't mistake half a list for all of it.
+//
+// Protobuf sends the elements as field 1 of a list message, an empty list
+// is no bytes whatever the message. Msgpack needs the length up front, so
+// it holds the encoded elements until the end.
+func respondJSONArray(w http.ResponseWriter, r *http.Request, statusCode int, msg string, each func(add func(v any) error) error) {
+	var (
+		f       format
+		decided bool
+		sent    bool
+		n       int
+		held    bytes.Buffer
+	)
+	send := func() {
+		contentType := mediaJSON
+		if f != formatJSON {
+			contentType = formatMedia[f][0]
+		}
+		w.Header().Set("Content-Type", contentType)
+		varyAccept(w.Header())
+		w.WriteHeader(statusCode)
+		sent = true
+	}
+	decide := func(hasProto bool) {
+		f = negotiateFormat(r, hasProto)
+		decided = true
+		if f != formatMsgpack {
+			send()
+		}
+	}
+
+	err := each(func(v any) error {
+		if !decided {
+			decide(protoMessage(v) != nil)
+			if f == formatJSON {
+				if _, err := io.WriteString(w, "["); err != nil {
+					return err
+				}
+			}
+		} else if f == formatJSON {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		n++
+		switch f {
+		case formatMsgpack:
+			return newMsgpackEncoder(&held).Encode(v)
+		case formatProtobuf:
+			b, err := marshalBody(f, v)
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(protowire.AppendBytes(protowire.AppendTag(nil, 1, protowire.BytesType), b))
+			return err
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	})
+	switch {
+	case err != nil && !sent:
+		respondJSONError(w, r, http.StatusInternalServerError, msg, err)
+		return
+	case err != nil:
+		logging.FromContext(r.Context()).ErrorContext(r.Context(), "streaming array", "err", err)
+		panic(http.ErrAbortHandler)
+	}
+	if !decided {
+		decide(true)
+		if f == formatJSON {
+			io.WriteString(w, "[")
+		}
+	}
+	switch f {
+	case formatJSON:
+		io.WriteString(w, "]")
+	case formatMsgpack:
+		var header bytes.Buffer
+		newMsgpackEncoder(&header).EncodeArrayLen(n)
+		send()
+		w.Write(header.Bytes())
+		w.Write(held.Bytes())
+	}
 }
@@ -1,89 +1,438 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"sync/atomic"
+	"syscall"
+	"time"
 
+	"github.com/frankielb/chirpy/api"
+	"github.com/frankielb/chirpy/internal/auth"
+	"github.com/frankielb/chirpy/internal/compress"
+	"github.com/frankielb/chirpy/internal/config"
 	"github.com/frankielb/chirpy/internal/database"
+	"github.com/frankielb/chirpy/internal/grpcserver"
+	"github.com/frankielb/chirpy/internal/health"
+	"github.com/frankielb/chirpy/internal/logging"
+	"github.com/frankielb/chirpy/internal/metrics"
+	"github.com/frankielb/chirpy/internal/migrate"
+	"github.com/frankielb/chirpy/internal/ratelimit"
+	"github.com/frankielb/chirpy/internal/realtime"
+	"github.com/frankielb/chirpy/internal/service"
+	"github.com/frankielb/chirpy/internal/store"
+	"github.com/frankielb/chirpy/internal/tracing"
+	"github.com/google/uuid"
 	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
+	"google.golang.org/grpc"
 )
 
 func main() {
-	// db stuff
 	godotenv.Load()
-	dbURL := os.Getenv("DB_URL")
-	db, err := sql.Open("postgres", dbURL)
+	// defaults < CHIRPY_CONFIG yaml < env < flags
+	cfg, args, err := config.Load(os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		usage()
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	logger, err := logging.New(os.Stdout, cfg.LogLevel, cfg.LogFormat)
 	if err != nil {
 		log.Fatal(err)
 	}
-	dbQueries := database.New(db)
+	// the log package goes through this too
+	slog.SetDefault(logger)
+
+	// db stuff
+	db, conn, err := store.Open(cfg.DBURL)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if conn != nil {
+		defer conn.Close()
+	}
+
+	cmd := ""
+	if len(args) > 0 {
+		cmd = args[0]
+	}
+	switch cmd {
+	case "", "serve":
+		serve(cfg, db, conn)
+	case "migrate":
+		// chirpy migrate up|down|status
+		if err := runMigrate(cfg.DBURL, conn, args[1:]); err != nil {
+			log.Fatal(err)
+		}
+	case "help":
+		usage()
+	default:
+		if conn == nil {
+			log.Fatal("admin commands need a postgres or sqlite DB_URL")
+		}
+		driver, _ := store.Driver(cfg.DBURL)
+		if err := migrate.Check(context.Background(), conn, driver); err != nil {
+			log.Fatalf("%v, run `chirpy migrate up` first", err)
+		}
+		if err := runAdmin(context.Background(), db, args, os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, adminUsage)
+	fmt.Fprintln(os.Stderr, "\nflags, each can also be set in the yaml file or by the env var:")
+	config.Usage(os.Stderr)
+}
+
+func serve(cfg config.Config, db store.Store, conn *sql.DB) {
+	// fail now rather than sign tokens with an empty secret
+	if err := cfg.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	if conn == nil {
+		// no database, handy for trying things out, nothing is kept
+		log.Println("No DB_URL, using the in-memory store")
+	} else {
+		// dont serve against a schema the queries dont match
+		driver, _ := store.Driver(cfg.DBURL)
+		if cfg.AutoMigrate {
+			if err := migrate.Up(context.Background(), conn, driver); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if err := migrate.Check(context.Background(), conn, driver); err != nil {
+			log.Fatalf("%v, run `chirpy migrate up` or start with -auto-migrate", err)
+		}
+	}
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.TraceExporter, cfg.TraceFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	// init counter
-	apiCfg := apiConfig{
-		fileserverHits: atomic.Int32{},
-		DB:             dbQueries,
-		Platform:       os.Getenv("PLATFORM"),
-		Secret:         os.Getenv("SECRET"),
-		PolkaKey:       os.Getenv("POLKA_KEY"),
+	apiCfg := &apiConfig{
+		Config:  cfg,
+		DB:      db,
+		Hub:     realtime.NewHub(5),
+		Health:  health.NewRegistry(cfg.HealthTimeout),
+		Metrics: metrics.New(),
+	}
+	apiCfg.Service = apiCfg.newService()
+	if conn != nil {
+		apiCfg.Metrics.RegisterDB(conn)
+	}
+	apiCfg.registerChecks(conn, cfg.DBURL)
+	pgLimits, err := apiCfg.setupRateLimits(conn)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// create the server
+	server := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           apiCfg.handler(),
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+	}
+	// websockets are hijacked so Shutdown won't close them itself
+	server.RegisterOnShutdown(apiCfg.Hub.CloseAll)
+	// the grpc api on its own port, nil when it's off
+	var grpcServer *grpc.Server
+	var grpcLis net.Listener
+	if cfg.GRPCAddr != "" {
+		grpcLis, err = net.Listen("tcp", cfg.GRPCAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		grpcServer = grpcserver.New(apiCfg.Service, slog.Default(), grpcserver.Options{
+			Reflection: cfg.GRPCReflection,
+			Limiter:    apiCfg.Limiter,
+			IsRed:      apiCfg.isRed,
+		})
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if pgLimits != nil {
+		go sweepRateLimits(ctx, pgLimits, apiCfg.Limiter.Refill())
+	}
+	go sweepIdempotencyKeys(ctx, db)
+	errc := make(chan error, 2)
+	go func() {
+		slog.Info("serving", "addr", cfg.Addr)
+		errc <- server.ListenAndServe()
+	}()
+	if grpcServer != nil {
+		go func() {
+			slog.Info("serving grpc", "addr", grpcLis.Addr().String())
+			errc <- grpcServer.Serve(grpcLis)
+		}()
+	}
+	select {
+	case err := <-errc:
+		log.Fatal(err)
+	case <-ctx.Done():
+	}
+	// a second signal kills us straight away
+	stop()
+
+	if err := apiCfg.drain(server, grpcServer); err != nil {
+		log.Fatal(err)
+	}
+	// send off any spans still batched up
+	tctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := shutdownTracing(tctx); err != nil {
+		slog.Error("flushing traces", "err", err)
+	}
+	log.Println("Server stopped")
+}
+
+// drain fails readiness, waits for the load balancer to notice, then lets
+// in flight requests finish. grpcServer can be nil, its calls get the same
+// time as the http ones and are cut off after.
+func (cfg *apiConfig) drain(server *http.Server, grpcServer *grpc.Server) error {
+	cfg.draining.Store(true)
+	slog.Info("shutting down", "drain_delay", cfg.DrainDelay.String())
+	time.Sleep(cfg.DrainDelay)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if grpcServer == nil {
+		return server.Shutdown(ctx)
 	}
+	stopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
+	err := server.Shutdown(ctx)
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		grpcServer.Stop()
+	}
+	return err
+}
+
+// runMigrate is the migrate subcommand.
+func runMigrate(dbURL string, conn *sql.DB, args []string) error {
+	if conn == nil {
+		return errors.New("migrate needs a postgres or sqlite DB_URL")
+	}
+	driver, _ := store.Driver(dbURL)
+	ctx := context.Background()
+	cmd := ""
+	if len(args) > 0 {
+		cmd = args[0]
+	}
+	switch cmd {
+	case "up":
+		return migrate.Up(ctx, conn, driver)
+	case "down":
+		return migrate.Down(ctx, conn, driver)
+	case "status":
+		return migrate.Status(ctx, conn, driver, os.Stdout)
+	}
+	return fmt.Errorf("usage: chirpy migrate up|down|status")
+}
+
+// handler is routes with the middleware every request goes through.
+func (cfg *apiConfig) handler() http.Handler {
+	// logging first so everything after it has the request id
+	h := cfg.Metrics.Middleware(cfg.middlewareMaxBody(cfg.routes()))
+	// outside the routes so idempotency keys save the plain body
+	if cfg.Compression {
+		h = compress.Middleware(h)
+	}
+	return logging.Middleware(slog.Default(), tracing.Middleware(h))
+}
+
+// router is a mux that remembers its patterns, so the openapi test can
+// check every route is documented, and hands each one to the access log.
+// wrap, if set, gets each handler with its pattern before it's registered.
+type router struct {
+	*http.ServeMux
+	patterns []string
+	wrap     func(pattern string, h http.Handler) http.Handler
+}
+
+func (rt *router) Handle(pattern string, handler http.Handler) {
+	rt.patterns = append(rt.patterns, pattern)
+	if rt.wrap != nil {
+		handler = rt.wrap(pattern, handler)
+	}
+	inner := handler
+	rt.ServeMux.Handle(pattern, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logging.SetRoute(r.Context(), pattern)
+		tracing.SetRoute(r.Context(), pattern)
+		inner.ServeHTTP(w, r)
+	}))
+}
+
+func (rt *router) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	rt.Handle(pattern, http.HandlerFunc(handler))
+}
+
+// routes registers every handler on a new mux.
+func (cfg *apiConfig) routes() *router {
 	// init router
-	mux := http.NewServeMux()
+	// rate limits and idempotency keys are per route so they go on each
+	// handler, replays still count against the limit
+	mux := &router{ServeMux: http.NewServeMux(), wrap: func(pattern string, h http.Handler) http.Handler {
+		return cfg.middlewareRateLimit(pattern, cfg.middlewareIdempotency(pattern, h))
+	}}
 
 	// shows where files are on my mach
-	fileServer := http.FileServer(http.Dir("."))
+	// with a .br or .gz next to a file that's sent instead
+	fileServer := compress.FileServer(http.Dir("."))
 	// the /app isnt used in paths on mach, so remove
 	fsHandler := http.StripPrefix("/app", fileServer)
 	// setup file server with wrapper
-	mux.Handle("/app/", apiCfg.middlewareMetricsInc(fsHandler))
+	mux.Handle("/app/", cfg.middlewareMetricsInc(fsHandler))
 
 	// register handlers for various things
-	mux.HandleFunc("GET /api/healthz", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("OK"))
-	})
-	mux.HandleFunc("GET /admin/metrics", apiCfg.metricsHandler)
-	mux.HandleFunc("POST /admin/reset", apiCfg.resetHandler)
+	// liveness, healthz is the old name for it
+	mux.HandleFunc("GET /api/healthz", livenessHandler)
+	mux.HandleFunc("GET /api/livez", livenessHandler)
+	// runs the checks, fails while draining on shutdown
+	mux.HandleFunc("GET /api/readyz", cfg.readyHandler)
+	mux.Handle("GET /metrics", cfg.Metrics.Handler())
+	mux.HandleFunc("GET /api/openapi.json", openAPIHandler)
+	mux.Handle("GET /admin/metrics", cfg.middlewareRequireRole(roleAdmin, cfg.metricsHandler))
+	mux.Handle("POST /admin/reset", cfg.middlewareRequireRole(roleAdmin, cfg.resetHandler))
 	//mux.HandleFunc("POST /api/validate_chirp", validateHandler)
-	mux.HandleFunc("POST /api/users", apiCfg.createUserHandler)
-	mux.HandleFunc("POST /api/chirps", apiCfg.createChirpHandler)
-	mux.HandleFunc("GET /api/chirps", apiCfg.getChirpsHandler)
-	mux.HandleFunc("GET /api/chirps/{chirpID}", apiCfg.getChirpHandler)
-	mux.HandleFunc("POST /api/login", apiCfg.loginHandler)
-	mux.HandleFunc("POST /api/refresh", apiCfg.refreshHandler)
-	mux.HandleFunc("POST /api/revoke", apiCfg.revokeHandler)
-	mux.HandleFunc("PUT /api/users", apiCfg.updatePswdEmlHandler)
-	mux.HandleFunc("DELETE /api/chirps/{chirpID}", apiCfg.deleteChirpHandler)
-	mux.HandleFunc("POST /api/polka/webhooks", apiCfg.upgradeHandler)
+	mux.HandleFunc("POST /api/users", cfg.createUserHandler)
+	mux.HandleFunc("POST /api/chirps", cfg.createChirpHandler)
+	mux.HandleFunc("GET /api/chirps", cfg.getChirpsHandler)
+	mux.HandleFunc("GET /api/chirps/{chirpID}", cfg.getChirpHandler)
+	mux.HandleFunc("POST /api/login", cfg.loginHandler)
+	mux.HandleFunc("POST /api/refresh", cfg.refreshHandler)
+	mux.HandleFunc("POST /api/revoke", cfg.revokeHandler)
+	mux.HandleFunc("PUT /api/users", cfg.updatePswdEmlHandler)
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}", cfg.deleteChirpHandler)
+	mux.HandleFunc("POST /api/polka/webhooks", cfg.upgradeHandler)
+	mux.HandleFunc("GET /api/ws", cfg.realtimeHandler)
+	mux.HandleFunc("POST /api/conversations", cfg.createConversationHandler)
+	mux.HandleFunc("GET /api/conversations", cfg.getConversationsHandler)
+	mux.HandleFunc("POST /api/conversations/{conversationID}/messages", cfg.createMessageHandler)
+	mux.HandleFunc("GET /api/conversations/{conversationID}/messages", cfg.getMessagesHandler)
+	mux.HandleFunc("POST /api/conversations/{conversationID}/read", cfg.markConversationReadHandler)
+	mux.HandleFunc("POST /api/users/{userID}/block", cfg.blockHandler)
+	mux.HandleFunc("DELETE /api/users/{userID}/block", cfg.unblockHandler)
+	mux.HandleFunc("POST /api/users/{userID}/mute", cfg.muteHandler)
+	mux.HandleFunc("DELETE /api/users/{userID}/mute", cfg.unmuteHandler)
+	mux.HandleFunc("POST /api/chirps/{chirpID}/reports", cfg.createReportHandler)
+	mux.Handle("GET /admin/reports", cfg.middlewareRequireRole(roleModerator, cfg.getReportsHandler))
+	mux.Handle("POST /admin/reports/{reportID}/claim", cfg.middlewareRequireRole(roleModerator, cfg.claimReportHandler))
+	mux.Handle("POST /admin/reports/{reportID}/resolve", cfg.middlewareRequireRole(roleModerator, cfg.resolveReportHandler))
+	mux.Handle("GET /admin/moderation/actions", cfg.middlewareRequireRole(roleModerator, cfg.getModerationActionsHandler))
+	mux.Handle("PUT /admin/users/{userID}/role", cfg.middlewareRequireRole(roleAdmin, cfg.setRoleHandler))
+	mux.Handle("POST /admin/users/{userID}/suspend", cfg.middlewareRequireRole(roleModerator, cfg.suspendUserHandler))
+	mux.Handle("DELETE /admin/users/{userID}/suspend", cfg.middlewareRequireRole(roleModerator, cfg.unsuspendUserHandler))
 
-	// create the server
-	server := &http.Server{
-		Addr:    ":8080",
-		Handler: mux,
+	return mux
+}
+
+type apiConfig struct {
+	// Platform, Secret etc come from here
+	config.Config
+	DB  store.Store
+	Hub *realtime.Hub
+	// prometheus registry, also drives the admin hits page
+	Metrics *metrics.Metrics
+	// readiness checks, see registerChecks
+	Health *health.Registry
+	// nil when rate limiting is off
+	Limiter *ratelimit.Limiter
+	// who's red, for scaling rate limits
+	redUsers redCache
+	// the chirp and user logic, shared with the grpc server
+	Service *service.Service
+	// set once shutdown starts
+	draining atomic.Bool
+}
+
+// newService is the service over cfg's store, telling the realtime hub
+// about chirps.
+func (cfg *apiConfig) newService() *service.Service {
+	return &service.Service{
+		Config:  &cfg.Config,
+		DB:      cfg.DB,
+		Metrics: cfg.Metrics,
+		OnChirp: func(ctx context.Context, msgType string, chirp database.Chirp) {
+			cfg.publishChirp(ctx, msgType, toChirpJSON(chirp))
+		},
 	}
-	if err := server.ListenAndServe(); err != nil {
-		log.Fatal(err)
+}
+
+// authUserID gets the user from the bearer jwt, writing the 401 if it cant.
+func (cfg *apiConfig) authUserID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondJSONError(w, r, http.StatusUnauthorized, "unauthorized: no token", err)
+		return uuid.Nil, false
 	}
+	userID, err := auth.ValidateJWT(token, cfg.Secret)
+	if err != nil {
+		respondJSONError(w, r, http.StatusUnauthorized, "unauthorized: bad token", err)
+		return uuid.Nil, false
+	}
+	logging.SetUserID(r.Context(), userID)
+	return userID, true
+}
 
+// tokenUserID is the user from a good bearer jwt, for middleware that
+// only wants to know who it is and leaves the 401 to the handler.
+func (cfg *apiConfig) tokenUserID(r *http.Request) (uuid.UUID, bool) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	userID, err := auth.ValidateJWT(token, cfg.Secret)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	return userID, true
 }
 
-type apiConfig struct {
-	fileserverHits atomic.Int32
-	DB             *database.Queries
-	Platform       string
-	Secret         string
-	PolkaKey       string
+// viewerID is authUserID for endpoints that also work logged out, it gives
+// uuid.Nil when there is no token but still rejects a bad one.
+func (cfg *apiConfig) viewerID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	if r.Header.Get("Authorization") == "" {
+		return uuid.Nil, true
+	}
+	return cfg.authUserID(w, r)
+}
+
+// middlewareMaxBody stops a client sending us an endless body.
+func (cfg *apiConfig) middlewareMaxBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, int64(cfg.MaxBodyBytes))
+		next.ServeHTTP(w, r)
+	})
 }
 
 func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
 	// takes handler and adds the count to it
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// increment count
-		cfg.fileserverHits.Add(1)
+		cfg.Metrics.FileserverHits.Inc()
 		// og handler called
 		next.ServeHTTP(w, r)
 	})
@@ -99,20 +448,28 @@ func (cfg *apiConfig) metricsHandler(w http.ResponseWriter, r *http.Request) {
 			<p>Chirpy has been visited %d times!</p>
 		  </body>
 		</html>`,
-		cfg.fileserverHits.Load())))
+		cfg.Metrics.Hits())))
 }
 func (cfg *apiConfig) resetHandler(w http.ResponseWriter, r *http.Request) {
 	if cfg.Platform != "dev" {
-		http.Error(w, "Forbidden", http.StatusForbidden)
+		respondJSONError(w, r, http.StatusForbidden, "reset is only allowed on dev", nil)
 		return
 	}
-	cfg.fileserverHits.Store(0)
+	cfg.Metrics.ResetHits()
 	err := cfg.DB.DeleteAllUsers(r.Context())
 	if err != nil {
-		respondJSONError(w, http.StatusInternalServerError, "Failed to reset users database", err)
+		respondJSONError(w, r, http.StatusInternalServerError, "Failed to reset users database", err)
 		return
 	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("All users and server hits reset"))
 
 }
+
+// openAPIHandler serves the api description from api/openapi.json.
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(api.OpenAPI)
+}
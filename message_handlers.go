@@ -0,0 +1,371 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/frankielb/chirpy/internal/database"
+	"github.com/frankielb/chirpy/internal/realtime"
+	"github.com/frankielb/chirpy/internal/service"
+	"github.com/frankielb/chirpy/internal/store"
+	"github.com/google/uuid"
+)
+
+// who is allowed to start a DM, set with DM_POLICY. A mutual followers
+// policy can go here once there are follows to check against.
+const (
+	dmPolicyEveryone = "everyone"
+	dmPolicyRed      = "red" // sender must be a Chirpy Red user
+)
+
+const (
+	maxConversationMembers = 8
+	maxMessageLength       = 1000
+	defaultMessagesLimit   = 50
+	maxMessagesLimit       = 100
+)
+
+type conversationJSON struct {
+	ID        uuid.UUID   `json:"id"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+	MemberIDs []uuid.UUID `json:"member_ids"`
+}
+
+type messageJSON struct {
+	ID             uuid.UUID `json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	ConversationID uuid.UUID `json:"conversation_id"`
+	SenderID       uuid.UUID `json:"sender_id"`
+	Body           string    `json:"body"`
+}
+
+func (cfg *apiConfig) createConversationHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authUserID(w, r)
+	if !ok {
+		return
+	}
+	if !cfg.checkNotSuspended(w, r, userID) {
+		return
+	}
+	type request struct {
+		MemberIDs []uuid.UUID `json:"member_ids"`
+	}
+	req := request{}
+	if !decodeJSON(w, r, &req, nil) {
+		return
+	}
+
+	// everyone else in the conversation, without dupes or ourself
+	seen := map[uuid.UUID]bool{userID: true}
+	others := []uuid.UUID{}
+	for _, id := range req.MemberIDs {
+		if !seen[id] {
+			seen[id] = true
+			others = append(others, id)
+		}
+	}
+	if len(others) == 0 {
+		respondJSONError(w, r, http.StatusBadRequest, "conversation needs at least one other member", nil)
+		return
+	}
+	if len(others)+1 > maxConversationMembers {
+		respondJSONError(w, r, http.StatusBadRequest, "too many members", nil)
+		return
+	}
+
+	if cfg.DMPolicy == dmPolicyRed {
+		sender, err := cfg.DB.GetUserByID(r.Context(), userID)
+		if err != nil {
+			respondJSONError(w, r, http.StatusInternalServerError, "Couldn't get user", err)
+			return
+		}
+		if !sender.IsChirpyRed {
+			respondJSONError(w, r, http.StatusForbidden, "direct messages need Chirpy Red", nil)
+			return
+		}
+	}
+	for _, id := range others {
+		if _, err := cfg.DB.GetUserByID(r.Context(), id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				respondJSONError(w, r, http.StatusNotFound, "user not found", err)
+				return
+			}
+			respondJSONError(w, r, http.StatusInternalServerError, "Couldn't get user", err)
+			return
+		}
+	}
+
+	blocked, err := cfg.blockedWithAny(r, userID, others)
+	if err != nil {
+		respondJSONError(w, r, http.StatusInternalServerError, "Couldn't check blocks", err)
+		return
+	}
+	if blocked {
+		respondJSONError(w, r, http.StatusForbidden, "can't message a blocked user", nil)
+		return
+	}
+
+	// one to one conversations are reused
+	if len(others) == 1 {
+		convo, err := cfg.DB.GetDirectConversation(r.Context(), database.GetDirectConversationParams{
+			UserID:   userID,
+			UserID_2: others[0],
+		})
+		if err == nil {
+			respondJSON(w, r, http.StatusOK, conversationJSON{
+				ID:        convo.ID,
+				CreatedAt: convo.CreatedAt,
+				UpdatedAt: convo.UpdatedAt,
+				MemberIDs: []uuid.UUID{userID, others[0]},
+			})
+			return
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			respondJSONError(w, r, http.StatusInternalServerError, "Couldn't get conversation", err)
+			return
+		}
+	}
+
+	// all or nothing, a conversation missing members would be found by
+	// GetDirectConversation for the wrong people
+	var convo database.Conversation
+	members := append([]uuid.UUID{userID}, others...)
+	err = cfg.DB.InTx(r.Context(), nil, func(tx store.Store) error {
+		var err error
+		convo, err = tx.CreateConversation(r.Context())
+		if err != nil {
+			return err
+		}
+		for _, id := range members {
+			if err := tx.AddConversationMember(r.Context(), database.AddConversationMemberParams{
+				ConversationID: convo.ID,
+				UserID:         id,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		respondJSONError(w, r, http.StatusInternalServerError, "Couldn't create conversation", err)
+		return
+	}
+	respondJSON(w, r, http.StatusCreated, conversationJSON{
+		ID:        convo.ID,
+		CreatedAt: convo.CreatedAt,
+		UpdatedAt: convo.UpdatedAt,
+		MemberIDs: members,
+	})
+}
+
+func (cfg *apiConfig) getConversationsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authUserID(w, r)
+	if !ok {
+		return
+	}
+	convos, err := cfg.DB.GetConversationsForUser(r.Context(), userID)
+	if err != nil {
+		respondJSONError(w, r, http.StatusInternalServerError, "Couldn't get conversations", err)
+		return
+	}
+	responses := []conversationJSON{}
+	for _, convo := range convos {
+		members, err := cfg.DB.GetConversationMembers(r.Context(), convo.ID)
+		if err != nil {
+			respondJSONError(w, r, http.StatusInternalServerError, "Couldn't get members", err)
+			return
+		}
+		responses = append(responses, conversationJSON{
+			ID:        convo.ID,
+			CreatedAt: convo.CreatedAt,
+			UpdatedAt: convo.UpdatedAt,
+			MemberIDs: memberIDs(members),
+		})
+	}
+	respondJSON(w, r, http.StatusOK, responses)
+}
+
+// conversationMembers loads the conversation in the path and checks the user
+// is in it. Non members get a 404 so they cant probe for conversations.
+func (cfg *apiConfig) conversationMembers(w http.ResponseWriter, r *http.Request, userID uuid.UUID) (uuid.UUID, []database.ConversationMember, bool) {
+	convoID, err := uuid.Parse(r.PathValue("conversationID"))
+	if err != nil {
+		respondJSONError(w, r, http.StatusBadRequest, "Invalid conversation ID", err)
+		return uuid.Nil, nil, false
+	}
+	members, err := cfg.DB.GetConversationMembers(r.Context(), convoID)
+	if err != nil {
+		respondJSONError(w, r, http.StatusInternalServerError, "Couldn't get members", err)
+		return uuid.Nil, nil, false
+	}
+	for _, m := range members {
+		if m.UserID == userID {
+			return convoID, members, true
+		}
+	}
+	respondJSONError(w, r, http.StatusNotFound, "Conversation not found", nil)
+	return uuid.Nil, nil, false
+}
+
+func (cfg *apiConfig) createMessageHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authUserID(w, r)
+	if !ok {
+		return
+	}
+	if !cfg.checkNotSuspended(w, r, userID) {
+		return
+	}
+	convoID, members, ok := cfg.conversationMembers(w, r, userID)
+	if !ok {
+		return
+	}
+	type request struct {
+		Body string `json:"body"`
+	}
+	req := request{}
+	if !decodeJSON(w, r, &req, func(v *service.Validator) {
+		v.Check(req.Body != "", "body", "required", "Message is empty")
+		v.Check(len(req.Body) <= maxMessageLength, "body", "too_long", "Message is too long")
+	}) {
+		return
+	}
+	blocked, err := cfg.blockedWithAny(r, userID, memberIDs(members))
+	if err != nil {
+		respondJSONError(w, r, http.StatusInternalServerError, "Couldn't check blocks", err)
+		return
+	}
+	if blocked {
+		respondJSONError(w, r, http.StatusForbidden, "can't message a blocked user", nil)
+		return
+	}
+
+	// together, so the conversation list never misses a message or moves
+	// up for one that wasn't saved
+	var msg database.Message
+	err = cfg.DB.InTx(r.Context(), nil, func(tx store.Store) error {
+		var err error
+		msg, err = tx.CreateMessage(r.Context(), database.CreateMessageParams{
+			ConversationID: convoID,
+			SenderID:       userID,
+			Body:           req.Body,
+		})
+		if err != nil {
+			return err
+		}
+		return tx.TouchConversation(r.Context(), convoID)
+	})
+	if err != nil {
+		respondJSONError(w, r, http.StatusInternalServerError, "Couldn't create message", err)
+		return
+	}
+	response := messageJSON{
+		ID:             msg.ID,
+		CreatedAt:      msg.CreatedAt,
+		ConversationID: msg.ConversationID,
+		SenderID:       msg.SenderID,
+		Body:           msg.Body,
+	}
+	respondJSON(w, r, http.StatusCreated, response)
+	for _, m := range members {
+		if m.UserID != userID {
+			cfg.Hub.Publish(realtime.UserTopic(m.UserID), realtime.TypeMessageCreated, response, nil)
+		}
+	}
+}
+
+// getMessagesHandler pages backwards through a conversation, newest first.
+// Pass the created_at and id of the last message seen as ?before= and
+// ?before_id= for the next page. Messages can share a created_at, the id
+// keeps the page boundary from skipping the rest of them.
+func (cfg *apiConfig) getMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authUserID(w, r)
+	if !ok {
+		return
+	}
+	convoID, _, ok := cfg.conversationMembers(w, r, userID)
+	if !ok {
+		return
+	}
+
+	before := time.Now().Add(time.Minute)
+	if s := r.URL.Query().Get("before"); s != "" {
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			respondJSONError(w, r, http.StatusBadRequest, "before must be an RFC3339 time", err)
+			return
+		}
+		before = t
+	}
+	// uuid.Nil sorts first, so with no id it's everything before the time
+	var beforeID uuid.UUID
+	if s := r.URL.Query().Get("before_id"); s != "" {
+		id, err := uuid.Parse(s)
+		if err != nil || r.URL.Query().Get("before") == "" {
+			respondJSONError(w, r, http.StatusBadRequest, "before_id must be a message id, with before", err)
+			return
+		}
+		beforeID = id
+	}
+	limit := defaultMessagesLimit
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxMessagesLimit {
+			respondJSONError(w, r, http.StatusBadRequest, "limit must be between 1 and 100", err)
+			return
+		}
+		limit = n
+	}
+
+	msgs, err := cfg.DB.GetMessages(r.Context(), database.GetMessagesParams{
+		ConversationID: convoID,
+		CreatedAt:      before,
+		ID:             beforeID,
+		Limit:          int32(limit),
+	})
+	if err != nil {
+		respondJSONError(w, r, http.StatusInternalServerError, "Couldn't get messages", err)
+		return
+	}
+	responses := []messageJSON{}
+	for _, msg := range msgs {
+		responses = append(responses, messageJSON{
+			ID:             msg.ID,
+			CreatedAt:      msg.CreatedAt,
+			ConversationID: msg.ConversationID,
+			SenderID:       msg.SenderID,
+			Body:           msg.Body,
+		})
+	}
+	respondJSON(w, r, http.StatusOK, responses)
+}
+
+func (cfg *apiConfig) markConversationReadHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authUserID(w, r)
+	if !ok {
+		return
+	}
+	convoID, _, ok := cfg.conversationMembers(w, r, userID)
+	if !ok {
+		return
+	}
+	if err := cfg.DB.MarkConversationRead(r.Context(), database.MarkConversationReadParams{
+		ConversationID: convoID,
+		UserID:         userID,
+	}); err != nil {
+		respondJSONError(w, r, http.StatusInternalServerError, "Couldn't mark read", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func memberIDs(members []database.ConversationMember) []uuid.UUID {
+	ids := []uuid.UUID{}
+	for _, m := range members {
+		ids = append(ids, m.UserID)
+	}
+	return ids
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/frankielb/chirpy/internal/database"
+	"github.com/frankielb/chirpy/internal/realtime"
+	"github.com/frankielb/chirpy/internal/service"
+	"github.com/frankielb/chirpy/internal/store"
+	"github.com/google/uuid"
+)
+
+// reasons a chirp can be reported for
+var reportReasons = map[string]bool{
+	"spam":           true,
+	"harassment":     true,
+	"hate":           true,
+	"violence":       true,
+	"sexual":         true,
+	"misinformation": true,
+	"other":          true,
+}
+
+// report statuses
+const (
+	reportOpen     = "open"
+	reportClaimed  = "claimed"
+	reportResolved = "resolved"
+)
+
+// what a moderator can do when resolving a report
+const (
+	actionDismiss     = "dismiss"
+	actionHideChirp   = "hide_chirp"
+	actionDeleteChirp = "delete_chirp"
+	actionWarnUser    = "warn_user"
+	actionSuspendUser = "suspend_user"
+	actionClaim       = "claim"
+	// admin actions that arent from a report
+	actionSetRole       = "set_role"
+	actionUnsuspendUser = "unsuspend_user"
+)
+
+type reportJSON struct {
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	ChirpID    uuid.UUID  `json:"chirp_id"`
+	ReporterID uuid.UUID  `json:"reporter_id"`
+	Reason     string     `json:"reason"`
+	Details    string     `json:"details"`
+	Status     string     `json:"status"`
+	ClaimedBy  *uuid.UUID `json:"claimed_by"`
+	ClaimedAt  *time.Time `json:"claimed_at"`
+	ResolvedAt *time.Time `json:"resolved_at"`
+	Resolution *string    `json:"resolution"`
+}
+
+type moderationActionJSON struct {
+	ID           uuid.UUID  `json:"id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ModeratorID  uuid.UUID  `json:"moderator_id"`
+	Action       string     `json:"action"`
+	ReportID     *uuid.UUID `json:"report_id"`
+	ChirpID      *uuid.UUID `json:"chirp_id"`
+	TargetUserID *uuid.UUID `json:"target_user_id"`
+	Note         string     `json:"note"`
+}
+
+func toReportJSON(report database.Report) reportJSON {
+	out := reportJSON{
+		ID:         report.ID,
+		CreatedAt:  report.CreatedAt,
+		UpdatedAt:  report.UpdatedAt,
+		ChirpID:    report.ChirpID,
+		ReporterID: report.ReporterID,
+		Reason:     report.Reason,
+		Details:    report.Details,
+		Status:     report.Status,
+	}
+	if report.ClaimedBy.Valid {
+		out.ClaimedBy = &report.ClaimedBy.UUID
+	}
+	if report.ClaimedAt.Valid {
+		out.ClaimedAt = &report.ClaimedAt.Time
+	}
+	if report.ResolvedAt.Valid {
+		out.ResolvedAt = &report.ResolvedAt.Time
+	}
+	if report.Resolution.Valid {
+		out.Resolution = &report.Resolution.String
+	}
+	return out
+}
+
+func (cfg *apiConfig) createReportHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authUserID(w, r)
+	if !ok {
+		return
+	}
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondJSONError(w, r, http.StatusBadRequest, "Invalid chirp ID", err)
+		return
+	}
+	type request struct {
+		Reason  string `json:"reason"`
+		Details string `json:"details"`
+	}
+	req := request{}
+	if !decodeJSON(w, r, &req, func(v *service.Validator) {
+		v.Check(reportReasons[req.Reason], "reason", "invalid", "unknown reason")
+		v.Check(len(req.Details) <= maxMessageLength, "details", "too_long", "Details are too long")
+	}) {
+		return
+	}
+
+	chirp, err := cfg.DB.GetChirp(r.Context(), chirpID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondJSONError(w, r, http.StatusNotFound, "Chirp not found", err)
+			return
+		}
+		respondJSONError(w, r, http.StatusInternalServerError, "Internal server error", err)
+		return
+	}
+	if chirp.UserID == userID {
+		respondJSONError(w, r, http.StatusBadRequest, "can't report your own chirp", nil)
+		return
+	}
+
+	report, err := cfg.DB.CreateReport(r.Context(), database.CreateReportParams{
+		ChirpID:    chirpID,
+		ReporterID: userID,
+		Reason:     req.Reason,
+		Details:    req.Details,
+	})
+	if err != nil {
+		if store.IsUniqueViolation(err) {
+			respondJSONError(w, r, http.StatusConflict, "already reported", err)
+			return
+		}
+		respondJSONError(w, r, http.StatusInternalServerError, "Couldn't create report", err)
+		return
+	}
+	respondJSON(w, r, http.StatusCreated, toReportJSON(report))
+}
+
+// getReportsHandler is the moderation queue, oldest first. ?status= picks
+// open (default), claimed or resolved.
+func (cfg *apiConfig) getReportsHandler(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = reportOpen
+	}
+	if status != reportOpen && status != reportClaimed && status != reportResolved {
+		respondJSONError(w, r, http.StatusBadRequest, "unknown status", nil)
+		return
+	}
+	reports, err := cfg.DB.GetReportsByStatus(r.Context(), status)
+	if err != nil {
+		respondJSONError(w, r, http.StatusInternalServerError, "Couldn't get reports", err)
+		return
+	}
+	responses := []reportJSON{}
+	for _, report := range reports {
+		responses = append(responses, toReportJSON(report))
+	}
+	respondJSON(w, r, http.StatusOK, responses)
+}
+
+func (cfg *apiConfig) claimReportHandler(w http.ResponseWriter, r *http.Request) {
+	mod, _ := userFromContext(r.Context())
+	reportID, err := uuid.Parse(r.PathValue("reportID"))
+	if err != nil {
+		respondJSONError(w, r, http.StatusBadRequest, "Invalid report ID", err)
+		return
+	}
+	report, err := cfg.DB.ClaimReport(r.Context(), database.ClaimReportParams{
+		ID:        reportID,
+		ClaimedBy: uuid.NullUUID{UUID: mod.ID, Valid: true},
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			cfg.reportConflict(w, r, reportID)
+			return
+		}
+		respondJSONError(w, r, http.StatusInternalServerError, "Couldn't claim report", err)
+		return
+	}
+	if _, err := cfg.DB.CreateModerationAction(r.Context(), database.CreateModerationActionParams{
+		ModeratorID: mod.ID,
+		Action:      actionClaim,
+		ReportID:    uuid.NullUUID{UUID: report.ID, Valid: true},
+		ChirpID:     uuid.NullUUID{UUID: report.ChirpID, Valid: true},
+	}); err != nil {
+		respondJSONError(w, r, http.StatusInternalServerError, "Couldn't record action", err)
+		return
+	}
+	respondJSON(w, r, http.StatusOK, toReportJSON(report))
+}
+
+// reportConflict works out why a claim or resolve matched no rows.
+func (cfg *apiConfig) reportConflict(w http.ResponseWriter, r *http.Request, reportID uuid.UUID) {
+	if _, err := cfg.DB.GetReport(r.Context(), reportID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondJSONError(w, r, http.StatusNotFound, "Report not found", err)
+			return
+		}
+		respondJSONError(w, r, http.StatusInternalServerError, "Internal server error", err)
+		return
+	}
+	respondJSONError(w, r, http.StatusConflict, "report already claimed or resolved", nil)
+}
+
+func (cfg *apiConfig) resolveReportHandler(w http.ResponseWriter, r *http.Request) {
+	mod, _ := userFromContext(r.Context())
+	reportID, err := uuid.Parse(r.PathValue("reportID"))
+	if err != nil {
+		respondJSONError(w, r, http.StatusBadRequest, "Invalid report ID", err)
+		return
+	}
+	type request struct {
+		Action string `json:"action"`
+		Note   string `json:"note"`
+		// only for suspend_user, empty means until lifted
+		SuspendUntil *time.Time `json:"suspend_until"`
+	}
+	req := request{}
+	if !decodeJSON(w, r, &req, func(v *service.Validator) {
+		switch req.Action {
+		case actionDismiss, actionHideChirp, actionDeleteChirp, actionWarnUser, actionSuspendUser:
+		default:
+			v.Check(false, "action", "invalid", "unknown action")
+		}
+	}) {
+		return
+	}
+
+	report, err := cfg.DB.GetReport(r.Context(), reportID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondJSONError(w, r, http.StatusNotFound, "Report not found", err)
+			return
+		}
+		respondJSONError(w, r, http.StatusInternalServerError, "Internal server error", err)
+		return
+	}
+	if report.Status == reportResolved {
+		respondJSONError(w, r, http.StatusConflict, "report already resolved", nil)
+		return
+	}
+	// claims aren't advisory, only whoever claimed it can resolve it
+	if report.ClaimedBy.Valid && report.ClaimedBy.UUID != mod.ID {
+		respondJSONError(w, r, http.StatusConflict, "report is claimed by another moderator", nil)
+		return
+	}
+	chirp, err := cfg.DB.GetChirp(r.Context(), report.ChirpID)
+	if err != nil {
+		respondJSONError(w, r, http.StatusInternalServerError, "Couldn't get chirp", err)
+		return
+	}
+	if req.Action == actionSuspendUser {
+		target, err := cfg.DB.GetUserByID(r.Context(), chirp.UserID)
+		if err != nil {
+			respondJSONError(w, r, http.StatusInternalServerError, "Couldn't get user", err)
+			return
+		}
+		if roleRank[target.Role] >= roleRank[mod.Role] {
+			respondJSONError(w, r, http.StatusForbidden, "can't suspend someone with your role or higher", nil)
+			return
+		}
+	}
+
+	// resolving comes first and is what claims the report, so of two at
+	// once only one gets to carry out its action. All of it or none.
+	var resolved database.Report
+	var action database.ModerationAction
+	msg := "Couldn't resolve report"
+	err = cfg.DB.InTx(r.Context(), nil, func(tx store.Store) error {
+		var err error
+		resolved, err = tx.ResolveReport(r.Context(), database.ResolveReportParams{
+			ID:         report.ID,
+			Resolution: sql.NullString{String: req.Action, Valid: true},
+			ClaimedBy:  uuid.NullUUID{UUID: mod.ID, Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+
+		msg = "Couldn't apply action"
+		switch req.Action {
+		case actionHideChirp:
+			err = tx.HideChirp(r.Context(), chirp.ID)
+		case actionSuspendUser:
+			until := sql.NullTime{}
+			if req.SuspendUntil != nil {
+				until = sql.NullTime{Time: *req.SuspendUntil, Valid: true}
+			}
+			err = tx.SuspendUser(r.Context(), database.SuspendUserParams{
+				ID:             chirp.UserID,
+				SuspendedUntil: until,
+			})
+		}
+		if err != nil {
+			return err
+		}
+
+		msg = "Couldn't record action"
+		action, err = tx.CreateModerationAction(r.Context(), database.CreateModerationActionParams{
+			ModeratorID:  mod.ID,
+			Action:       req.Action,
+			ReportID:     uuid.NullUUID{UUID: report.ID, Valid: true},
+			ChirpID:      uuid.NullUUID{UUID: chirp.ID, Valid: true},
+			TargetUserID: uuid.NullUUID{UUID: chirp.UserID, Valid: true},
+			Note:         req.Note,
+		})
+		if err != nil {
+			return err
+		}
+
+		// last, it cascades to the chirp's reports, this one included
+		if req.Action == actionDeleteChirp {
+			msg = "couldn't delete chirp"
+			return tx.DeleteChirpByID(r.Context(), chirp.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			cfg.reportConflict(w, r, reportID)
+			return
+		}
+		respondJSONError(w, r, http.StatusInternalServerError, msg, err)
+		return
+	}
+
+	// only once it's committed, a rolled back warning can't be unsent
+	if req.Action == actionWarnUser {
+		cfg.Hub.Publish(realtime.UserTopic(chirp.UserID), realtime.TypeModerationWarning, map[string]any{
+			"chirp_id": chirp.ID,
+			"reason":   report.Reason,
+			"note":     req.Note,
+		}, nil)
+	}
+	// the report went with the chirp, the audit log entry is what's left
+	if req.Action == actionDeleteChirp {
+		respondJSON(w, r, http.StatusOK, toModerationActionJSON(action))
+		return
+	}
+	respondJSON(w, r, http.StatusOK, toReportJSON(resolved))
+}
+
+// getModerationActionsHandler is the audit log, newest first.
+func (cfg *apiConfig) getModerationActionsHandler(w http.ResponseWriter, r *http.Request) {
+	limit := defaultMessagesLimit
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxMessagesLimit {
+			respondJSONError(w, r, http.StatusBadRequest, "limit must be between 1 and 100", err)
+			return
+		}
+		limit = n
+	}
+	actions, err := cfg.DB.GetModerationActions(r.Context(), int32(limit))
+	if err != nil {
+		respondJSONError(w, r, http.StatusInternalServerError, "Couldn't get actions", err)
+		return
+	}
+	responses := []moderationActionJSON{}
+	for _, a := range actions {
+		responses = append(responses, toModerationActionJSON(a))
+	}
+	respondJSON(w, r, http.StatusOK, responses)
+}
+
+func toModerationActionJSON(a database.ModerationAction) moderationActionJSON {
+	out := moderationActionJSON{
+		ID:          a.ID,
+		CreatedAt:   a.CreatedAt,
+		ModeratorID: a.ModeratorID,
+		Action:      a.Action,
+		Note:        a.Note,
+	}
+	if a.ReportID.Valid {
+		out.ReportID = &a.ReportID.UUID
+	}
+	if a.ChirpID.Valid {
+		out.ChirpID = &a.ChirpID.UUID
+	}
+	if a.TargetUserID.Valid {
+		out.TargetUserID = &a.TargetUserID.UUID
+	}
+	return out
+}
@@ -0,0 +1,454 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/frankielb/chirpy/api"
+	"github.com/frankielb/chirpy/internal/database"
+	"github.com/frankielb/chirpy/internal/httpx"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// just enough of openapi 3.1 and json schema to check our responses
+type oasDoc struct {
+	OpenAPI    string                             `json:"openapi"`
+	Paths      map[string]map[string]oasOperation `json:"paths"`
+	Components struct {
+		Schemas   map[string]*schema     `json:"schemas"`
+		Responses map[string]oasResponse `json:"responses"`
+	} `json:"components"`
+}
+
+type oasOperation struct {
+	OperationID string                 `json:"operationId"`
+	Responses   map[string]oasResponse `json:"responses"`
+}
+
+type oasResponse struct {
+	Ref     string `json:"$ref"`
+	Content map[string]struct {
+		Schema *schema `json:"schema"`
+	} `json:"content"`
+}
+
+type schema struct {
+	Ref        string             `json:"$ref"`
+	Type       any                `json:"type"`
+	Format     string             `json:"format"`
+	Enum       []any              `json:"enum"`
+	Properties map[string]*schema `json:"properties"`
+	Required   []string           `json:"required"`
+	Items      *schema            `json:"items"`
+	OneOf      []*schema          `json:"oneOf"`
+	// false, or a schema for the values
+	AdditionalProperties json.RawMessage `json:"additionalProperties"`
+}
+
+func loadSpec(t *testing.T) *oasDoc {
+	t.Helper()
+	var doc oasDoc
+	if err := json.Unmarshal(api.OpenAPI, &doc); err != nil {
+		t.Fatalf("api/openapi.json: %v", err)
+	}
+	if doc.OpenAPI != "3.1.0" {
+		t.Fatalf("openapi = %q, want 3.1.0", doc.OpenAPI)
+	}
+	return &doc
+}
+
+func (d *oasDoc) resolve(s *schema) *schema {
+	for s != nil && s.Ref != "" {
+		s = d.Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+	}
+	return s
+}
+
+func jsonType(v any) string {
+	switch n := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	case float64:
+		if n == float64(int64(n)) {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// validate returns everything about v that doesn't match s.
+func (d *oasDoc) validate(v any, s *schema, at string) []string {
+	s = d.resolve(s)
+	if s == nil {
+		return []string{at + ": unresolved schema"}
+	}
+	if len(s.OneOf) > 0 {
+		matched := 0
+		for _, alt := range s.OneOf {
+			if len(d.validate(v, alt, at)) == 0 {
+				matched++
+			}
+		}
+		if matched != 1 {
+			return []string{fmt.Sprintf("%s: matches %d of %d oneOf schemas", at, matched, len(s.OneOf))}
+		}
+		return nil
+	}
+	var types []string
+	switch ty := s.Type.(type) {
+	case string:
+		types = []string{ty}
+	case []any:
+		for _, x := range ty {
+			types = append(types, x.(string))
+		}
+	}
+	got := jsonType(v)
+	if len(types) > 0 && !slices.Contains(types, got) && !(got == "integer" && slices.Contains(types, "number")) {
+		return []string{fmt.Sprintf("%s: got %s, want %v", at, got, types)}
+	}
+	if len(s.Enum) > 0 && !slices.Contains(s.Enum, v) {
+		return []string{fmt.Sprintf("%s: %v not in %v", at, v, s.Enum)}
+	}
+	var errs []string
+	switch val := v.(type) {
+	case string:
+		switch s.Format {
+		case "uuid":
+			if _, err := uuid.Parse(val); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %q isn't a uuid", at, val))
+			}
+		case "date-time":
+			if _, err := time.Parse(time.RFC3339Nano, val); err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %q isn't a date-time", at, val))
+			}
+		}
+	case []any:
+		for i, item := range val {
+			errs = append(errs, d.validate(item, s.Items, fmt.Sprintf("%s[%d]", at, i))...)
+		}
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := val[name]; !ok {
+				errs = append(errs, fmt.Sprintf("%s: missing %q", at, name))
+			}
+		}
+		var extra *schema
+		closed := string(s.AdditionalProperties) == "false"
+		if len(s.AdditionalProperties) > 0 && !closed {
+			extra = &schema{}
+			if err := json.Unmarshal(s.AdditionalProperties, extra); err != nil {
+				return []string{at + ": bad additionalProperties"}
+			}
+		}
+		for name, field := range val {
+			switch prop, ok := s.Properties[name]; {
+			case ok:
+				errs = append(errs, d.validate(field, prop, at+"."+name)...)
+			case closed:
+				errs = append(errs, fmt.Sprintf("%s: %q isn't in the spec", at, name))
+			case extra != nil:
+				errs = append(errs, d.validate(field, extra, at+"."+name)...)
+			}
+		}
+	}
+	return errs
+}
+
+// opKey is how an operation is named in failures, eg "GET /api/chirps".
+func opKey(pattern, method string) (string, string) {
+	m, path, ok := strings.Cut(pattern, " ")
+	if !ok {
+		// patterns like /app/ take any method
+		return method, pattern
+	}
+	return m, path
+}
+
+// contract checks every response the wrapped mux sends against the spec
+// and remembers which operations have had a successful response.
+type contract struct {
+	t   *testing.T
+	doc *oasDoc
+
+	mu      sync.Mutex
+	covered map[string]bool
+}
+
+type captureWriter struct {
+	*httpx.StatusRecorder
+	body bytes.Buffer
+}
+
+func (w *captureWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.StatusRecorder.Write(b)
+}
+
+func (c *contract) wrap(mux http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &captureWriter{StatusRecorder: httpx.NewStatusRecorder(w)}
+		mux.ServeHTTP(rec, r)
+		if r.Pattern == "" {
+			return
+		}
+		method, path := opKey(r.Pattern, r.Method)
+		key := method + " " + path
+		if err := c.check(method, path, rec.Status, rec.Header().Get("Content-Type"), rec.body.Bytes()); err != "" {
+			c.t.Errorf("%s %s: %s", key, r.URL, err)
+			return
+		}
+		if rec.Status < 300 {
+			c.mu.Lock()
+			c.covered[key] = true
+			c.mu.Unlock()
+		}
+	})
+}
+
+func (c *contract) check(method, path string, status int, contentType string, body []byte) string {
+	op, ok := c.doc.Paths[path][strings.ToLower(method)]
+	if !ok {
+		return "operation isn't in the spec"
+	}
+	resp, ok := op.Responses[strconv.Itoa(status)]
+	if !ok && status >= 400 {
+		resp, ok = op.Responses["default"]
+	}
+	if !ok {
+		return fmt.Sprintf("status %d isn't in the spec", status)
+	}
+	if resp.Ref != "" {
+		resp = c.doc.Components.Responses[strings.TrimPrefix(resp.Ref, "#/components/responses/")]
+	}
+	if len(resp.Content) == 0 {
+		if len(body) > 0 {
+			return fmt.Sprintf("status %d should have no body", status)
+		}
+		return ""
+	}
+	mt, _, _ := mime.ParseMediaType(contentType)
+	media, ok := resp.Content[mt]
+	if !ok {
+		media, ok = resp.Content["*/*"]
+	}
+	if !ok {
+		return fmt.Sprintf("content type %q isn't in the spec for %d", contentType, status)
+	}
+	if mt != "application/json" && !strings.HasSuffix(mt, "+json") {
+		return ""
+	}
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return fmt.Sprintf("body isn't json: %v", err)
+	}
+	if errs := c.doc.validate(v, media.Schema, "body"); len(errs) > 0 {
+		return strings.Join(errs, "; ")
+	}
+	return ""
+}
+
+func TestOpenAPIRoutes(t *testing.T) {
+	doc := loadSpec(t)
+	_, cfg := newTestServer(t)
+
+	registered := map[string]bool{}
+	for _, pattern := range cfg.routes().patterns {
+		method, path := opKey(pattern, http.MethodGet)
+		registered[method+" "+path] = true
+		if _, ok := doc.Paths[path][strings.ToLower(method)]; !ok {
+			t.Errorf("%s is registered but not in api/openapi.json", pattern)
+		}
+	}
+	for path, ops := range doc.Paths {
+		for method := range ops {
+			if key := strings.ToUpper(method) + " " + path; !registered[key] {
+				t.Errorf("%s is in api/openapi.json but not registered", key)
+			}
+		}
+	}
+
+	// every $ref points somewhere
+	var raw any
+	json.Unmarshal(api.OpenAPI, &raw)
+	var refs func(v any)
+	refs = func(v any) {
+		switch val := v.(type) {
+		case map[string]any:
+			if ref, ok := val["$ref"].(string); ok && !resolves(raw, ref) {
+				t.Errorf("dangling $ref %s", ref)
+			}
+			for _, x := range val {
+				refs(x)
+			}
+		case []any:
+			for _, x := range val {
+				refs(x)
+			}
+		}
+	}
+	refs(raw)
+}
+
+// resolves follows a local "#/a/b" ref through the decoded document.
+func resolves(doc any, ref string) bool {
+	path, ok := strings.CutPrefix(ref, "#/")
+	if !ok {
+		return false
+	}
+	for _, part := range strings.Split(path, "/") {
+		m, ok := doc.(map[string]any)
+		if !ok {
+			return false
+		}
+		if doc, ok = m[part]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func TestOpenAPIContract(t *testing.T) {
+	doc := loadSpec(t)
+	_, cfg := newTestServer(t)
+	c := &contract{t: t, doc: doc, covered: map[string]bool{}}
+	srv := httptest.NewServer(c.wrap(cfg.routes()))
+	defer srv.Close()
+
+	// send fires a request, the contract wrapper does the checking
+	send := func(method, path, auth string, body any) []byte {
+		t.Helper()
+		var buf bytes.Buffer
+		if body != nil {
+			json.NewEncoder(&buf).Encode(body)
+		}
+		req, err := http.NewRequest(method, srv.URL+path, &buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var out bytes.Buffer
+		out.ReadFrom(resp.Body)
+		return out.Bytes()
+	}
+	decode := func(b []byte, out any) {
+		t.Helper()
+		if err := json.Unmarshal(b, out); err != nil {
+			t.Fatalf("decoding %s: %v", b, err)
+		}
+	}
+	bearer := func(tok string) string { return "Bearer " + tok }
+
+	for _, path := range []string{"/app/", "/api/healthz", "/api/livez", "/api/readyz", "/metrics", "/api/openapi.json"} {
+		send("GET", path, "", nil)
+	}
+
+	creds := map[string]string{"email": "alice@example.com", "password": "hunter2"}
+	var alice, bob, admin loginResult
+	for _, u := range []struct {
+		email string
+		out   *loginResult
+	}{{"alice@example.com", &alice}, {"bob@example.com", &bob}, {"admin@example.com", &admin}} {
+		creds := map[string]string{"email": u.email, "password": "hunter2"}
+		send("POST", "/api/users", "", creds)
+		decode(send("POST", "/api/login", "", creds), u.out)
+	}
+	if err := cfg.DB.SetUserRole(context.Background(), database.SetUserRoleParams{ID: admin.ID, Role: roleAdmin}); err != nil {
+		t.Fatal(err)
+	}
+	// the error shapes are checked too
+	send("POST", "/api/users", "", creds)
+	send("POST", "/api/login", "", map[string]string{"email": "alice@example.com", "password": "nope"})
+	send("POST", "/api/chirps", bearer(alice.Token), map[string]string{"body": ""})
+
+	creds["password"] = "hunter3"
+	send("PUT", "/api/users", bearer(alice.Token), creds)
+	send("POST", "/api/refresh", bearer(alice.RefreshToken), nil)
+
+	var chirp chirpJSON
+	decode(send("POST", "/api/chirps", bearer(alice.Token), map[string]string{"body": "hello"}), &chirp)
+	send("GET", "/api/chirps?sort=desc", bearer(bob.Token), nil)
+	send("GET", "/api/chirps/"+chirp.Id, "", nil)
+	send("GET", "/api/chirps/"+uuid.NewString(), "", nil)
+
+	var convo conversationJSON
+	decode(send("POST", "/api/conversations", bearer(alice.Token), map[string]any{"member_ids": []uuid.UUID{bob.ID}}), &convo)
+	send("POST", "/api/conversations", bearer(alice.Token), map[string]any{"member_ids": []uuid.UUID{bob.ID}})
+	send("GET", "/api/conversations", bearer(bob.Token), nil)
+	convoPath := "/api/conversations/" + convo.ID.String()
+	send("POST", convoPath+"/messages", bearer(bob.Token), map[string]string{"body": "hi alice"})
+	send("GET", convoPath+"/messages?limit=10", bearer(alice.Token), nil)
+	send("POST", convoPath+"/read", bearer(alice.Token), nil)
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/api/ws?token="+alice.Token, nil)
+	if err != nil {
+		t.Fatalf("websocket: %v", err)
+	}
+	ws.Close()
+
+	var report reportJSON
+	decode(send("POST", "/api/chirps/"+chirp.Id+"/reports", bearer(bob.Token), map[string]string{"reason": "spam"}), &report)
+	send("GET", "/admin/reports", bearer(admin.Token), nil)
+	send("GET", "/admin/reports", bearer(bob.Token), nil)
+	send("POST", "/admin/reports/"+report.ID.String()+"/claim", bearer(admin.Token), nil)
+	send("POST", "/admin/reports/"+report.ID.String()+"/resolve", bearer(admin.Token), map[string]string{"action": "dismiss", "note": "fine"})
+	var spam chirpJSON
+	decode(send("POST", "/api/chirps", bearer(alice.Token), map[string]string{"body": "buy now"}), &spam)
+	decode(send("POST", "/api/chirps/"+spam.Id+"/reports", bearer(bob.Token), map[string]string{"reason": "spam"}), &report)
+	send("POST", "/admin/reports/"+report.ID.String()+"/resolve", bearer(admin.Token), map[string]string{"action": "delete_chirp"})
+	send("GET", "/admin/moderation/actions?limit=5", bearer(admin.Token), nil)
+
+	bobAdmin := "/admin/users/" + bob.ID.String()
+	send("PUT", bobAdmin+"/role", bearer(admin.Token), map[string]string{"role": roleModerator})
+	send("POST", bobAdmin+"/suspend", bearer(admin.Token), map[string]string{"note": "cool off"})
+	send("DELETE", bobAdmin+"/suspend", bearer(admin.Token), nil)
+
+	for _, verb := range []string{"block", "mute"} {
+		send("POST", "/api/users/"+bob.ID.String()+"/"+verb, bearer(alice.Token), nil)
+		send("DELETE", "/api/users/"+bob.ID.String()+"/"+verb, bearer(alice.Token), nil)
+	}
+
+	send("POST", "/api/polka/webhooks", "ApiKey "+cfg.PolkaKey, map[string]any{"event": "user.upgraded", "data": map[string]any{"user_id": alice.ID}})
+	send("DELETE", "/api/chirps/"+chirp.Id, bearer(alice.Token), nil)
+	send("POST", "/api/revoke", bearer(alice.RefreshToken), nil)
+	send("GET", "/admin/metrics", bearer(admin.Token), nil)
+	send("POST", "/admin/reset", bearer(admin.Token), nil)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for path, ops := range doc.Paths {
+		for method := range ops {
+			if key := strings.ToUpper(method) + " " + path; !c.covered[key] {
+				t.Errorf("%s never got a successful response, add it to the test", key)
+			}
+		}
+	}
+}
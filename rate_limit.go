@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/frankielb/chirpy/internal/auth"
+	"github.com/frankielb/chirpy/internal/database"
+	"github.com/frankielb/chirpy/internal/ratelimit"
+	"github.com/frankielb/chirpy/internal/store"
+	"github.com/frankielb/chirpy/internal/tracing"
+	"github.com/google/uuid"
+)
+
+// middlewareRateLimit limits a route by its policy, per user for a good jwt,
+// per api key, otherwise per ip. Routes without a policy are left alone.
+func (cfg *apiConfig) middlewareRateLimit(pattern string, next http.Handler) http.Handler {
+	if cfg.Limiter == nil {
+		return next
+	}
+	policy, ok := cfg.Limiter.Policy(pattern)
+	if !ok {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, red := cfg.rateLimitPrincipal(r)
+		p := policy
+		if red {
+			p = p.Scale(cfg.RateLimitRedFactor)
+		}
+		res, err := cfg.Limiter.Take(r.Context(), pattern+" "+principal, p)
+		if err != nil {
+			// better to let people in than take the api down with the db
+			slog.ErrorContext(r.Context(), "rate limit", "err", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+		h := w.Header()
+		h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+		h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		h.Set("RateLimit-Reset", ceilSeconds(res.Reset))
+		h.Set("RateLimit-Policy", strconv.Itoa(p.Limit)+";w="+ceilSeconds(p.Period)+";burst="+strconv.Itoa(p.Burst))
+		if !res.Allowed {
+			h.Set("Retry-After", ceilSeconds(max(res.RetryAfter, time.Second)))
+			respondJSONError(w, r, http.StatusTooManyRequests, "rate limit exceeded, try again later", nil)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimitPrincipal is who a request counts against. A bad token falls
+// through to the ip rather than getting its own bucket per token.
+func (cfg *apiConfig) rateLimitPrincipal(r *http.Request) (principal string, red bool) {
+	if userID, ok := cfg.tokenUserID(r); ok {
+		// only worth a lookup if red users get something different
+		if cfg.RateLimitRedFactor != 1 {
+			red = cfg.isRed(r.Context(), userID)
+		}
+		return "user:" + userID.String(), red
+	}
+	if key, err := auth.GetAPIKey(r.Header); err == nil {
+		// keep keys themselves out of the bucket table
+		sum := sha256.Sum256([]byte(key))
+		return "key:" + hex.EncodeToString(sum[:8]), false
+	}
+	return "ip:" + cfg.clientIP(r), false
+}
+
+// isRed looks the user up at most once per redTTL. A failed lookup counts
+// as not red and isn't cached.
+func (cfg *apiConfig) isRed(ctx context.Context, userID uuid.UUID) bool {
+	if red, ok := cfg.redUsers.get(userID); ok {
+		return red
+	}
+	user, err := cfg.DB.GetUserByID(ctx, userID)
+	if err != nil {
+		return false
+	}
+	cfg.redUsers.put(userID, user.IsChirpyRed)
+	return user.IsChirpyRed
+}
+
+// redTTL is how long a user's red flag is trusted for rate limiting, so
+// an upgrade from the cli can take this long to lift their limits.
+const redTTL = time.Minute
+
+// past this many users put starts dropping expired entries
+const redCacheSize = 10000
+
+// redCache saves a user lookup on every rate limited request. The zero
+// value is ready to use.
+type redCache struct {
+	mu    sync.Mutex
+	users map[uuid.UUID]redEntry
+}
+
+type redEntry struct {
+	red     bool
+	expires time.Time
+}
+
+func (c *redCache) get(id uuid.UUID) (red, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.users[id]
+	if !ok || time.Now().After(e.expires) {
+		return false, false
+	}
+	return e.red, true
+}
+
+func (c *redCache) put(id uuid.UUID, red bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if c.users == nil {
+		c.users = map[uuid.UUID]redEntry{}
+	}
+	if len(c.users) >= redCacheSize {
+		for k, e := range c.users {
+			if now.After(e.expires) {
+				delete(c.users, k)
+			}
+		}
+		// all still fresh, start over rather than grow without bound
+		if len(c.users) >= redCacheSize {
+			clear(c.users)
+		}
+	}
+	c.users[id] = redEntry{red: red, expires: now.Add(redTTL)}
+}
+
+// forget drops a user whose red flag just changed.
+func (c *redCache) forget(id uuid.UUID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.users, id)
+}
+
+// clientIP is the remote address, or with TrustProxy the last hop in
+// X-Forwarded-For, which is the one our proxy added.
+func (cfg *apiConfig) clientIP(r *http.Request) string {
+	if cfg.TrustProxy {
+		if fwd := r.Header.Values("X-Forwarded-For"); len(fwd) > 0 {
+			hops := strings.Split(fwd[len(fwd)-1], ",")
+			if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// sweepRateLimits deletes postgres buckets nobody has touched for long
+// enough that they'd be full, until ctx is done.
+func sweepRateLimits(ctx context.Context, pg *ratelimit.Postgres, keep time.Duration) {
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := pg.Sweep(ctx, time.Now().Add(-keep)); err != nil {
+				slog.Error("sweeping rate limits", "err", err)
+			}
+		}
+	}
+}
+
+// setupRateLimits makes the limiter RateLimitBackend asks for. The postgres
+// backend is returned too so serve can sweep it.
+func (cfg *apiConfig) setupRateLimits(conn *sql.DB) (*ratelimit.Postgres, error) {
+	policies, err := cfg.RateLimitPolicies()
+	if err != nil {
+		return nil, err
+	}
+	switch cfg.RateLimitBackend {
+	case "off":
+		return nil, nil
+	case "postgres":
+		if driver, _ := store.Driver(cfg.DBURL); driver != store.DriverPostgres {
+			return nil, errors.New("rate_limit_backend postgres needs a postgres DB_URL")
+		}
+		pg := ratelimit.NewPostgres(database.New(tracing.WrapDB(conn, "postgresql")))
+		cfg.Limiter = ratelimit.New(pg, policies)
+		return pg, nil
+	}
+	cfg.Limiter = ratelimit.New(ratelimit.NewMemory(), policies)
+	return nil, nil
+}
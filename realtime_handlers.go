@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/frankielb/chirpy/internal/auth"
+	"github.com/frankielb/chirpy/internal/logging"
+	"github.com/frankielb/chirpy/internal/realtime"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+func (cfg *apiConfig) realtimeHandler(w http.ResponseWriter, r *http.Request) {
+	// auth, browsers cant set headers on a websocket so allow ?token= too
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		token = r.URL.Query().Get("token")
+	}
+	if token == "" {
+		respondJSONError(w, r, http.StatusUnauthorized, "unauthorized: no token", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.Secret)
+	if err != nil {
+		respondJSONError(w, r, http.StatusUnauthorized, "unauthorized: bad token", err)
+		return
+	}
+	logging.SetUserID(r.Context(), userID)
+	if !cfg.Hub.CanRegister(userID) {
+		respondJSONError(w, r, http.StatusTooManyRequests, "too many connections", nil)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// upgrader already wrote the error response
+		return
+	}
+	client := realtime.NewClient(cfg.Hub, conn, userID)
+	if err := cfg.Hub.Register(client); err != nil {
+		conn.WriteMessage(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.ClosePolicyViolation, err.Error()))
+		conn.Close()
+		return
+	}
+	// own notifications are always on
+	cfg.Hub.Subscribe(client, realtime.UserTopic(userID))
+	client.Run()
+}
+
+// publishChirp tells the author's and hashtag subscribers about a chirp,
+// skipping anyone who has blocked or muted the author or is blocked by them.
+func (cfg *apiConfig) publishChirp(ctx context.Context, msgType string, chirp chirpJSON) {
+	authorID, err := uuid.Parse(chirp.UserID)
+	if err != nil {
+		return
+	}
+	hidden, err := cfg.DB.GetUsersHidingAuthor(ctx, authorID)
+	if err != nil {
+		logging.FromContext(ctx).Error("getting blocks for realtime", "err", err)
+		return
+	}
+	skip := map[uuid.UUID]bool{}
+	for _, id := range hidden {
+		skip[id] = true
+	}
+	cfg.Hub.Publish(realtime.AuthorTopic(authorID), msgType, chirp, skip)
+	for _, tag := range realtime.Hashtags(chirp.Body) {
+		cfg.Hub.Publish(realtime.HashtagTopic(tag), msgType, chirp, skip)
+	}
+}
@@ -0,0 +1,13 @@
+// Package sql embeds the goose migrations so the binary can run them itself.
+package sql
+
+import "embed"
+
+// Postgres holds sql/schema and SQLite holds sql/sqlite/schema.
+var (
+	//go:embed schema/*.sql
+	Postgres embed.FS
+
+	//go:embed sqlite/schema/*.sql
+	SQLite embed.FS
+)
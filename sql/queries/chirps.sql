@@ -10,9 +10,73 @@ VALUES (
 RETURNING *;
 
 -- name: GetChirps :many
+-- viewer_id hides chirps from users blocked either way or muted by the
+-- viewer, pass uuid.Nil for anonymous requests
 SELECT * FROM chirps
+WHERE hidden_at IS NULL
+AND NOT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (user_blocks.blocker_id = sqlc.arg(viewer_id) AND user_blocks.blocked_id = chirps.user_id)
+    OR (user_blocks.blocker_id = chirps.user_id AND user_blocks.blocked_id = sqlc.arg(viewer_id))
+)
+AND NOT EXISTS (
+    SELECT 1 FROM user_mutes
+    WHERE user_mutes.muter_id = sqlc.arg(viewer_id) AND user_mutes.muted_id = chirps.user_id
+)
 ORDER BY created_at ASC;
 
+-- name: GetChirpsPage :many
+-- the page of GetChirps after the chirp at created_at and id,
+-- so a listing can be read a bit at a time
+SELECT * FROM chirps
+WHERE hidden_at IS NULL
+AND (created_at > sqlc.arg(created_at) OR (created_at = sqlc.arg(created_at) AND id > sqlc.arg(id)))
+AND NOT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (user_blocks.blocker_id = sqlc.arg(viewer_id) AND user_blocks.blocked_id = chirps.user_id)
+    OR (user_blocks.blocker_id = chirps.user_id AND user_blocks.blocked_id = sqlc.arg(viewer_id))
+)
+AND NOT EXISTS (
+    SELECT 1 FROM user_mutes
+    WHERE user_mutes.muter_id = sqlc.arg(viewer_id) AND user_mutes.muted_id = chirps.user_id
+)
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg(limit);
+
+-- name: GetChirpsPageDesc :many
+-- newest first, otherwise GetChirpsPage
+SELECT * FROM chirps
+WHERE hidden_at IS NULL
+AND (created_at < sqlc.arg(created_at) OR (created_at = sqlc.arg(created_at) AND id < sqlc.arg(id)))
+AND NOT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (user_blocks.blocker_id = sqlc.arg(viewer_id) AND user_blocks.blocked_id = chirps.user_id)
+    OR (user_blocks.blocker_id = chirps.user_id AND user_blocks.blocked_id = sqlc.arg(viewer_id))
+)
+AND NOT EXISTS (
+    SELECT 1 FROM user_mutes
+    WHERE user_mutes.muter_id = sqlc.arg(viewer_id) AND user_mutes.muted_id = chirps.user_id
+)
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(limit);
+
+-- name: GetChirpsVersion :one
+-- how many chirps GetChirps has and a digest of which ones at which
+-- version, enough to version the listing without reading it
+SELECT COUNT(*) AS total,
+    md5(COALESCE(string_agg(id::text || ' ' || updated_at::text, ',' ORDER BY id), '')) AS digest
+FROM chirps
+WHERE hidden_at IS NULL
+AND NOT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (user_blocks.blocker_id = sqlc.arg(viewer_id) AND user_blocks.blocked_id = chirps.user_id)
+    OR (user_blocks.blocker_id = chirps.user_id AND user_blocks.blocked_id = sqlc.arg(viewer_id))
+)
+AND NOT EXISTS (
+    SELECT 1 FROM user_mutes
+    WHERE user_mutes.muter_id = sqlc.arg(viewer_id) AND user_mutes.muted_id = chirps.user_id
+);
+
 -- name: GetChirp :one
 SELECT * FROM chirps
 WHERE id = $1;
@@ -21,7 +85,84 @@ WHERE id = $1;
 DELETE FROM chirps
 WHERE id = $1;
 
+-- name: DeleteChirpIfUnchanged :execrows
+-- only while the user's chirp is still the version they saw, no rows
+-- means it's changed or gone
+DELETE FROM chirps
+WHERE id = $1 AND user_id = $2 AND updated_at = $3;
+
 -- name: GetChirpsByUser :many
 SELECT * FROM chirps
-WHERE user_id = $1
-ORDER BY created_at ASC;
\ No newline at end of file
+WHERE user_id = sqlc.arg(user_id)
+AND hidden_at IS NULL
+AND NOT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (user_blocks.blocker_id = sqlc.arg(viewer_id) AND user_blocks.blocked_id = chirps.user_id)
+    OR (user_blocks.blocker_id = chirps.user_id AND user_blocks.blocked_id = sqlc.arg(viewer_id))
+)
+AND NOT EXISTS (
+    SELECT 1 FROM user_mutes
+    WHERE user_mutes.muter_id = sqlc.arg(viewer_id) AND user_mutes.muted_id = chirps.user_id
+)
+ORDER BY created_at ASC;
+
+-- name: GetChirpsByUserPage :many
+-- the page of GetChirpsByUser after the chirp at created_at and id,
+-- so a listing can be read a bit at a time
+SELECT * FROM chirps
+WHERE user_id = sqlc.arg(user_id)
+AND hidden_at IS NULL
+AND (created_at > sqlc.arg(created_at) OR (created_at = sqlc.arg(created_at) AND id > sqlc.arg(id)))
+AND NOT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (user_blocks.blocker_id = sqlc.arg(viewer_id) AND user_blocks.blocked_id = chirps.user_id)
+    OR (user_blocks.blocker_id = chirps.user_id AND user_blocks.blocked_id = sqlc.arg(viewer_id))
+)
+AND NOT EXISTS (
+    SELECT 1 FROM user_mutes
+    WHERE user_mutes.muter_id = sqlc.arg(viewer_id) AND user_mutes.muted_id = chirps.user_id
+)
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg(limit);
+
+-- name: GetChirpsByUserPageDesc :many
+-- newest first, otherwise GetChirpsByUserPage
+SELECT * FROM chirps
+WHERE user_id = sqlc.arg(user_id)
+AND hidden_at IS NULL
+AND (created_at < sqlc.arg(created_at) OR (created_at = sqlc.arg(created_at) AND id < sqlc.arg(id)))
+AND NOT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (user_blocks.blocker_id = sqlc.arg(viewer_id) AND user_blocks.blocked_id = chirps.user_id)
+    OR (user_blocks.blocker_id = chirps.user_id AND user_blocks.blocked_id = sqlc.arg(viewer_id))
+)
+AND NOT EXISTS (
+    SELECT 1 FROM user_mutes
+    WHERE user_mutes.muter_id = sqlc.arg(viewer_id) AND user_mutes.muted_id = chirps.user_id
+)
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(limit);
+
+-- name: GetChirpsByUserVersion :one
+-- how many chirps GetChirpsByUser has and a digest of which ones at which
+-- version, enough to version the listing without reading it
+SELECT COUNT(*) AS total,
+    md5(COALESCE(string_agg(id::text || ' ' || updated_at::text, ',' ORDER BY id), '')) AS digest
+FROM chirps
+WHERE user_id = sqlc.arg(user_id)
+AND hidden_at IS NULL
+AND NOT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (user_blocks.blocker_id = sqlc.arg(viewer_id) AND user_blocks.blocked_id = chirps.user_id)
+    OR (user_blocks.blocker_id = chirps.user_id AND user_blocks.blocked_id = sqlc.arg(viewer_id))
+)
+AND NOT EXISTS (
+    SELECT 1 FROM user_mutes
+    WHERE user_mutes.muter_id = sqlc.arg(viewer_id) AND user_mutes.muted_id = chirps.user_id
+);
+
+-- name: HideChirp :exec
+UPDATE chirps
+SET hidden_at = NOW(),
+updated_at = NOW()
+WHERE id = $1;
\ No newline at end of file
@@ -0,0 +1,22 @@
+-- name: TakeRateLimitToken :one
+-- refills the bucket then takes a token, no row comes back if there
+-- wasn't a whole token to take
+INSERT INTO rate_limits (key, tokens, updated_at)
+VALUES (
+    sqlc.arg(key),
+    sqlc.arg(burst)::float8 - 1,
+    sqlc.arg(now)
+)
+ON CONFLICT (key) DO UPDATE SET
+    tokens = LEAST(sqlc.arg(burst)::float8, rate_limits.tokens + GREATEST(0, EXTRACT(EPOCH FROM (sqlc.arg(now) - rate_limits.updated_at))::float8) * sqlc.arg(rate)::float8) - 1,
+    updated_at = sqlc.arg(now)
+WHERE LEAST(sqlc.arg(burst)::float8, rate_limits.tokens + GREATEST(0, EXTRACT(EPOCH FROM (sqlc.arg(now) - rate_limits.updated_at))::float8) * sqlc.arg(rate)::float8) >= 1
+RETURNING tokens;
+
+-- name: GetRateLimit :one
+SELECT * FROM rate_limits
+WHERE key = $1;
+
+-- name: DeleteRateLimitsBefore :exec
+DELETE FROM rate_limits
+WHERE updated_at < $1;
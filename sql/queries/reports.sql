@@ -0,0 +1,62 @@
+-- name: CreateReport :one
+INSERT INTO reports (id,created_at,updated_at,chirp_id,reporter_id,reason,details,status)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    'open'
+)
+RETURNING *;
+
+-- name: GetReport :one
+SELECT * FROM reports
+WHERE id = $1;
+
+-- name: GetReportsByStatus :many
+SELECT * FROM reports
+WHERE status = $1
+ORDER BY created_at ASC;
+
+-- name: ClaimReport :one
+UPDATE reports
+SET status = 'claimed',
+claimed_by = $2,
+claimed_at = NOW(),
+updated_at = NOW()
+WHERE id = $1
+AND (status = 'open' OR (status = 'claimed' AND claimed_by = $2))
+RETURNING *;
+
+-- name: ResolveReport :one
+UPDATE reports
+SET status = 'resolved',
+resolution = $2,
+resolved_at = NOW(),
+updated_at = NOW()
+WHERE id = $1
+AND status <> 'resolved'
+AND (claimed_by IS NULL OR claimed_by = $3)
+RETURNING *;
+
+-- name: CreateModerationAction :one
+INSERT INTO moderation_actions (id,created_at,moderator_id,action,report_id,chirp_id,target_user_id,note)
+VALUES (
+    gen_random_uuid(),
+    NOW(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6
+)
+RETURNING *;
+
+-- name: GetModerationActions :many
+SELECT * FROM moderation_actions
+ORDER BY created_at DESC
+LIMIT $1;
\ No newline at end of file
@@ -26,4 +26,38 @@ WHERE id = $3;
 UPDATE users
 SET is_chirpy_red = TRUE,
 updated_at = NOW()
+WHERE id = $1;
+
+-- name: GetUserByID :one
+SELECT * FROM users
+WHERE id = $1;
+
+-- name: SuspendUser :exec
+UPDATE users
+SET suspended_at = NOW(),
+suspended_until = $2,
+updated_at = NOW()
+WHERE id = $1;
+
+-- name: UnsuspendUser :exec
+UPDATE users
+SET suspended_at = NULL,
+suspended_until = NULL,
+updated_at = NOW()
+WHERE id = $1;
+
+-- name: SetUserRole :exec
+UPDATE users
+SET role = $2,
+updated_at = NOW()
+WHERE id = $1;
+
+-- name: ListUsers :many
+SELECT * FROM users
+ORDER BY created_at ASC;
+
+-- name: DowngradeRedByID :exec
+UPDATE users
+SET is_chirpy_red = FALSE,
+updated_at = NOW()
 WHERE id = $1;
\ No newline at end of file
@@ -0,0 +1,9 @@
+-- +goose Up
+-- the rest of the saved response's headers, as a json object of lists like
+-- http.Header
+ALTER TABLE idempotency_keys
+ADD COLUMN headers TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE idempotency_keys
+DROP COLUMN headers;
\ No newline at end of file
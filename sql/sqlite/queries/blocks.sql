@@ -0,0 +1,41 @@
+-- name: BlockUser :exec
+INSERT INTO user_blocks (blocker_id,blocked_id,created_at)
+VALUES (
+    ?1,
+    ?2,
+    ?3
+)
+ON CONFLICT DO NOTHING;
+
+-- name: UnblockUser :exec
+DELETE FROM user_blocks
+WHERE blocker_id = ?1
+AND blocked_id = ?2;
+
+-- name: MuteUser :exec
+INSERT INTO user_mutes (muter_id,muted_id,created_at)
+VALUES (
+    ?1,
+    ?2,
+    ?3
+)
+ON CONFLICT DO NOTHING;
+
+-- name: UnmuteUser :exec
+DELETE FROM user_mutes
+WHERE muter_id = ?1
+AND muted_id = ?2;
+
+-- name: IsBlockedEitherWay :one
+SELECT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (blocker_id = ?1 AND blocked_id = ?2)
+    OR (blocker_id = ?2 AND blocked_id = ?1)
+) AS blocked;
+
+-- name: GetUsersHidingAuthor :many
+SELECT blocked_id AS user_id FROM user_blocks WHERE user_blocks.blocker_id = ?1
+UNION
+SELECT blocker_id AS user_id FROM user_blocks WHERE user_blocks.blocked_id = ?1
+UNION
+SELECT muter_id AS user_id FROM user_mutes WHERE user_mutes.muted_id = ?1;
\ No newline at end of file
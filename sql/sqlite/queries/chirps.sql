@@ -0,0 +1,168 @@
+-- name: CreateChirp :one
+INSERT INTO chirps (id,created_at,updated_at,body,user_id)
+VALUES (
+    ?1,
+    ?2,
+    ?2,
+    ?3,
+    ?4
+)
+RETURNING *;
+
+-- name: GetChirps :many
+SELECT * FROM chirps
+WHERE hidden_at IS NULL
+AND NOT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (user_blocks.blocker_id = ?1 AND user_blocks.blocked_id = chirps.user_id)
+    OR (user_blocks.blocker_id = chirps.user_id AND user_blocks.blocked_id = ?1)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM user_mutes
+    WHERE user_mutes.muter_id = ?1 AND user_mutes.muted_id = chirps.user_id
+)
+ORDER BY created_at ASC;
+
+-- name: GetChirpsPage :many
+-- the page of GetChirps after the chirp at created_at and id,
+-- so a listing can be read a bit at a time
+SELECT * FROM chirps
+WHERE hidden_at IS NULL
+AND (created_at > ?1 OR (created_at = ?1 AND id > ?2))
+AND NOT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (user_blocks.blocker_id = ?3 AND user_blocks.blocked_id = chirps.user_id)
+    OR (user_blocks.blocker_id = chirps.user_id AND user_blocks.blocked_id = ?3)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM user_mutes
+    WHERE user_mutes.muter_id = ?3 AND user_mutes.muted_id = chirps.user_id
+)
+ORDER BY created_at ASC, id ASC
+LIMIT ?4;
+
+-- name: GetChirpsPageDesc :many
+-- newest first, otherwise GetChirpsPage
+SELECT * FROM chirps
+WHERE hidden_at IS NULL
+AND (created_at < ?1 OR (created_at = ?1 AND id < ?2))
+AND NOT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (user_blocks.blocker_id = ?3 AND user_blocks.blocked_id = chirps.user_id)
+    OR (user_blocks.blocker_id = chirps.user_id AND user_blocks.blocked_id = ?3)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM user_mutes
+    WHERE user_mutes.muter_id = ?3 AND user_mutes.muted_id = chirps.user_id
+)
+ORDER BY created_at DESC, id DESC
+LIMIT ?4;
+
+-- name: GetChirpsVersion :one
+-- how many chirps GetChirps has and a digest of which ones at which
+-- version, enough to version the listing without reading it
+-- sqlite has no hash function, so its digest is the list itself
+SELECT COUNT(*) AS total,
+    COALESCE(group_concat(id || ' ' || updated_at, ',' ORDER BY id), '') AS digest
+FROM chirps
+WHERE hidden_at IS NULL
+AND NOT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (user_blocks.blocker_id = ?1 AND user_blocks.blocked_id = chirps.user_id)
+    OR (user_blocks.blocker_id = chirps.user_id AND user_blocks.blocked_id = ?1)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM user_mutes
+    WHERE user_mutes.muter_id = ?1 AND user_mutes.muted_id = chirps.user_id
+);
+
+-- name: GetChirp :one
+SELECT * FROM chirps
+WHERE id = ?1;
+
+-- name: DeleteChirpByID :exec
+DELETE FROM chirps
+WHERE id = ?1;
+
+-- name: DeleteChirpIfUnchanged :execrows
+-- only while the user's chirp is still the version they saw, no rows
+-- means it's changed or gone
+DELETE FROM chirps
+WHERE id = ?1 AND user_id = ?2 AND updated_at = ?3;
+
+-- name: GetChirpsByUser :many
+SELECT * FROM chirps
+WHERE user_id = ?1
+AND hidden_at IS NULL
+AND NOT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (user_blocks.blocker_id = ?2 AND user_blocks.blocked_id = chirps.user_id)
+    OR (user_blocks.blocker_id = chirps.user_id AND user_blocks.blocked_id = ?2)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM user_mutes
+    WHERE user_mutes.muter_id = ?2 AND user_mutes.muted_id = chirps.user_id
+)
+ORDER BY created_at ASC;
+
+-- name: GetChirpsByUserPage :many
+-- the page of GetChirpsByUser after the chirp at created_at and id,
+-- so a listing can be read a bit at a time
+SELECT * FROM chirps
+WHERE user_id = ?1
+AND hidden_at IS NULL
+AND (created_at > ?2 OR (created_at = ?2 AND id > ?3))
+AND NOT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (user_blocks.blocker_id = ?4 AND user_blocks.blocked_id = chirps.user_id)
+    OR (user_blocks.blocker_id = chirps.user_id AND user_blocks.blocked_id = ?4)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM user_mutes
+    WHERE user_mutes.muter_id = ?4 AND user_mutes.muted_id = chirps.user_id
+)
+ORDER BY created_at ASC, id ASC
+LIMIT ?5;
+
+-- name: GetChirpsByUserPageDesc :many
+-- newest first, otherwise GetChirpsByUserPage
+SELECT * FROM chirps
+WHERE user_id = ?1
+AND hidden_at IS NULL
+AND (created_at < ?2 OR (created_at = ?2 AND id < ?3))
+AND NOT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (user_blocks.blocker_id = ?4 AND user_blocks.blocked_id = chirps.user_id)
+    OR (user_blocks.blocker_id = chirps.user_id AND user_blocks.blocked_id = ?4)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM user_mutes
+    WHERE user_mutes.muter_id = ?4 AND user_mutes.muted_id = chirps.user_id
+)
+ORDER BY created_at DESC, id DESC
+LIMIT ?5;
+
+-- name: GetChirpsByUserVersion :one
+-- how many chirps GetChirpsByUser has and a digest of which ones at which
+-- version, enough to version the listing without reading it
+-- sqlite has no hash function, so its digest is the list itself
+SELECT COUNT(*) AS total,
+    COALESCE(group_concat(id || ' ' || updated_at, ',' ORDER BY id), '') AS digest
+FROM chirps
+WHERE user_id = ?1
+AND hidden_at IS NULL
+AND NOT EXISTS (
+    SELECT 1 FROM user_blocks
+    WHERE (user_blocks.blocker_id = ?2 AND user_blocks.blocked_id = chirps.user_id)
+    OR (user_blocks.blocker_id = chirps.user_id AND user_blocks.blocked_id = ?2)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM user_mutes
+    WHERE user_mutes.muter_id = ?2 AND user_mutes.muted_id = chirps.user_id
+);
+
+-- name: HideChirp :exec
+UPDATE chirps
+SET hidden_at = ?1,
+updated_at = ?1
+WHERE id = ?2;
\ No newline at end of file
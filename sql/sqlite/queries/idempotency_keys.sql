@@ -0,0 +1,33 @@
+-- name: CreateIdempotencyKey :one
+INSERT INTO idempotency_keys (user_id, key, request_hash, created_at, expires_at)
+VALUES (
+    ?1,
+    ?2,
+    ?3,
+    ?4,
+    ?5
+)
+RETURNING *;
+
+-- name: GetIdempotencyKey :one
+SELECT * FROM idempotency_keys
+WHERE user_id = ?1
+AND key = ?2;
+
+-- name: SaveIdempotencyResponse :exec
+UPDATE idempotency_keys
+SET status = ?3,
+content_type = ?4,
+body = ?5,
+headers = ?6
+WHERE user_id = ?1
+AND key = ?2;
+
+-- name: DeleteIdempotencyKey :exec
+DELETE FROM idempotency_keys
+WHERE user_id = ?1
+AND key = ?2;
+
+-- name: DeleteExpiredIdempotencyKeys :exec
+DELETE FROM idempotency_keys
+WHERE expires_at < ?1;
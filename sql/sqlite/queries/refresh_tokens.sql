@@ -0,0 +1,28 @@
+-- name: CreateRefreshToken :one
+INSERT INTO refresh_tokens (token,created_at,updated_at,user_id,expires_at,revoked_at)
+VALUES (
+    ?1,
+    ?2,
+    ?2,
+    ?3,
+    ?4,
+    NULL
+)
+RETURNING *;
+
+-- name: GetRefreshTokenFromToken :one
+SELECT * FROM refresh_tokens
+WHERE token = ?1;
+
+-- name: RevokeToken :exec
+UPDATE refresh_tokens
+SET updated_at = ?1,
+revoked_at = ?1
+WHERE token = ?2;
+
+-- name: RevokeAllUserTokens :exec
+UPDATE refresh_tokens
+SET updated_at = ?1,
+revoked_at = ?1
+WHERE user_id = ?2
+AND revoked_at IS NULL;
\ No newline at end of file
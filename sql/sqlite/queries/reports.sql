@@ -0,0 +1,62 @@
+-- name: CreateReport :one
+INSERT INTO reports (id,created_at,updated_at,chirp_id,reporter_id,reason,details,status)
+VALUES (
+    ?1,
+    ?2,
+    ?2,
+    ?3,
+    ?4,
+    ?5,
+    ?6,
+    'open'
+)
+RETURNING *;
+
+-- name: GetReport :one
+SELECT * FROM reports
+WHERE id = ?1;
+
+-- name: GetReportsByStatus :many
+SELECT * FROM reports
+WHERE status = ?1
+ORDER BY created_at ASC;
+
+-- name: ClaimReport :one
+UPDATE reports
+SET status = 'claimed',
+claimed_by = ?1,
+claimed_at = ?2,
+updated_at = ?2
+WHERE id = ?3
+AND (status = 'open' OR (status = 'claimed' AND claimed_by = ?1))
+RETURNING *;
+
+-- name: ResolveReport :one
+UPDATE reports
+SET status = 'resolved',
+resolution = ?1,
+resolved_at = ?2,
+updated_at = ?2
+WHERE id = ?3
+AND status <> 'resolved'
+AND (claimed_by IS NULL OR claimed_by = ?4)
+RETURNING *;
+
+-- name: CreateModerationAction :one
+INSERT INTO moderation_actions (id,created_at,moderator_id,action,report_id,chirp_id,target_user_id,note)
+VALUES (
+    ?1,
+    ?2,
+    ?3,
+    ?4,
+    ?5,
+    ?6,
+    ?7,
+    ?8
+)
+RETURNING *;
+
+-- name: GetModerationActions :many
+SELECT * FROM moderation_actions
+ORDER BY created_at DESC
+LIMIT ?1;
\ No newline at end of file
@@ -0,0 +1,63 @@
+-- name: CreateUser :one
+INSERT INTO users (id,created_at,updated_at,email,hashed_password)
+VALUES (
+    ?1,
+    ?2,
+    ?2,
+    ?3,
+    ?4
+)
+RETURNING *;
+
+-- name: DeleteAllUsers :exec
+DELETE FROM users;
+
+-- name: GetUserByEmail :one
+SELECT * FROM users
+WHERE email = ?1;
+
+-- name: UpdatePswdEml :exec
+UPDATE users
+SET hashed_password = ?1,
+email = ?2, updated_at = ?3
+WHERE id = ?4;
+
+-- name: UpgradeRedByID :exec
+UPDATE users
+SET is_chirpy_red = TRUE,
+updated_at = ?1
+WHERE id = ?2;
+
+-- name: GetUserByID :one
+SELECT * FROM users
+WHERE id = ?1;
+
+-- name: SuspendUser :exec
+UPDATE users
+SET suspended_at = ?1,
+suspended_until = ?2,
+updated_at = ?1
+WHERE id = ?3;
+
+-- name: UnsuspendUser :exec
+UPDATE users
+SET suspended_at = NULL,
+suspended_until = NULL,
+updated_at = ?1
+WHERE id = ?2;
+
+-- name: SetUserRole :exec
+UPDATE users
+SET role = ?1,
+updated_at = ?2
+WHERE id = ?3;
+
+-- name: ListUsers :many
+SELECT * FROM users
+ORDER BY created_at ASC;
+
+-- name: DowngradeRedByID :exec
+UPDATE users
+SET is_chirpy_red = FALSE,
+updated_at = ?1
+WHERE id = ?2;
\ No newline at end of file
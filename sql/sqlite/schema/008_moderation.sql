@@ -0,0 +1,55 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD COLUMN hidden_at TIMESTAMP NULL;
+
+ALTER TABLE users
+ADD COLUMN suspended_at TIMESTAMP NULL;
+
+ALTER TABLE users
+ADD COLUMN suspended_until TIMESTAMP NULL;
+
+CREATE TABLE reports (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    chirp_id UUID NOT NULL,
+    reporter_id UUID NOT NULL,
+    reason TEXT NOT NULL,
+    details TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'open',
+    claimed_by UUID NULL,
+    claimed_at TIMESTAMP NULL,
+    resolved_at TIMESTAMP NULL,
+    resolution TEXT NULL,
+    UNIQUE (chirp_id, reporter_id),
+    FOREIGN KEY (chirp_id) REFERENCES chirps(id) ON DELETE CASCADE,
+    FOREIGN KEY (reporter_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (claimed_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX reports_status_created_at_idx ON reports (status, created_at);
+
+-- no foreign keys so the audit trail outlives deleted chirps and users
+CREATE TABLE moderation_actions (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    moderator_id UUID NOT NULL,
+    action TEXT NOT NULL,
+    report_id UUID NULL,
+    chirp_id UUID NULL,
+    target_user_id UUID NULL,
+    note TEXT NOT NULL
+);
+
+-- +goose Down
+DROP TABLE moderation_actions;
+DROP TABLE reports;
+
+ALTER TABLE users
+DROP COLUMN suspended_until;
+
+ALTER TABLE users
+DROP COLUMN suspended_at;
+
+ALTER TABLE chirps
+DROP COLUMN hidden_at;
\ No newline at end of file
@@ -0,0 +1,20 @@
+-- +goose Up
+-- the first response to each Idempotency-Key, replayed to retries
+CREATE TABLE idempotency_keys (
+    user_id UUID NOT NULL,
+    key TEXT NOT NULL,
+    request_hash TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    -- null while the first request is still running
+    status INTEGER,
+    content_type TEXT NOT NULL DEFAULT '',
+    body BLOB,
+    PRIMARY KEY (user_id, key),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
+
+-- +goose Down
+DROP TABLE idempotency_keys;
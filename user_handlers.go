@@ -9,6 +9,7 @@ import (
 
 	"github.com/frankielb/chirpy/internal/auth"
 	"github.com/frankielb/chirpy/internal/database"
+	"github.com/frankielb/chirpy/internal/realtime"
 	"github.com/google/uuid"
 )
 
@@ -25,105 +26,51 @@ type userIn struct {
 	Password string `json:"password"`
 }
 
+func toUser(user database.User) User {
+	return User{
+		ID:          user.ID,
+		CreatedAt:   user.CreatedAt,
+		UpdatedAt:   user.UpdatedAt,
+		Email:       user.Email,
+		IsChirpyRed: user.IsChirpyRed,
+	}
+}
+
 func (cfg *apiConfig) createUserHandler(w http.ResponseWriter, r *http.Request) {
 
-	// read it into struct
-	decoder := json.NewDecoder(r.Body)
+	// read it into struct, the service checks it
 	newUser := userIn{}
-	if err := decoder.Decode(&newUser); err != nil {
-		respondJSONError(w, http.StatusInternalServerError, "Couldn't decode new user", err)
-
-	}
-	// hash the password
-	hash, err := auth.HashPassword(newUser.Password)
-	if err != nil {
-		respondJSONError(w, http.StatusInternalServerError, "Couldnt hash password", err)
+	if !decodeJSON(w, r, &newUser, nil) {
 		return
 	}
-	// create the user
-	dbUser, err := cfg.DB.CreateUser(r.Context(), database.CreateUserParams{
-		Email:          newUser.Email,
-		HashedPassword: hash,
-	})
+	dbUser, err := cfg.Service.CreateUser(r.Context(), newUser.Email, newUser.Password)
 	if err != nil {
-		respondJSONError(w, http.StatusInternalServerError, "Couldn't create user", err)
-	}
-	user := User{
-		ID:          dbUser.ID,
-		CreatedAt:   dbUser.CreatedAt,
-		UpdatedAt:   dbUser.UpdatedAt,
-		Email:       dbUser.Email,
-		IsChirpyRed: false,
+		respondServiceError(w, r, err)
+		return
 	}
-	respondJSON(w, http.StatusCreated, user)
+	respondJSON(w, r, http.StatusCreated, toUser(dbUser))
 }
 
 func (cfg *apiConfig) loginHandler(w http.ResponseWriter, r *http.Request) {
-	type loginRequest struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
-		//ExpiresInSeconds int    `json:"expires_in_seconds,omitempty"`
-	}
 	type response struct {
 		User
 		Token        string `json:"token"`
 		RefreshToken string `json:"refresh_token"`
 	}
 
-	decoder := json.NewDecoder(r.Body)
-	userReq := loginRequest{}
-	if err := decoder.Decode(&userReq); err != nil {
-		respondJSONError(w, http.StatusInternalServerError, "Couldn't decode new user", err)
-		return
-	}
-	user, err := cfg.DB.GetUserByEmail(r.Context(), userReq.Email)
-	if err != nil {
-		respondJSONError(w, http.StatusUnauthorized, "Incorrect email or password", err)
-		return
-	}
-	// check password
-	if err := auth.CheckPasswordHash(user.HashedPassword, userReq.Password); err != nil {
-		respondJSONError(w, http.StatusUnauthorized, "Incorrect email or password", err)
-		return
-	}
-
-	//get expire time
-	expirationTime := time.Hour
-
-	// make token
-	token, err := auth.MakeJWT(user.ID,
-		cfg.Secret,
-		expirationTime)
-	if err != nil {
-		respondJSONError(w, http.StatusInternalServerError, "coiuldnt create auth token", err)
+	userReq := userIn{}
+	if !decodeJSON(w, r, &userReq, nil) {
 		return
 	}
-
-	// make refresh token
-	refresh, err := auth.MakeRefreshToken()
+	session, err := cfg.Service.Login(r.Context(), userReq.Email, userReq.Password)
 	if err != nil {
-		respondJSONError(w, http.StatusInternalServerError, "coiuldnt create auth token", err)
-		return
-	}
-	// add to db
-	if _, err := cfg.DB.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
-		Token:     refresh,
-		UserID:    user.ID,
-		ExpiresAt: time.Now().Add(60 * 24 * time.Hour),
-	}); err != nil {
-		respondJSONError(w, http.StatusInternalServerError, "coiuldnt add re token to db", err)
+		respondServiceError(w, r, err)
 		return
 	}
-	respondJSON(w, http.StatusOK, response{
-		User: User{
-			ID:          user.ID,
-			CreatedAt:   user.CreatedAt,
-			UpdatedAt:   user.UpdatedAt,
-			Email:       user.Email,
-			IsChirpyRed: user.IsChirpyRed,
-		},
-		Token:        token,
-		RefreshToken: refresh,
+	respondJSON(w, r, http.StatusOK, response{
+		User:         toUser(session.User),
+		Token:        session.Token,
+		RefreshToken: session.RefreshToken,
 	})
 }
 
@@ -131,97 +78,53 @@ func (cfg *apiConfig) refreshHandler(w http.ResponseWriter, r *http.Request) {
 	// get token from header
 	refreshToken, err := auth.GetBearerToken(r.Header)
 	if err != nil {
-		respondJSONError(w, http.StatusUnauthorized, "couldn't find bearer token", err)
+		respondJSONError(w, r, http.StatusUnauthorized, "couldn't find bearer token", err)
 		return
 	}
-	// check token is in db and good
-	rTokenDB, err := cfg.DB.GetRefreshTokenFromToken(r.Context(), refreshToken)
+	accessToken, err := cfg.Service.Refresh(r.Context(), refreshToken)
 	if err != nil {
-		respondJSONError(w, http.StatusUnauthorized, "invalid token: nf", err)
-		return
-	}
-	if rTokenDB.ExpiresAt.Before(time.Now()) {
-		respondJSONError(w, http.StatusUnauthorized, "invalid token: exp", nil)
-		return
-	}
-	if rTokenDB.RevokedAt.Valid {
-		respondJSONError(w, http.StatusUnauthorized, "invalid token: rvkd", nil)
-		return
-	}
-	// make new jwt
-	accessToken, err := auth.MakeJWT(rTokenDB.UserID, cfg.Secret, time.Hour)
-	if err != nil {
-		respondJSONError(w, http.StatusInternalServerError, "couldn't create access token", err)
+		respondServiceError(w, r, err)
 		return
 	}
 	// respond
 	type response struct {
 		Token string `json:"token"`
 	}
-	respondJSON(w, http.StatusOK, response{Token: accessToken})
+	respondJSON(w, r, http.StatusOK, response{Token: accessToken})
 }
 
 func (cfg *apiConfig) revokeHandler(w http.ResponseWriter, r *http.Request) {
 	// get token from header
 	refreshToken, err := auth.GetBearerToken(r.Header)
 	if err != nil {
-		respondJSONError(w, http.StatusUnauthorized, "couldn't find bearer token", err)
+		respondJSONError(w, r, http.StatusUnauthorized, "couldn't find bearer token", err)
 		return
 	}
-	if err := cfg.DB.RevokeToken(r.Context(), refreshToken); err != nil {
-		respondJSONError(w, http.StatusInternalServerError, "couldn't revoke token", err)
+	if err := cfg.Service.Revoke(r.Context(), refreshToken); err != nil {
+		respondServiceError(w, r, err)
+		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
 func (cfg *apiConfig) updatePswdEmlHandler(w http.ResponseWriter, r *http.Request) {
 	// find user via jwt
-	refreshToken, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondJSONError(w, http.StatusUnauthorized, "couldn't find bearer token", err)
+	userId, ok := cfg.authUserID(w, r)
+	if !ok {
 		return
 	}
 
-	userId, err := auth.ValidateJWT(refreshToken, cfg.Secret)
-	if err != nil {
-		respondJSONError(w, http.StatusUnauthorized, "bad token", err)
-	}
-
 	// read req
-	decoder := json.NewDecoder(r.Body)
 	newPwdEml := userIn{}
-	if err := decoder.Decode(&newPwdEml); err != nil {
-		respondJSONError(w, http.StatusInternalServerError, "Couldn't decode new user", err)
+	if !decodeJSON(w, r, &newPwdEml, nil) {
 		return
 	}
-	// hash password
-	hashedPswd, err := auth.HashPassword(newPwdEml.Password)
+	userOut, err := cfg.Service.UpdateUser(r.Context(), userId, newPwdEml.Email, newPwdEml.Password)
 	if err != nil {
-		respondJSONError(w, http.StatusInternalServerError, "couldn't hash password", err)
+		respondServiceError(w, r, err)
 		return
 	}
-	// update in DB
-	if err := cfg.DB.UpdatePswdEml(r.Context(), database.UpdatePswdEmlParams{
-		HashedPassword: hashedPswd,
-		Email:          newPwdEml.Email,
-		ID:             userId,
-	}); err != nil {
-		respondJSONError(w, http.StatusInternalServerError, "couldn't update", err)
-		return
-	}
-	// get updated user for out
-	userOut, err := cfg.DB.GetUserByEmail(r.Context(), newPwdEml.Email)
-	if err != nil {
-		respondJSONError(w, http.StatusInternalServerError, "didnt update", err)
-		return
-	}
-	respondJSON(w, http.StatusOK, User{
-		ID:          userOut.ID,
-		CreatedAt:   userOut.CreatedAt,
-		UpdatedAt:   userOut.UpdatedAt,
-		Email:       userOut.Email,
-		IsChirpyRed: userOut.IsChirpyRed,
-	})
+	respondJSON(w, r, http.StatusOK, toUser(userOut))
 
 }
 
@@ -229,11 +132,11 @@ func (cfg *apiConfig) upgradeHandler(w http.ResponseWriter, r *http.Request) {
 	// check apikey
 	apikey, err := auth.GetAPIKey(r.Header)
 	if err != nil {
-		respondJSONError(w, http.StatusUnauthorized, "couldn't get apiKey", err)
+		respondJSONError(w, r, http.StatusUnauthorized, "couldn't get apiKey", err)
 		return
 	}
 	if apikey != cfg.PolkaKey {
-		respondJSONError(w, http.StatusUnauthorized, "unauthorized", err)
+		respondJSONError(w, r, http.StatusUnauthorized, "unauthorized", err)
 		return
 	}
 
@@ -244,26 +147,32 @@ func (cfg *apiConfig) upgradeHandler(w http.ResponseWriter, r *http.Request) {
 		Event string `json:"event"`
 		Data  data   `json:"data"`
 	}
-	// read req
-	decoder := json.NewDecoder(r.Body)
+	// read req, not with decodeJSON as polka can add fields whenever it likes
 	request := req{}
-	if err := decoder.Decode(&request); err != nil {
-		respondJSONError(w, http.StatusInternalServerError, "Couldn't decode request", err)
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		respondProblem(w, r, decodeProblem(err), err)
 		return
 	}
 	if request.Event != "user.upgraded" {
-		respondJSON(w, http.StatusNoContent, nil)
+		// label as other so polka can't make us a new series per event name
+		cfg.Metrics.WebhookEvents.WithLabelValues("other", "ignored").Inc()
+		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 	// upgrade
 	if err := cfg.DB.UpgradeRedByID(r.Context(), request.Data.UserID); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			respondJSONError(w, http.StatusNotFound, "user not found", err)
+			cfg.Metrics.WebhookEvents.WithLabelValues(request.Event, "not_found").Inc()
+			respondJSONError(w, r, http.StatusNotFound, "user not found", err)
 			return
 		}
-		respondJSONError(w, http.StatusInternalServerError, "Couldn't upgrade user", err)
+		cfg.Metrics.WebhookEvents.WithLabelValues(request.Event, "error").Inc()
+		respondJSONError(w, r, http.StatusInternalServerError, "Couldn't upgrade user", err)
 		return
 	}
-	respondJSON(w, http.StatusNoContent, nil)
+	cfg.redUsers.forget(request.Data.UserID)
+	cfg.Metrics.WebhookEvents.WithLabelValues(request.Event, "upgraded").Inc()
+	w.WriteHeader(http.StatusNoContent)
+	cfg.Hub.Publish(realtime.UserTopic(request.Data.UserID), realtime.TypeUserUpgraded, nil, nil)
 
 }
@@ -1,9 +1,10 @@
 package main
 
 import (
-	"encoding/json"
 	"net/http"
 	"strings"
+
+	"github.com/frankielb/chirpy/internal/service"
 )
 
 func validateHandler(w http.ResponseWriter, r *http.Request) {
@@ -11,15 +12,10 @@ func validateHandler(w http.ResponseWriter, r *http.Request) {
 		Body string `json:"body"`
 	}
 	// read it into struct
-	decoder := json.NewDecoder(r.Body)
 	parameter := parameters{}
-	if err := decoder.Decode(&parameter); err != nil {
-		respondJSONError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
-
-	}
-	// too long
-	if len(parameter.Body) > 140 {
-		respondJSONError(w, http.StatusBadRequest, "Chirp is too long", nil)
+	if !decodeJSON(w, r, &parameter, func(v *service.Validator) {
+		v.Check(len(parameter.Body) <= 140, "body", "too_long", "Chirp is too long")
+	}) {
 		return
 	}
 
@@ -42,7 +38,7 @@ func validateHandler(w http.ResponseWriter, r *http.Request) {
 	type cleanOut struct {
 		CleanBody string `json:"cleaned_body"`
 	}
-	respondJSON(w, http.StatusOK, cleanOut{
+	respondJSON(w, r, http.StatusOK, cleanOut{
 		CleanBody: cleanText,
 	})
 }